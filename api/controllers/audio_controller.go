@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/api/services"
+	"LaoQGChat/internal/myerrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AudioController interface {
+	Transcribe(ctx *gin.Context)
+}
+
+type audioController struct {
+	service services.AudioService
+}
+
+func NewAudioController(service services.AudioService) AudioController {
+	controller := new(audioController)
+	controller.service = service
+	return controller
+}
+
+// Transcribe 请求体为multipart/form-data（file）或JSON（data）
+func (c *audioController) Transcribe(ctx *gin.Context) {
+	inDto := models.AudioTranscribeInDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil || (inDto.File == nil && inDto.Data == "") {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.Transcribe(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
@@ -10,6 +10,13 @@ import (
 
 type AuthController interface {
 	Login(ctx *gin.Context)
+	Register(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
+	DeleteAccount(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	ListDevices(ctx *gin.Context)
+	RevokeDevice(ctx *gin.Context)
+	Refresh(ctx *gin.Context)
 }
 
 type authController struct {
@@ -37,3 +44,93 @@ func (c *authController) Login(ctx *gin.Context) {
 	outDto := c.service.Login(ctx, inDto)
 	ctx.Set("ResponseData", outDto)
 }
+
+func (c *authController) Register(ctx *gin.Context) {
+	inDto := models.AuthDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.Register(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) ChangePassword(ctx *gin.Context) {
+	inDto := models.ChangePasswordDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.ChangePassword(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) DeleteAccount(ctx *gin.Context) {
+	inDto := models.AuthDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.DeleteAccount(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) Logout(ctx *gin.Context) {
+	outDto := c.service.Logout(ctx)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) ListDevices(ctx *gin.Context) {
+	outDto := c.service.ListDevices(ctx)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) RevokeDevice(ctx *gin.Context) {
+	inDto := models.AuthDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.RevokeDevice(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *authController) Refresh(ctx *gin.Context) {
+	inDto := models.AuthDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.Refresh(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
@@ -10,7 +10,13 @@ import (
 type ChatController interface {
 	StartChat(context *gin.Context)
 	Chat(context *gin.Context)
+	StartChatStream(context *gin.Context)
+	ChatStream(context *gin.Context)
 	EndChat(context *gin.Context)
+	ListSessions(context *gin.Context)
+	GetSession(context *gin.Context)
+	SelectChoice(context *gin.Context)
+	ListModels(context *gin.Context)
 }
 
 type chatController struct {
@@ -57,6 +63,46 @@ func (c chatController) Chat(ctx *gin.Context) {
 	ctx.Set("ResponseData", outDto)
 }
 
+func (c chatController) StartChatStream(ctx *gin.Context) {
+	var inDto models.ChatInDto
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.StartChatStream(ctx, inDto, streamDelta(ctx))
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c chatController) ChatStream(ctx *gin.Context) {
+	var inDto models.ChatInDto
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.ChatStream(ctx, inDto, streamDelta(ctx))
+	ctx.Set("ResponseData", outDto)
+}
+
+// streamDelta 将回答的增量以delta事件推送给客户端
+func streamDelta(ctx *gin.Context) func(delta models.ChatStreamDeltaDto) {
+	return func(delta models.ChatStreamDeltaDto) {
+		ctx.SSEvent("delta", delta)
+		ctx.Writer.Flush()
+	}
+}
+
 func (c chatController) EndChat(ctx *gin.Context) {
 	var inDto models.ChatInDto
 	err := ctx.Bind(&inDto)
@@ -72,3 +118,56 @@ func (c chatController) EndChat(ctx *gin.Context) {
 	outDto := c.service.EndChat(ctx, inDto)
 	ctx.Set("ResponseData", outDto)
 }
+
+func (c chatController) ListSessions(ctx *gin.Context) {
+	var inDto models.ChatSessionListInDto
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.ListSessions(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c chatController) GetSession(ctx *gin.Context) {
+	var inDto models.ChatInDto
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.GetSession(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c chatController) SelectChoice(ctx *gin.Context) {
+	var inDto models.ChatSelectChoiceInDto
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.SelectChoice(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c chatController) ListModels(ctx *gin.Context) {
+	outDto := c.service.ListModels(ctx)
+	ctx.Set("ResponseData", outDto)
+}
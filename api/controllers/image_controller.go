@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/api/services"
+	"LaoQGChat/internal/myerrors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImageController interface {
+	Upload(ctx *gin.Context)
+	Get(ctx *gin.Context)
+}
+
+type imageController struct {
+	service services.ImageService
+}
+
+func NewImageController(service services.ImageService) ImageController {
+	controller := new(imageController)
+	controller.service = service
+	return controller
+}
+
+// Upload 请求体为multipart/form-data（file）或JSON（data）
+func (c *imageController) Upload(ctx *gin.Context) {
+	inDto := models.ImageUploadInDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil || (inDto.File == nil && inDto.Data == "") {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.Upload(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+// Get 签名URL直接返回图片数据，签名无效、已过期或图片不存在时返回404
+func (c *imageController) Get(ctx *gin.Context) {
+	inDto := models.ImageGetInDto{}
+	if ctx.ShouldBindUri(&inDto) != nil || ctx.ShouldBindQuery(&inDto) != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	image, mimeType, ok := c.service.Get(ctx, inDto)
+	if !ok {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	maxAge := max(inDto.Expires-time.Now().Unix(), 0)
+	ctx.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	ctx.Data(http.StatusOK, mimeType, image)
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/api/services"
+	"LaoQGChat/internal/myerrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KnowledgeController interface {
+	ListKnowledgeBases(ctx *gin.Context)
+	CreateKnowledgeBase(ctx *gin.Context)
+	DeleteKnowledgeBase(ctx *gin.Context)
+	ListDocuments(ctx *gin.Context)
+	UploadDocument(ctx *gin.Context)
+	DeleteDocument(ctx *gin.Context)
+	Search(ctx *gin.Context)
+}
+
+type knowledgeController struct {
+	service services.KnowledgeService
+}
+
+func NewKnowledgeController(service services.KnowledgeService) KnowledgeController {
+	controller := new(knowledgeController)
+	controller.service = service
+	return controller
+}
+
+func (c *knowledgeController) ListKnowledgeBases(ctx *gin.Context) {
+	outDto := c.service.ListKnowledgeBases(ctx)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *knowledgeController) CreateKnowledgeBase(ctx *gin.Context) {
+	inDto := models.KnowledgeBaseDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.CreateKnowledgeBase(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *knowledgeController) DeleteKnowledgeBase(ctx *gin.Context) {
+	inDto := models.KnowledgeBaseDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.DeleteKnowledgeBase(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *knowledgeController) ListDocuments(ctx *gin.Context) {
+	inDto := models.KnowledgeBaseDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.ListDocuments(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+// UploadDocument 请求体为multipart/form-data（knowledgeBaseId、file）或JSON（knowledgeBaseId、data、fileName）
+func (c *knowledgeController) UploadDocument(ctx *gin.Context) {
+	inDto := models.KnowledgeDocumentUploadInDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil || (inDto.File == nil && inDto.Data == "") {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.UploadDocument(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *knowledgeController) DeleteDocument(ctx *gin.Context) {
+	inDto := models.KnowledgeDocumentDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.DeleteDocument(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *knowledgeController) Search(ctx *gin.Context) {
+	inDto := models.KnowledgeSearchInDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.Search(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/api/services"
+	"LaoQGChat/internal/myerrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PersonaController interface {
+	ListPersonas(ctx *gin.Context)
+	CreatePersona(ctx *gin.Context)
+	UpdatePersona(ctx *gin.Context)
+	DeletePersona(ctx *gin.Context)
+}
+
+type personaController struct {
+	service services.PersonaService
+}
+
+func NewPersonaController(service services.PersonaService) PersonaController {
+	controller := new(personaController)
+	controller.service = service
+	return controller
+}
+
+func (c *personaController) ListPersonas(ctx *gin.Context) {
+	outDto := c.service.ListPersonas(ctx)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *personaController) CreatePersona(ctx *gin.Context) {
+	inDto := models.PersonaDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.CreatePersona(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *personaController) UpdatePersona(ctx *gin.Context) {
+	inDto := models.PersonaDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.UpdatePersona(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *personaController) DeletePersona(ctx *gin.Context) {
+	inDto := models.PersonaDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.DeletePersona(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
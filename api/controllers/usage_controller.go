@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/api/services"
+	"LaoQGChat/internal/myerrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageController interface {
+	GetQuota(ctx *gin.Context)
+	GetSummary(ctx *gin.Context)
+}
+
+type usageController struct {
+	service services.UsageService
+}
+
+func NewUsageController(service services.UsageService) UsageController {
+	controller := new(usageController)
+	controller.service = service
+	return controller
+}
+
+func (c *usageController) GetQuota(ctx *gin.Context) {
+	outDto := c.service.GetQuota(ctx)
+	ctx.Set("ResponseData", outDto)
+}
+
+func (c *usageController) GetSummary(ctx *gin.Context) {
+	inDto := models.UsageSummaryInDto{}
+	err := ctx.Bind(&inDto)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "E0000",
+			MessageText: "请求体格式错误。",
+		}
+		_ = ctx.Error(err)
+		return
+	}
+	outDto := c.service.GetSummary(ctx, inDto)
+	ctx.Set("ResponseData", outDto)
+}
@@ -3,41 +3,37 @@ package middlewares
 import (
 	"LaoQGChat/api/models"
 	"LaoQGChat/internal/myerrors"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"net/http"
 )
 
-func AuthHandler(checkFunc func(loginToken uuid.UUID) (*models.AuthDto, error)) gin.HandlerFunc {
+func AuthHandler(checkFunc func(loginToken string) (*models.AuthDto, error), publicPaths ...string) gin.HandlerFunc {
+	publicPathSet := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		publicPathSet[path] = true
+	}
+
 	return func(ctx *gin.Context) {
 		// 前处理
 		// 认证除外
-		if ctx.Request.RequestURI != "/Auth/Login" {
+		if !publicPathSet[ctx.Request.URL.Path] {
 			var (
-				err        error
-				loginToken uuid.UUID
-				authDto    *models.AuthDto
+				err     error
+				authDto *models.AuthDto
 			)
 
-			// 获取loginToken
-			loginToken, err = uuid.Parse(ctx.GetHeader("LoginToken"))
-			if err != nil {
-				err = &myerrors.CustomError{
-					StatusCode:  200,
-					MessageCode: "EAU01",
-					MessageText: "用户未登录。",
-				}
-				_ = ctx.AbortWithError(http.StatusNonAuthoritativeInfo, err)
-				return
-			}
-
 			// 验证登陆状态
-			authDto, err = checkFunc(loginToken)
+			authDto, err = checkFunc(ctx.GetHeader("LoginToken"))
 			if err != nil {
-				err = &myerrors.CustomError{
-					StatusCode:  200,
-					MessageCode: "EAU01",
-					MessageText: "用户未登录。",
+				// 超时、令牌过期等原因原样返回给客户端
+				var customError *myerrors.CustomError
+				if !errors.As(err, &customError) {
+					err = &myerrors.CustomError{
+						StatusCode:  200,
+						MessageCode: "EAU01",
+						MessageText: "用户未登录。",
+					}
 				}
 				_ = ctx.AbortWithError(http.StatusNonAuthoritativeInfo, err)
 				return
@@ -46,6 +42,7 @@ func AuthHandler(checkFunc func(loginToken uuid.UUID) (*models.AuthDto, error))
 			// 设置用户信息
 			ctx.Set("UserName", authDto.Username)
 			ctx.Set("Permission", authDto.Permission)
+			ctx.Set("DeviceId", authDto.DeviceId)
 		}
 
 		// 下一层
@@ -26,7 +26,17 @@ func ErrorHandler() gin.HandlerFunc {
 			response.Data = makeResponseData(ctx)
 
 			// 设置响应
-			ctx.JSON(http.StatusOK, response)
+			if ctx.GetBool("Streaming") {
+				// 流式响应：以done或error事件返回与普通响应相同的响应体
+				event := "done"
+				if response.Common.Status != models.ResponseCommonStatusSuccess {
+					event = "error"
+				}
+				ctx.SSEvent(event, response)
+				ctx.Writer.Flush()
+			} else {
+				ctx.JSON(http.StatusOK, response)
+			}
 		}()
 
 		// 下一层
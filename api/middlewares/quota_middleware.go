@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaHandler 调用模型服务前检查用户的使用额度，只用于需要调用模型服务的路由
+func QuotaHandler(checkFunc func(userName string, permission string) error) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// 前处理
+		err := checkFunc(ctx.GetString("UserName"), ctx.GetString("Permission"))
+		if err != nil {
+			_ = ctx.AbortWithError(http.StatusOK, err)
+			return
+		}
+
+		// 下一层
+		ctx.Next()
+
+		// 后处理
+	}
+}
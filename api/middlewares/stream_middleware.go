@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// StreamHandler 流式路由以SSE返回，最终结果和错误由异常处理中间件以事件返回
+// 紧接在异常处理中间件之后配置，使版本检测、认证和额度检测等中间件的错误也以error事件返回
+func StreamHandler(streamPaths ...string) gin.HandlerFunc {
+	streamPathSet := make(map[string]bool, len(streamPaths))
+	for _, path := range streamPaths {
+		streamPathSet[path] = true
+	}
+
+	return func(ctx *gin.Context) {
+		// 前处理
+		if streamPathSet[ctx.Request.URL.Path] {
+			ctx.Set("Streaming", true)
+			ctx.Header("Cache-Control", "no-cache")
+			ctx.Header("X-Accel-Buffering", "no")
+		}
+
+		// 下一层
+		ctx.Next()
+
+		// 后处理
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "mime/multipart"
+
+// AudioTranscribeInDto multipart上传时使用file，JSON请求时使用data
+type AudioTranscribeInDto struct {
+	File *multipart.FileHeader `json:"-" form:"file"`
+	// Data base64编码的语音数据或data URL
+	Data string `json:"data" form:"-"`
+}
+
+type AudioTranscribeOutDto struct {
+	MimeType   string `json:"mimeType"`
+	Transcript string `json:"transcript"`
+}
@@ -1,10 +1,39 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type AuthDto struct {
-	Username   string    `json:"username"`
-	Password   string    `json:"password"`
-	LoginToken uuid.UUID `json:"loginToken"`
-	Permission string    `json:"permission"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password"`
+	LoginToken   string    `json:"loginToken"`
+	RefreshToken uuid.UUID `json:"refreshToken"`
+	// TokenExpireTime 访问令牌的过期时间
+	TokenExpireTime *time.Time `json:"tokenExpireTime,omitempty"`
+	Permission      string     `json:"permission"`
+	DeviceId        uuid.UUID  `json:"deviceId"`
+	DeviceName      string     `json:"deviceName"`
+}
+
+type ChangePasswordDto struct {
+	Password    string `json:"password"`
+	NewPassword string `json:"newPassword"`
+}
+
+type DeviceDto struct {
+	DeviceId      uuid.UUID `json:"deviceId"`
+	DeviceName    string    `json:"deviceName"`
+	ClientVersion string    `json:"clientVersion"`
+	IpAddress     string    `json:"ipAddress"`
+	LoginTime     time.Time `json:"loginTime"`
+	LastSeenTime  time.Time `json:"lastSeenTime"`
+	// Current 是否为发出请求的设备
+	Current bool `json:"current"`
+}
+
+type DeviceListDto struct {
+	Devices []DeviceDto `json:"devices"`
 }
@@ -2,15 +2,22 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
 	"github.com/google/uuid"
 )
 
 type ChatInDto struct {
-	SessionId uuid.UUID                     `json:"sessionId"`
-	Model     string                        `json:"model"`
-	Contents  []ChatQuestionContentPartsDto `json:"contents"`
+	SessionId uuid.UUID `json:"sessionId"`
+	Model     string    `json:"model"`
+	// PersonaId和SystemPrompt只在开始会话时有效，同时指定时SystemPrompt优先于角色的系统提示词
+	PersonaId    uuid.UUID `json:"personaId"`
+	SystemPrompt string    `json:"systemPrompt"`
+	// KnowledgeBaseId 会话使用的知识库，对话时指定会替换会话的知识库
+	KnowledgeBaseId uuid.UUID `json:"knowledgeBaseId"`
+	// N 候选回答数，省略时为1
+	N        int                           `json:"n"`
+	Contents []ChatQuestionContentPartsDto `json:"contents"`
 }
 
 func (chatInDto *ChatInDto) UnmarshalJSON(data []byte) error {
@@ -20,13 +27,23 @@ func (chatInDto *ChatInDto) UnmarshalJSON(data []byte) error {
 	)
 
 	chatTypeInDto := struct {
-		SessionId uuid.UUID         `json:"sessionId"`
-		Contents  []json.RawMessage `json:"contents"`
+		SessionId       uuid.UUID         `json:"sessionId"`
+		Model           string            `json:"model"`
+		PersonaId       uuid.UUID         `json:"personaId"`
+		SystemPrompt    string            `json:"systemPrompt"`
+		KnowledgeBaseId uuid.UUID         `json:"knowledgeBaseId"`
+		N               int               `json:"n"`
+		Contents        []json.RawMessage `json:"contents"`
 	}{}
 	if err = json.Unmarshal(data, &chatTypeInDto); err != nil {
 		return err
 	}
 	chatInDto.SessionId = chatTypeInDto.SessionId
+	chatInDto.Model = chatTypeInDto.Model
+	chatInDto.PersonaId = chatTypeInDto.PersonaId
+	chatInDto.SystemPrompt = chatTypeInDto.SystemPrompt
+	chatInDto.KnowledgeBaseId = chatTypeInDto.KnowledgeBaseId
+	chatInDto.N = chatTypeInDto.N
 	for _, content := range chatTypeInDto.Contents {
 		if err = json.Unmarshal(content, &typeContent); err != nil {
 			return err
@@ -48,24 +65,33 @@ func (chatInDto *ChatInDto) UnmarshalJSON(data []byte) error {
 			var imageContent ChatQuestionContentPartsDtoImageOCR
 			_ = json.Unmarshal(content, &imageContent)
 			chatInDto.Contents = append(chatInDto.Contents, &imageContent)
+		case "Document":
+			var documentContent ChatQuestionContentPartsDtoDocument
+			_ = json.Unmarshal(content, &documentContent)
+			chatInDto.Contents = append(chatInDto.Contents, &documentContent)
 		}
 	}
 	return nil
 }
 
-func (chatInDto *ChatInDto) ToAzopenai() azopenai.ChatRequestUserMessage {
-	var azopenaiContents []azopenai.ChatCompletionRequestMessageContentPartClassification
+func (chatInDto *ChatInDto) ToChatMessage() ChatMessage {
+	var contents []ChatMessageContentPart
 	for _, content := range chatInDto.Contents {
-		azopenaiContent, _ := content.ToChatCompletionRequestMessageContentPartClassification()
-		azopenaiContents = append(azopenaiContents, azopenaiContent)
+		chatMessageContentPart, err := content.ToChatMessageContentPart()
+		if err != nil {
+			continue
+		}
+		contents = append(contents, chatMessageContentPart)
+	}
+	return ChatMessage{
+		Role:    ChatRoleUser,
+		Content: contents,
 	}
-	chatRequestUserMessage := azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(azopenaiContents)}
-	return chatRequestUserMessage
 }
 
 type ChatQuestionContentPartsDto interface {
 	GetContentType() string
-	ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error)
+	ToChatMessageContentPart() (ChatMessageContentPart, error)
 }
 
 type ChatQuestionContentPartsDtoType struct {
@@ -76,8 +102,8 @@ func (chatQuestionContentPartsDtoType *ChatQuestionContentPartsDtoType) GetConte
 	return chatQuestionContentPartsDtoType.Type
 }
 
-func (chatQuestionContentPartsDtoType *ChatQuestionContentPartsDtoType) ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error) {
-	return nil, nil
+func (chatQuestionContentPartsDtoType *ChatQuestionContentPartsDtoType) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	return ChatMessageContentPart{}, errors.New("unknown content type")
 }
 
 type ChatQuestionContentPartsDtoText struct {
@@ -89,107 +115,180 @@ func (chatQuestionContentPartsDtoText *ChatQuestionContentPartsDtoText) GetConte
 	return chatQuestionContentPartsDtoText.Type
 }
 
-func (chatQuestionContentPartsDtoText *ChatQuestionContentPartsDtoText) ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error) {
-	return &azopenai.ChatCompletionRequestMessageContentPartText{
-		Text: &chatQuestionContentPartsDtoText.Text,
-	}, nil
+func (chatQuestionContentPartsDtoText *ChatQuestionContentPartsDtoText) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	return NewChatMessageContentPartText(chatQuestionContentPartsDtoText.Text), nil
 }
 
 type ChatQuestionContentPartsDtoImage struct {
 	Type     string `json:"type"`
 	ImageUrl string `json:"imageUrl"`
+	// ImageId 通过/Image/Upload上传的图片，指定时忽略ImageUrl
+	ImageId string `json:"imageId"`
+}
+
+// ImageRef 返回图片的URL或上传图片的引用
+func (chatQuestionContentPartsDtoImage *ChatQuestionContentPartsDtoImage) ImageRef() string {
+	if chatQuestionContentPartsDtoImage.ImageId != "" {
+		return ImageRef(chatQuestionContentPartsDtoImage.ImageId)
+	}
+	return chatQuestionContentPartsDtoImage.ImageUrl
 }
 
 func (chatQuestionContentPartsDtoImage *ChatQuestionContentPartsDtoImage) GetContentType() string {
 	return chatQuestionContentPartsDtoImage.Type
 }
 
-func (chatQuestionContentPartsDtoImage *ChatQuestionContentPartsDtoImage) ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error) {
-	return &azopenai.ChatCompletionRequestMessageContentPartImage{
-		ImageURL: &azopenai.ChatCompletionRequestMessageContentPartImageURL{
-			URL: &chatQuestionContentPartsDtoImage.ImageUrl,
-		},
-	}, nil
+func (chatQuestionContentPartsDtoImage *ChatQuestionContentPartsDtoImage) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	return NewChatMessageContentPartImage(chatQuestionContentPartsDtoImage.ImageRef()), nil
 }
 
+// ChatQuestionContentPartsDtoAudio 语音，由AudioService识别为文字后发送给模型服务
 type ChatQuestionContentPartsDtoAudio struct {
 	Type string `json:"type"`
-	Data string `json:"imageUrl"`
+	// Data base64编码的语音数据或data URL
+	Data string `json:"data"`
+	// ImageUrl 兼容旧版本客户端使用的字段名，Data为空时使用
+	ImageUrl string `json:"imageUrl"`
+	// MimeType 识别后设置为检测到的语音格式
+	MimeType   string `json:"-"`
+	Transcript string `json:"-"`
+}
+
+// AudioData 返回语音数据
+func (chatQuestionContentPartsDtoAudio *ChatQuestionContentPartsDtoAudio) AudioData() string {
+	if chatQuestionContentPartsDtoAudio.Data != "" {
+		return chatQuestionContentPartsDtoAudio.Data
+	}
+	return chatQuestionContentPartsDtoAudio.ImageUrl
 }
 
 func (chatQuestionContentPartsDtoAudio *ChatQuestionContentPartsDtoAudio) GetContentType() string {
 	return chatQuestionContentPartsDtoAudio.Type
 }
 
-func (chatQuestionContentPartsDtoAudio *ChatQuestionContentPartsDtoAudio) ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error) {
-	return &azopenai.ChatCompletionRequestMessageContentPartText{
-		Text: &chatQuestionContentPartsDtoAudio.Data,
-	}, nil
+func (chatQuestionContentPartsDtoAudio *ChatQuestionContentPartsDtoAudio) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	if chatQuestionContentPartsDtoAudio.Transcript == "" {
+		return ChatMessageContentPart{}, errors.New("audio not transcribed")
+	}
+	return NewChatMessageContentPartAudio(chatQuestionContentPartsDtoAudio.Transcript, chatQuestionContentPartsDtoAudio.MimeType), nil
 }
 
+// ChatQuestionContentPartsDtoImageOCR 识别图片中的文字，由OCRService识别后以文字发送给模型服务
 type ChatQuestionContentPartsDtoImageOCR struct {
-	Type     string `json:"type"`
+	Type string `json:"type"`
+	// ImageUrl http(s) URL或data URL
 	ImageUrl string `json:"imageUrl"`
+	// ImageId 通过/Image/Upload上传的图片，指定时忽略ImageUrl
+	ImageId string `json:"imageId"`
+	Text    string `json:"-"`
+}
+
+// ImageRef 返回图片的URL或上传图片的引用
+func (chatQuestionContentPartsDtoImageOCR *ChatQuestionContentPartsDtoImageOCR) ImageRef() string {
+	if chatQuestionContentPartsDtoImageOCR.ImageId != "" {
+		return ImageRef(chatQuestionContentPartsDtoImageOCR.ImageId)
+	}
+	return chatQuestionContentPartsDtoImageOCR.ImageUrl
 }
 
 func (chatQuestionContentPartsDtoImageOCR *ChatQuestionContentPartsDtoImageOCR) GetContentType() string {
 	return chatQuestionContentPartsDtoImageOCR.Type
 }
 
-func (chatQuestionContentPartsDtoImageOCR *ChatQuestionContentPartsDtoImageOCR) ToChatCompletionRequestMessageContentPartClassification() (azopenai.ChatCompletionRequestMessageContentPartClassification, error) {
-	return &azopenai.ChatCompletionRequestMessageContentPartText{
-		Text: &chatQuestionContentPartsDtoImageOCR.ImageUrl,
-	}, nil
+func (chatQuestionContentPartsDtoImageOCR *ChatQuestionContentPartsDtoImageOCR) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	if chatQuestionContentPartsDtoImageOCR.Text == "" {
+		return ChatMessageContentPart{}, errors.New("image not recognized")
+	}
+	return NewChatMessageContentPartImageOCR(chatQuestionContentPartsDtoImageOCR.ImageRef(), chatQuestionContentPartsDtoImageOCR.Text), nil
+}
+
+// ChatQuestionContentPartsDtoDocument 文档，由DocumentService提取文字并分割后发送给模型服务
+type ChatQuestionContentPartsDtoDocument struct {
+	Type string `json:"type"`
+	// Data base64编码的文档数据或data URL
+	Data string `json:"data"`
+	// FileName 文件名，显示在会话记录中，纯文本按扩展名区分Markdown
+	FileName string `json:"fileName"`
+	// Document 提取后设置
+	Document *ChatMessageDocument `json:"-"`
+}
+
+func (chatQuestionContentPartsDtoDocument *ChatQuestionContentPartsDtoDocument) GetContentType() string {
+	return chatQuestionContentPartsDtoDocument.Type
+}
+
+func (chatQuestionContentPartsDtoDocument *ChatQuestionContentPartsDtoDocument) ToChatMessageContentPart() (ChatMessageContentPart, error) {
+	if chatQuestionContentPartsDtoDocument.Document == nil {
+		return ChatMessageContentPart{}, errors.New("document not extracted")
+	}
+	return NewChatMessageContentPartDocument(*chatQuestionContentPartsDtoDocument.Document), nil
 }
 
 type ChatOutDto struct {
 	SessionId uuid.UUID `json:"sessionId"`
-	Answer    string    `json:"answer"`
-	Choices   []string  `json:"choices"`
+	Model     string    `json:"model"`
+	// Answer 保存到会话记录的回答，有多个候选时为第一个候选
+	Answer string `json:"answer"`
+	// Choices 请求多个候选回答时按顺序返回所有候选，可以通过/Chat/SelectChoice选择保存的候选
+	Choices []string `json:"choices"`
+	// Transcripts 问题中语音的识别结果，按语音在问题中的顺序
+	Transcripts []string `json:"transcripts,omitempty"`
+	// Truncation 历史消息超出模型的上下文长度被省略时设置
+	Truncation *ChatTruncationDto `json:"truncation,omitempty"`
+	// Citations 本次从会话的知识库中检索到的片段，回答中以[编号]引用
+	Citations []ChatCitationDto `json:"citations,omitempty"`
+	// ToolCalls 本次回答过程中按顺序执行的工具调用
+	ToolCalls []ChatToolCallDto `json:"toolCalls,omitempty"`
 }
 
-type ChatContext struct {
-	ChatMessages []azopenai.ChatRequestMessageClassification `json:"chatMessages"`
+// ChatSelectChoiceInDto 选择会话最后一个回答的候选，Index为ChatOutDto.Choices中的序号
+type ChatSelectChoiceInDto struct {
+	SessionId uuid.UUID `json:"sessionId"`
+	Index     int       `json:"index"`
 }
 
-func (chatContext *ChatContext) UnmarshalJSON(data []byte) error {
-	var (
-		err          error
-		chatMessage  azopenai.ChatRequestMessageClassification
-		chatMessages []azopenai.ChatRequestMessageClassification
-	)
-	chatStrContext := struct {
-		ChatMessageRaw []json.RawMessage `json:"chatMessages"`
-	}{}
-	if err = json.Unmarshal(data, &chatStrContext); err != nil {
-		return err
-	}
-	for _, chatMessageRaw := range chatStrContext.ChatMessageRaw {
-		chatRequestMessage := struct {
-			Role azopenai.ChatRole `json:"role"`
-		}{}
-		if err = json.Unmarshal(chatMessageRaw, &chatRequestMessage); err != nil {
-			return err
-		}
-		switch chatRequestMessage.Role {
-		case azopenai.ChatRoleAssistant:
-			chatMessage = &azopenai.ChatRequestAssistantMessage{}
-		case azopenai.ChatRoleFunction:
-			chatMessage = &azopenai.ChatRequestFunctionMessage{}
-		case azopenai.ChatRoleSystem:
-			chatMessage = &azopenai.ChatRequestSystemMessage{}
-		case azopenai.ChatRoleTool:
-			chatMessage = &azopenai.ChatRequestToolMessage{}
-		case azopenai.ChatRoleUser:
-			chatMessage = &azopenai.ChatRequestUserMessage{}
-		default:
-			chatMessage = &azopenai.ChatRequestMessage{}
-		}
-		if err = json.Unmarshal(chatMessageRaw, chatMessage); err != nil {
-			return err
-		}
-		chatMessages = append(chatMessages, chatMessage)
-	}
-	chatContext.ChatMessages = chatMessages
-	return nil
+// ChatToolCallDto 模型调用的工具，Arguments为JSON参数，Result为执行结果
+type ChatToolCallDto struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result,omitempty"`
+}
+
+// ChatCitationDto 知识库中的片段，没有分页信息时页码为0
+type ChatCitationDto struct {
+	Index      int       `json:"index"`
+	DocumentId uuid.UUID `json:"documentId"`
+	FileName   string    `json:"fileName"`
+	PageStart  int       `json:"pageStart"`
+	PageEnd    int       `json:"pageEnd"`
+	Text       string    `json:"text"`
+	// Score 与问题的相似度（余弦）
+	Score float64 `json:"score"`
+}
+
+// ChatTruncationDto 本次请求省略的历史内容，保存的会话记录不受影响
+type ChatTruncationDto struct {
+	DroppedMessages int `json:"droppedMessages"`
+	DroppedImages   int `json:"droppedImages"`
+}
+
+type ChatModelListDto struct {
+	DefaultModel string   `json:"defaultModel"`
+	Models       []string `json:"models"`
+}
+
+// ChatStreamDeltaDto 流式回答的增量
+type ChatStreamDeltaDto struct {
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+	// Step 执行工具的轮数，从0开始，只有最后一轮的增量是回答
+	Step int `json:"step"`
+	// ToolCalls 该轮要求调用工具时，在该轮的最后返回执行的工具调用和结果，该轮之前返回的增量不是回答
+	ToolCalls []ChatToolCallDto `json:"toolCalls,omitempty"`
+}
+
+// ChatContext 由chat_message表中的消息按顺序重建的对话上下文
+type ChatContext struct {
+	ChatMessages []ChatMessage `json:"chatMessages"`
 }
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChatRole 对话消息的角色
+type ChatRole string
+
+const (
+	ChatRoleSystem    ChatRole = "system"
+	ChatRoleUser      ChatRole = "user"
+	ChatRoleAssistant ChatRole = "assistant"
+	ChatRoleTool      ChatRole = "tool"
+	ChatRoleFunction  ChatRole = "function"
+)
+
+const (
+	ChatMessageContentPartTypeText  = "text"
+	ChatMessageContentPartTypeImage = "image_url"
+	// ChatMessageContentPartTypeAudio 语音的识别结果，发送给模型服务时转为文本
+	ChatMessageContentPartTypeAudio = "audio"
+	// ChatMessageContentPartTypeImageOCR 图片和识别出的文字，发送给模型服务时只发送文字
+	ChatMessageContentPartTypeImageOCR = "image_ocr"
+	// ChatMessageContentPartTypeDocument 文档提取出的文字，发送给模型服务时每个片段转为一段带页码的文本
+	ChatMessageContentPartTypeDocument = "document"
+)
+
+// ChatMessage 与模型服务无关的对话消息
+// JSON格式与OpenAI的消息格式一致，可以直接读取以前保存的对话上下文
+type ChatMessage struct {
+	Role    ChatRole                 `json:"role"`
+	Content []ChatMessageContentPart `json:"content"`
+	// Timestamp 只保存在对话上下文中，不发送给模型服务
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// Model 生成回答的模型，只保存在对话上下文中
+	Model string `json:"model,omitempty"`
+	// ToolCalls 回答中要求调用的工具，只有助手消息有
+	ToolCalls []ChatMessageToolCall `json:"tool_calls,omitempty"`
+	// ToolCallId 工具消息对应的调用
+	ToolCallId string `json:"tool_call_id,omitempty"`
+	// Choices 请求多个候选回答时所有候选的内容，Content为选择的候选，只保存在会话记录中
+	Choices     [][]ChatMessageContentPart `json:"-"`
+	ChoiceIndex int                        `json:"-"`
+}
+
+// ChatMessageToolCallTypeFunction 工具调用的类型，目前只有函数
+const ChatMessageToolCallTypeFunction = "function"
+
+// ChatMessageToolCall 模型要求调用的工具，Arguments为模型生成的JSON参数
+type ChatMessageToolCall struct {
+	Id       string                  `json:"id"`
+	Type     string                  `json:"type"`
+	Function ChatMessageFunctionCall `json:"function"`
+}
+
+type ChatMessageFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ChatMessageContentPart struct {
+	Type     string               `json:"type"`
+	Text     string               `json:"text,omitempty"`
+	ImageURL *ChatMessageImageURL `json:"image_url,omitempty"`
+	Audio    *ChatMessageAudio    `json:"audio,omitempty"`
+	Document *ChatMessageDocument `json:"document,omitempty"`
+}
+
+type ChatMessageImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ChatMessageAudio 语音的格式，语音数据本身不保存
+type ChatMessageAudio struct {
+	MimeType string `json:"mime_type"`
+}
+
+// ChatMessageDocument 文档的信息和分割后的文字，文档本身不保存
+type ChatMessageDocument struct {
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	// Pages 文档的页数，没有分页信息时为0
+	Pages  int                        `json:"pages"`
+	Chunks []ChatMessageDocumentChunk `json:"chunks"`
+}
+
+// ChatMessageDocumentChunk 文档的片段，没有分页信息时页码为0
+type ChatMessageDocumentChunk struct {
+	PageStart int    `json:"page_start"`
+	PageEnd   int    `json:"page_end"`
+	Text      string `json:"text"`
+}
+
+// Header 片段的标题，包括文件名和页码
+func (document *ChatMessageDocument) Header(index int) string {
+	chunk := document.Chunks[index]
+	switch {
+	case chunk.PageStart == 0:
+		if len(document.Chunks) == 1 {
+			return fmt.Sprintf("【%s】", document.FileName)
+		}
+		return fmt.Sprintf("【%s 第%d/%d部分】", document.FileName, index+1, len(document.Chunks))
+	case chunk.PageStart == chunk.PageEnd:
+		return fmt.Sprintf("【%s 第%d页】", document.FileName, chunk.PageStart)
+	default:
+		return fmt.Sprintf("【%s 第%d-%d页】", document.FileName, chunk.PageStart, chunk.PageEnd)
+	}
+}
+
+func NewChatMessageText(role ChatRole, text string) ChatMessage {
+	return ChatMessage{
+		Role:    role,
+		Content: []ChatMessageContentPart{NewChatMessageContentPartText(text)},
+	}
+}
+
+// NewChatMessageToolResult 工具的执行结果，toolCallId为对应调用的Id
+func NewChatMessageToolResult(toolCallId string, result string) ChatMessage {
+	message := NewChatMessageText(ChatRoleTool, result)
+	message.ToolCallId = toolCallId
+	return message
+}
+
+func NewChatMessageContentPartText(text string) ChatMessageContentPart {
+	return ChatMessageContentPart{
+		Type: ChatMessageContentPartTypeText,
+		Text: text,
+	}
+}
+
+func NewChatMessageContentPartImage(url string) ChatMessageContentPart {
+	return ChatMessageContentPart{
+		Type:     ChatMessageContentPartTypeImage,
+		ImageURL: &ChatMessageImageURL{URL: url},
+	}
+}
+
+// NewChatMessageContentPartAudio transcript为语音的识别结果
+func NewChatMessageContentPartAudio(transcript string, mimeType string) ChatMessageContentPart {
+	return ChatMessageContentPart{
+		Type:  ChatMessageContentPartTypeAudio,
+		Text:  transcript,
+		Audio: &ChatMessageAudio{MimeType: mimeType},
+	}
+}
+
+// NewChatMessageContentPartImageOCR text为图片中识别出的文字
+func NewChatMessageContentPartImageOCR(url string, text string) ChatMessageContentPart {
+	return ChatMessageContentPart{
+		Type:     ChatMessageContentPartTypeImageOCR,
+		Text:     text,
+		ImageURL: &ChatMessageImageURL{URL: url},
+	}
+}
+
+// NewChatMessageContentPartDocument document为提取并分割后的文档
+func NewChatMessageContentPartDocument(document ChatMessageDocument) ChatMessageContentPart {
+	return ChatMessageContentPart{
+		Type:     ChatMessageContentPartTypeDocument,
+		Document: &document,
+	}
+}
+
+// RequestContent 发送给模型服务的内容，只有文本和图片两种类型，语音、图片文字等其他类型转为文本
+func (chatMessage *ChatMessage) RequestContent() []ChatMessageContentPart {
+	contents := make([]ChatMessageContentPart, 0, len(chatMessage.Content))
+	for _, part := range chatMessage.Content {
+		switch part.Type {
+		case ChatMessageContentPartTypeText, ChatMessageContentPartTypeImage:
+			contents = append(contents, part)
+		case ChatMessageContentPartTypeDocument:
+			if part.Document == nil {
+				continue
+			}
+			for i, chunk := range part.Document.Chunks {
+				contents = append(contents, NewChatMessageContentPartText(part.Document.Header(i)+"\n"+chunk.Text))
+			}
+		default:
+			if part.Text != "" {
+				contents = append(contents, NewChatMessageContentPartText(part.Text))
+			}
+		}
+	}
+	return contents
+}
+
+// Text 拼接消息中所有文本部分，包括转为文本的语音等
+func (chatMessage *ChatMessage) Text() string {
+	var texts []string
+	for _, part := range chatMessage.RequestContent() {
+		if part.Type == ChatMessageContentPartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// MarshalJSON 用户消息的内容输出为数组，其他角色的内容输出为字符串
+func (chatMessage ChatMessage) MarshalJSON() ([]byte, error) {
+	type chatMessageAlias ChatMessage
+	var content any
+	if chatMessage.Role == ChatRoleUser {
+		content = chatMessage.Content
+	} else {
+		content = chatMessage.Text()
+	}
+	return json.Marshal(struct {
+		chatMessageAlias
+		Content any `json:"content"`
+	}{
+		chatMessageAlias: chatMessageAlias(chatMessage),
+		Content:          content,
+	})
+}
+
+// UnmarshalJSON 内容兼容字符串和数组两种格式
+func (chatMessage *ChatMessage) UnmarshalJSON(data []byte) error {
+	type chatMessageAlias ChatMessage
+	raw := struct {
+		*chatMessageAlias
+		Content json.RawMessage `json:"content"`
+	}{
+		chatMessageAlias: (*chatMessageAlias)(chatMessage),
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	chatMessage.Content = nil
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(raw.Content, &text); err == nil {
+		chatMessage.Content = []ChatMessageContentPart{NewChatMessageContentPartText(text)}
+		return nil
+	}
+	return json.Unmarshal(raw.Content, &chatMessage.Content)
+}
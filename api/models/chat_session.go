@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ChatSessionListInDto struct {
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type ChatSessionListOutDto struct {
+	Sessions []ChatSessionDto `json:"sessions"`
+	// NextCursor 为空时表示没有下一页
+	NextCursor string `json:"nextCursor"`
+}
+
+type ChatSessionDto struct {
+	SessionId       uuid.UUID `json:"sessionId"`
+	UserName        string    `json:"userName"`
+	Model           string    `json:"model"`
+	Title           string    `json:"title"`
+	Preview         string    `json:"preview"`
+	MessageCount    int       `json:"messageCount"`
+	CreateTimestamp time.Time `json:"createTimestamp"`
+	UpdateTimestamp time.Time `json:"updateTimestamp"`
+}
+
+type ChatSessionDetailDto struct {
+	ChatSessionDto
+	// KnowledgeBaseId 会话使用的知识库，没有时省略
+	KnowledgeBaseId *uuid.UUID       `json:"knowledgeBaseId,omitempty"`
+	Messages        []ChatMessageDto `json:"messages"`
+}
+
+// ChatMessageDto 与模型服务无关的对话消息，内容的类型与提问时的类型一致
+type ChatMessageDto struct {
+	Role      ChatRole             `json:"role"`
+	Contents  []ChatMessagePartDto `json:"contents"`
+	Timestamp *time.Time           `json:"timestamp"`
+	// Model 生成回答的模型，问题为空
+	Model string `json:"model,omitempty"`
+	// ToolCalls 回答中要求调用的工具，执行结果为之后role为tool的消息
+	ToolCalls []ChatToolCallDto `json:"toolCalls,omitempty"`
+	// ToolCallId 工具消息对应的调用
+	ToolCallId string `json:"toolCallId,omitempty"`
+	// Choices 有多个候选的回答返回所有候选的文本，ChoiceIndex为保存的候选的序号
+	Choices     []string `json:"choices,omitempty"`
+	ChoiceIndex int      `json:"choiceIndex,omitempty"`
+}
+
+type ChatMessagePartDto struct {
+	Type string `json:"type"`
+	// Text 文本，语音时为识别结果，ImageOCR时为识别出的文字
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"imageUrl,omitempty"`
+	// FileName和Pages 文档的文件名和页数，不返回文档的文字
+	FileName string `json:"fileName,omitempty"`
+	Pages    int    `json:"pages,omitempty"`
+}
+
+func NewChatMessageDto(chatMessage ChatMessage) ChatMessageDto {
+	chatMessageDto := ChatMessageDto{
+		Role:        chatMessage.Role,
+		Contents:    make([]ChatMessagePartDto, 0, len(chatMessage.Content)),
+		Timestamp:   chatMessage.Timestamp,
+		Model:       chatMessage.Model,
+		ToolCallId:  chatMessage.ToolCallId,
+		ChoiceIndex: chatMessage.ChoiceIndex,
+	}
+	for _, content := range chatMessage.Choices {
+		choice := ChatMessage{Role: chatMessage.Role, Content: content}
+		chatMessageDto.Choices = append(chatMessageDto.Choices, choice.Text())
+	}
+	for _, toolCall := range chatMessage.ToolCalls {
+		chatMessageDto.ToolCalls = append(chatMessageDto.ToolCalls, ChatToolCallDto{
+			Id:        toolCall.Id,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	for _, part := range chatMessage.Content {
+		switch part.Type {
+		case ChatMessageContentPartTypeText:
+			chatMessageDto.Contents = append(chatMessageDto.Contents, ChatMessagePartDto{
+				Type: "Text",
+				Text: part.Text,
+			})
+		case ChatMessageContentPartTypeImage:
+			if part.ImageURL == nil {
+				continue
+			}
+			chatMessageDto.Contents = append(chatMessageDto.Contents, ChatMessagePartDto{
+				Type:     "Image",
+				ImageUrl: part.ImageURL.URL,
+			})
+		case ChatMessageContentPartTypeAudio:
+			chatMessageDto.Contents = append(chatMessageDto.Contents, ChatMessagePartDto{
+				Type: "Audio",
+				Text: part.Text,
+			})
+		case ChatMessageContentPartTypeImageOCR:
+			partDto := ChatMessagePartDto{
+				Type: "ImageOCR",
+				Text: part.Text,
+			}
+			if part.ImageURL != nil {
+				partDto.ImageUrl = part.ImageURL.URL
+			}
+			chatMessageDto.Contents = append(chatMessageDto.Contents, partDto)
+		case ChatMessageContentPartTypeDocument:
+			if part.Document == nil {
+				continue
+			}
+			chatMessageDto.Contents = append(chatMessageDto.Contents, ChatMessagePartDto{
+				Type:     "Document",
+				FileName: part.Document.FileName,
+				Pages:    part.Document.Pages,
+			})
+		}
+	}
+	return chatMessageDto
+}
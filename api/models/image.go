@@ -0,0 +1,44 @@
+package models
+
+import (
+	"mime/multipart"
+	"strings"
+	"time"
+)
+
+// imageRefPrefix 对话上下文中上传图片的引用，发送给模型服务和返回给客户端时转为URL
+const imageRefPrefix = "image:"
+
+// ImageRef 返回上传图片的引用
+func ImageRef(imageId string) string {
+	return imageRefPrefix + imageId
+}
+
+// ParseImageRef url为上传图片的引用时返回图片ID
+func ParseImageRef(url string) (string, bool) {
+	return strings.CutPrefix(url, imageRefPrefix)
+}
+
+// ImageUploadInDto multipart上传时使用file，JSON请求时使用data
+type ImageUploadInDto struct {
+	File *multipart.FileHeader `json:"-" form:"file"`
+	// Data base64编码的图片数据或data URL
+	Data string `json:"data" form:"-"`
+}
+
+type ImageUploadOutDto struct {
+	// ImageId 图片内容的SHA-256，提问时以imageId引用
+	ImageId  string `json:"imageId"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+	// Url 带签名的短期URL，用于客户端显示
+	Url        string    `json:"url"`
+	ExpireTime time.Time `json:"expireTime"`
+}
+
+// ImageGetInDto 签名URL的参数
+type ImageGetInDto struct {
+	ImageId   string `uri:"imageId"`
+	Expires   int64  `form:"expires"`
+	Signature string `form:"signature"`
+}
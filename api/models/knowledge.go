@@ -0,0 +1,62 @@
+package models
+
+import (
+	"mime/multipart"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KnowledgeBaseDto 知识库，Shared的知识库所有用户都可以在对话中使用，只有管理员可以创建
+type KnowledgeBaseDto struct {
+	KnowledgeBaseId uuid.UUID `json:"knowledgeBaseId"`
+	UserName        string    `json:"userName"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Shared          bool      `json:"shared"`
+	// EmbeddingModel 创建时的向量模型，与当前配置不一致时需要重新创建
+	EmbeddingModel  string    `json:"embeddingModel"`
+	DocumentCount   int       `json:"documentCount"`
+	ChunkCount      int       `json:"chunkCount"`
+	CreateTimestamp time.Time `json:"createTimestamp"`
+	UpdateTimestamp time.Time `json:"updateTimestamp"`
+}
+
+type KnowledgeBaseListDto struct {
+	KnowledgeBases []KnowledgeBaseDto `json:"knowledgeBases"`
+}
+
+// KnowledgeDocumentUploadInDto multipart上传时使用file，JSON请求时使用data和fileName
+type KnowledgeDocumentUploadInDto struct {
+	KnowledgeBaseId string                `json:"knowledgeBaseId" form:"knowledgeBaseId"`
+	File            *multipart.FileHeader `json:"-" form:"file"`
+	// Data base64编码的文档数据或data URL
+	Data     string `json:"data" form:"-"`
+	FileName string `json:"fileName" form:"-"`
+}
+
+type KnowledgeDocumentDto struct {
+	DocumentId      uuid.UUID `json:"documentId"`
+	KnowledgeBaseId uuid.UUID `json:"knowledgeBaseId"`
+	FileName        string    `json:"fileName"`
+	MimeType        string    `json:"mimeType"`
+	Size            int64     `json:"size"`
+	// Pages 文档的页数，没有分页信息时为0
+	Pages           int       `json:"pages"`
+	ChunkCount      int       `json:"chunkCount"`
+	UserName        string    `json:"userName"`
+	CreateTimestamp time.Time `json:"createTimestamp"`
+}
+
+type KnowledgeDocumentListDto struct {
+	Documents []KnowledgeDocumentDto `json:"documents"`
+}
+
+type KnowledgeSearchInDto struct {
+	KnowledgeBaseId uuid.UUID `json:"knowledgeBaseId"`
+	Query           string    `json:"query"`
+}
+
+type KnowledgeSearchOutDto struct {
+	Citations []ChatCitationDto `json:"citations"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatParameters 模型的生成参数，省略的参数使用模型服务的默认值
+type ChatParameters struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"topP,omitempty"`
+	MaxTokens   *int32   `json:"maxTokens,omitempty"`
+}
+
+// PersonaDto 预设角色
+type PersonaDto struct {
+	PersonaId       uuid.UUID      `json:"personaId"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	SystemPrompt    string         `json:"systemPrompt"`
+	Model           string         `json:"model"`
+	Parameters      ChatParameters `json:"parameters"`
+	CreateTimestamp time.Time      `json:"createTimestamp"`
+	UpdateTimestamp time.Time      `json:"updateTimestamp"`
+}
+
+type PersonaListDto struct {
+	Personas []PersonaDto `json:"personas"`
+}
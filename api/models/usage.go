@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type QuotaDto struct {
+	Permission string        `json:"permission"`
+	Daily      QuotaUsageDto `json:"daily"`
+	Monthly    QuotaUsageDto `json:"monthly"`
+}
+
+// QuotaUsageDto 一个统计周期内的使用量，上限和剩余量为null时不限制
+type QuotaUsageDto struct {
+	MessageLimit     *int64    `json:"messageLimit"`
+	MessageUsed      int64     `json:"messageUsed"`
+	MessageRemaining *int64    `json:"messageRemaining"`
+	TokenLimit       *int64    `json:"tokenLimit"`
+	TokenUsed        int64     `json:"tokenUsed"`
+	TokenRemaining   *int64    `json:"tokenRemaining"`
+	ResetTime        time.Time `json:"resetTime"`
+}
+
+// UsageSummaryInDto 统计期间为本地日期（yyyy-MM-dd），省略时为最近30天
+// 管理员省略UserName时统计所有用户
+type UsageSummaryInDto struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	UserName string `json:"userName"`
+}
+
+type UsageSummaryOutDto struct {
+	From     string                `json:"from"`
+	To       string                `json:"to"`
+	UserName string                `json:"userName"`
+	Total    UsageSummaryItemDto   `json:"total"`
+	Days     []UsageSummaryItemDto `json:"days"`
+	Models   []UsageSummaryItemDto `json:"models"`
+}
+
+type UsageSummaryItemDto struct {
+	Date             string `json:"date,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"`
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
+	TotalTokens      int64  `json:"totalTokens"`
+	AverageLatencyMs int64  `json:"averageLatencyMs"`
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AudioService interface {
+	Transcribe(ctx *gin.Context, inDto models.AudioTranscribeInDto) *models.AudioTranscribeOutDto
+	// TranscribeContents 识别问题中的语音并设置识别结果，返回所有识别结果，出错时设置错误并返回false
+	// 按会话记录语音识别的使用量
+	TranscribeContents(ctx *gin.Context, sessionId uuid.UUID, contents []models.ChatQuestionContentPartsDto) ([]string, bool)
+}
+
+type audioService struct {
+	// transcriber 为nil时不支持语音
+	transcriber  Transcriber
+	usageService UsageService
+	language     string
+	maxBytes     int64
+}
+
+// audioMimeTypes 语音识别服务支持的格式
+var audioMimeTypes = []string{
+	"audio/mpeg",
+	"audio/wav",
+	"audio/ogg",
+	"application/ogg",
+	"audio/flac",
+	"audio/x-m4a",
+	"audio/mp4",
+	"video/mp4",
+	"audio/webm",
+	"video/webm",
+}
+
+func NewAudioService(transcriber Transcriber, usageService UsageService, audioConfig config.AudioConfig) AudioService {
+	service := &audioService{
+		transcriber:  transcriber,
+		usageService: usageService,
+		language:     audioConfig.Language,
+		maxBytes:     audioConfig.MaxBytes,
+	}
+	return service
+}
+
+func (service *audioService) Transcribe(ctx *gin.Context, inDto models.AudioTranscribeInDto) *models.AudioTranscribeOutDto {
+	var (
+		audio []byte
+		err   error
+	)
+	if inDto.File != nil {
+		audio, err = service.readFile(inDto)
+	} else {
+		audio, err = service.decode(inDto.Data)
+	}
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	// 不属于会话的识别以空会话ID记录使用量
+	mimeType, transcript, err := service.transcribe(ctx.Request.Context(), ctx.GetString("UserName"), uuid.Nil, audio)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	outDto := &models.AudioTranscribeOutDto{
+		MimeType:   mimeType,
+		Transcript: transcript,
+	}
+	return outDto
+}
+
+func (service *audioService) TranscribeContents(ctx *gin.Context, sessionId uuid.UUID, contents []models.ChatQuestionContentPartsDto) ([]string, bool) {
+	var transcripts []string
+	for _, content := range contents {
+		audioContent, ok := content.(*models.ChatQuestionContentPartsDtoAudio)
+		if !ok {
+			continue
+		}
+		audio, err := service.decode(audioContent.AudioData())
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil, false
+		}
+		audioContent.MimeType, audioContent.Transcript, err = service.transcribe(ctx.Request.Context(), ctx.GetString("UserName"), sessionId, audio)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil, false
+		}
+		transcripts = append(transcripts, audioContent.Transcript)
+	}
+	return transcripts, true
+}
+
+// readFile 读取multipart上传的语音文件
+func (service *audioService) readFile(inDto models.AudioTranscribeInDto) ([]byte, error) {
+	if inDto.File.Size > service.maxBytes {
+		return nil, service.mediaError(errMediaTooLarge)
+	}
+	file, err := inDto.File.Open()
+	if err != nil {
+		return nil, service.mediaError(errMediaFormat)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	audio, err := readMedia(file, service.maxBytes)
+	if err != nil {
+		return nil, service.mediaError(err)
+	}
+	return audio, nil
+}
+
+// decode 解码base64编码的语音数据，兼容data URL
+func (service *audioService) decode(data string) ([]byte, error) {
+	audio, err := decodeMediaData(data, service.maxBytes)
+	if err != nil {
+		return nil, service.mediaError(err)
+	}
+	return audio, nil
+}
+
+// transcribe 按内容检测语音格式并识别，返回检测到的格式和识别结果
+func (service *audioService) transcribe(ctx context.Context, userName string, sessionId uuid.UUID, audio []byte) (string, string, error) {
+	if service.transcriber == nil {
+		return "", "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAD01",
+			MessageText: "未启用语音识别。",
+		}
+	}
+
+	mime := mimetype.Detect(audio)
+	supported := false
+	for _, mimeType := range audioMimeTypes {
+		if mime.Is(mimeType) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return "", "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAD03",
+			MessageText: fmt.Sprintf("不支持的语音格式：%s。", mime.String()),
+		}
+	}
+
+	startTime := time.Now()
+	transcript, err := service.transcriber.Transcribe(ctx, TranscriptionRequest{
+		Audio:    audio,
+		FileName: "audio" + mime.Extension(),
+		MimeType: mime.String(),
+		Language: service.language,
+	})
+
+	// 与回答一样记录使用量，失败的调用也记录，记录失败不影响识别
+	// 语音识别服务不返回token数，按识别结果的长度估算
+	tokens := estimateTextTokens(transcript)
+	record := UsageRecord{
+		UserName:  userName,
+		SessionId: sessionId,
+		Kind:      UsageKindTranscription,
+		Model:     service.transcriber.Model(),
+		Usage:     ChatCompletionsUsage{CompletionTokens: tokens, TotalTokens: tokens},
+		Latency:   time.Since(startTime),
+	}
+	if err != nil {
+		record.ErrorCode = "EAD05"
+	}
+	_ = service.usageService.RecordUsage(record)
+
+	if err != nil {
+		return "", "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAD05",
+			MessageText: "语音识别失败，请联系管理员。",
+		}
+	}
+	transcript = strings.TrimSpace(transcript)
+	if transcript == "" {
+		return "", "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAD06",
+			MessageText: "没有识别到语音内容。",
+		}
+	}
+	return mime.String(), transcript, nil
+}
+
+// mediaError 将读取数据的错误转为EAD02或EAD04
+func (service *audioService) mediaError(err error) error {
+	if errors.Is(err, errMediaTooLarge) {
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAD04",
+			MessageText: fmt.Sprintf("语音不能超过%s。", formatBytes(service.maxBytes)),
+		}
+	}
+	return &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EAD02",
+		MessageText: "语音数据格式错误。",
+	}
+}
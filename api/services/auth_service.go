@@ -2,70 +2,316 @@ package services
 
 import (
 	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
 	"LaoQGChat/internal/myerrors"
+	"LaoQGChat/internal/passwords"
+	"LaoQGChat/internal/tokens"
 	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
+// 最后请求时间的更新间隔，降低每次请求写入数据库的频率
+const lastSeenInterval = time.Minute
+
+// 用户名只能包含字母、数字、下划线、连字符和点，3到32个字符
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{3,32}$`)
+
 type AuthService interface {
 	Login(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto
-	Check(loginToken uuid.UUID) (*models.AuthDto, error)
+	Register(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto
+	ChangePassword(ctx *gin.Context, inDto models.ChangePasswordDto) *models.AuthDto
+	DeleteAccount(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto
+	Logout(ctx *gin.Context) *models.AuthDto
+	ListDevices(ctx *gin.Context) *models.DeviceListDto
+	RevokeDevice(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto
+	Refresh(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto
+	Check(loginToken string) (*models.AuthDto, error)
+	Close() error
 }
 
 type authService struct {
+	hasher          *passwords.Hasher
+	passwordPolicy  passwords.Policy
+	accessTokenTTL  time.Duration
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+
+	// jwt模式的签名和吊销列表，opaque模式时为nil
+	signer      *tokens.Signer
+	revocations *tokens.RevocationList
+	stopSync    chan struct{}
+	syncDone    chan struct{}
+
 	getUserInfo           *sql.Stmt
-	updateLoginStatus     *sql.Stmt
+	insertAccount         *sql.Stmt
+	updatePassword        *sql.Stmt
+	deleteAccount         *sql.Stmt
+	insertLoginStatus     *sql.Stmt
 	getLoginStatusByToken *sql.Stmt
+	getLoginStatusByUser  *sql.Stmt
+	deleteLoginStatus     *sql.Stmt
+	deleteOtherDevices    *sql.Stmt
+	deleteExpiredDevices  *sql.Stmt
+	updateLastSeen        *sql.Stmt
+	updateLoginToken      *sql.Stmt
+	insertRefreshToken    *sql.Stmt
+	getRefreshToken       *sql.Stmt
+	useRefreshToken       *sql.Stmt
+	revokeDevice          *sql.Stmt
+	revokeOtherDevices    *sql.Stmt
+	getRevokedTokens      *sql.Stmt
+	deleteRevokedTokens   *sql.Stmt
 }
 
-func NewAuthService(db *sql.DB) AuthService {
+func NewAuthService(db *sql.DB, authConfig config.AuthConfig) AuthService {
 	var (
 		err                   error
+		hasher                *passwords.Hasher
 		getUserInfo           *sql.Stmt
-		updateLoginStatus     *sql.Stmt
+		insertAccount         *sql.Stmt
+		updatePassword        *sql.Stmt
+		deleteAccount         *sql.Stmt
+		insertLoginStatus     *sql.Stmt
 		getLoginStatusByToken *sql.Stmt
+		getLoginStatusByUser  *sql.Stmt
+		deleteLoginStatus     *sql.Stmt
+		deleteOtherDevices    *sql.Stmt
+		deleteExpiredDevices  *sql.Stmt
+		updateLastSeen        *sql.Stmt
+		updateLoginToken      *sql.Stmt
+		insertRefreshToken    *sql.Stmt
+		getRefreshToken       *sql.Stmt
+		useRefreshToken       *sql.Stmt
+		revokeDevice          *sql.Stmt
+		revokeOtherDevices    *sql.Stmt
+		getRevokedTokens      *sql.Stmt
+		deleteRevokedTokens   *sql.Stmt
 	)
+	hasher, err = passwords.NewHasher(authConfig.BcryptCost)
+	if err != nil {
+		return nil
+	}
 	getUserInfo, err = db.Prepare(
 		"SELECT password, permission FROM account WHERE user_name = $1")
 	if err != nil {
 		return nil
 	}
-	updateLoginStatus, err = db.Prepare(`
-		INSERT INTO login_record (user_name, last_login_time, login_token)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_name)
-		DO UPDATE SET
-		    last_login_time = $2, login_token = $3`)
+	// 权限使用表定义的默认值normal
+	insertAccount, err = db.Prepare(`
+		INSERT INTO account (user_name, password)
+		VALUES ($1, $2)
+		ON CONFLICT (user_name) DO NOTHING`)
+	if err != nil {
+		return nil
+	}
+	// 密码未被其他请求修改时才更新
+	updatePassword, err = db.Prepare(
+		"UPDATE account SET password = $2 WHERE user_name = $1 AND password = $3")
+	if err != nil {
+		return nil
+	}
+	// 同时删除用户的对话记录、登录记录和知识库（文档和片段级联删除）
+	// 删除用户上传过图片的记录，之后注册相同用户名的用户不能引用这些图片
+	// 图片按内容去重，可能被其他用户引用，使用量用于统计，只将用户名清除为空字符串（不能注册），避免之后注册相同用户名的用户成为所有者
+	// 在其他用户的知识库中上传的文档同样只清除用户名
+	deleteAccount, err = db.Prepare(`
+		WITH deleted_chat_record AS (
+		    DELETE FROM chat_record WHERE user_name = $1
+		), deleted_login_record AS (
+		    DELETE FROM login_record WHERE user_name = $1
+		), deleted_knowledge_base AS (
+		    DELETE FROM knowledge_base WHERE user_name = $1
+		), anonymized_knowledge_document AS (
+		    UPDATE knowledge_document SET user_name = ''
+		    WHERE user_name = $1
+		      AND knowledge_base_id NOT IN (SELECT knowledge_base_id FROM knowledge_base WHERE user_name = $1)
+		), deleted_image_user AS (
+		    DELETE FROM image_user WHERE user_name = $1
+		), anonymized_image AS (
+		    UPDATE image SET user_name = '' WHERE user_name = $1
+		), anonymized_usage_record AS (
+		    UPDATE usage_record SET user_name = '' WHERE user_name = $1
+		)
+		DELETE FROM account WHERE user_name = $1`)
+	if err != nil {
+		return nil
+	}
+	// 每次登录作为一台设备记录
+	insertLoginStatus, err = db.Prepare(`
+		INSERT INTO login_record
+		(login_token, device_id, user_name, device_name, client_version, ip_address, last_login_time, last_seen_time,
+		 token_expire_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8)`)
+	if err != nil {
+		return nil
+	}
+	getLoginStatusByToken, err = db.Prepare(`
+		SELECT user_name, device_id, last_login_time, last_seen_time, token_expire_time
+		FROM login_record
+		WHERE login_token = $1`)
+	if err != nil {
+		return nil
+	}
+	getLoginStatusByUser, err = db.Prepare(`
+		SELECT device_id, device_name, client_version, ip_address, last_login_time, last_seen_time
+		FROM login_record
+		WHERE user_name = $1
+		ORDER BY last_seen_time DESC`)
+	if err != nil {
+		return nil
+	}
+	deleteLoginStatus, err = db.Prepare(
+		"DELETE FROM login_record WHERE user_name = $1 AND device_id = $2")
+	if err != nil {
+		return nil
+	}
+	deleteOtherDevices, err = db.Prepare(
+		"DELETE FROM login_record WHERE user_name = $1 AND device_id <> $2")
+	if err != nil {
+		return nil
+	}
+	// 超过最长有效期或长时间没有请求的设备
+	deleteExpiredDevices, err = db.Prepare(
+		"DELETE FROM login_record WHERE user_name = $1 AND (last_login_time < $2 OR last_seen_time < $3)")
+	if err != nil {
+		return nil
+	}
+	updateLastSeen, err = db.Prepare(
+		"UPDATE login_record SET last_seen_time = $2 WHERE device_id = $1")
+	if err != nil {
+		return nil
+	}
+	updateLoginToken, err = db.Prepare(`
+		UPDATE login_record
+		SET login_token = $2, token_expire_time = $3, last_seen_time = $4
+		WHERE device_id = $1`)
+	if err != nil {
+		return nil
+	}
+	insertRefreshToken, err = db.Prepare(
+		"INSERT INTO refresh_token (refresh_token, device_id, expire_time) VALUES ($1, $2, $3)")
+	if err != nil {
+		return nil
+	}
+	getRefreshToken, err = db.Prepare(`
+		SELECT login_record.user_name, login_record.device_id, login_record.last_login_time,
+		       refresh_token.expire_time, refresh_token.used_time
+		FROM refresh_token
+		JOIN login_record ON login_record.device_id = refresh_token.device_id
+		WHERE refresh_token.refresh_token = $1`)
+	if err != nil {
+		return nil
+	}
+	// 刷新令牌只能使用一次，并发使用时只有一个请求能成功
+	useRefreshToken, err = db.Prepare(
+		"UPDATE refresh_token SET used_time = $2 WHERE refresh_token = $1 AND used_time IS NULL")
+	if err != nil {
+		return nil
+	}
+	revokeDevice, err = db.Prepare(`
+		INSERT INTO revoked_token (device_id, expire_time)
+		VALUES ($1, $2)
+		ON CONFLICT (device_id) DO UPDATE SET expire_time = EXCLUDED.expire_time
+		RETURNING device_id`)
+	if err != nil {
+		return nil
+	}
+	// $2为uuid.Nil时吊销用户的全部设备
+	revokeOtherDevices, err = db.Prepare(`
+		INSERT INTO revoked_token (device_id, expire_time)
+		SELECT device_id, $3 FROM login_record WHERE user_name = $1 AND device_id <> $2
+		ON CONFLICT (device_id) DO UPDATE SET expire_time = EXCLUDED.expire_time
+		RETURNING device_id`)
+	if err != nil {
+		return nil
+	}
+	getRevokedTokens, err = db.Prepare(
+		"SELECT device_id, expire_time FROM revoked_token WHERE expire_time > $1")
 	if err != nil {
 		return nil
 	}
-	getLoginStatusByToken, err = db.Prepare(
-		"SELECT user_name, last_login_time FROM login_record WHERE login_token = $1")
+	deleteRevokedTokens, err = db.Prepare(
+		"DELETE FROM revoked_token WHERE expire_time <= $1")
 	if err != nil {
 		return nil
 	}
 	service := &authService{
+		hasher: hasher,
+		passwordPolicy: passwords.Policy{
+			MinLength:     authConfig.PasswordMinLength,
+			RequireLetter: authConfig.PasswordRequireLetter,
+			RequireDigit:  authConfig.PasswordRequireDigit,
+		},
+		accessTokenTTL:        authConfig.AccessTokenTTL,
+		idleTimeout:           authConfig.IdleTimeout,
+		absoluteTimeout:       authConfig.AbsoluteTimeout,
 		getUserInfo:           getUserInfo,
-		updateLoginStatus:     updateLoginStatus,
+		insertAccount:         insertAccount,
+		updatePassword:        updatePassword,
+		deleteAccount:         deleteAccount,
+		insertLoginStatus:     insertLoginStatus,
 		getLoginStatusByToken: getLoginStatusByToken,
+		getLoginStatusByUser:  getLoginStatusByUser,
+		deleteLoginStatus:     deleteLoginStatus,
+		deleteOtherDevices:    deleteOtherDevices,
+		deleteExpiredDevices:  deleteExpiredDevices,
+		updateLastSeen:        updateLastSeen,
+		updateLoginToken:      updateLoginToken,
+		insertRefreshToken:    insertRefreshToken,
+		getRefreshToken:       getRefreshToken,
+		useRefreshToken:       useRefreshToken,
+		revokeDevice:          revokeDevice,
+		revokeOtherDevices:    revokeOtherDevices,
+		getRevokedTokens:      getRevokedTokens,
+		deleteRevokedTokens:   deleteRevokedTokens,
+	}
+
+	// jwt模式启动时加载吊销列表，之后定期同步其他实例的吊销
+	if authConfig.TokenMode == "jwt" {
+		keys := make(map[string][]byte, len(authConfig.SigningKeys))
+		for _, key := range authConfig.SigningKeys {
+			keys[key.ID] = []byte(key.Secret)
+		}
+		service.signer, err = tokens.NewSigner(keys, authConfig.SigningKeyID)
+		if err != nil {
+			return nil
+		}
+		service.revocations = tokens.NewRevocationList()
+		if err = service.syncRevocations(); err != nil {
+			return nil
+		}
+		service.stopSync = make(chan struct{})
+		service.syncDone = make(chan struct{})
+		go service.syncRevocationsLoop(authConfig.RevocationSyncInterval)
 	}
 	return service
 }
 
 func (service *authService) Login(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto {
 	var (
-		err         error
-		password    string
-		permission  string
-		currentTime = time.Now()
-		loginToken  = uuid.New()
+		err             error
+		password        string
+		permission      string
+		currentTime     = time.Now()
+		loginToken      = uuid.New()
+		tokenExpireTime = currentTime.Add(service.accessTokenTTL)
+		deviceId        = uuid.New()
+		refreshToken    uuid.UUID
 	)
 	err = service.getUserInfo.QueryRow(inDto.Username).Scan(&password, &permission)
-	if err != nil || password != inDto.Password {
+	if err != nil {
+		service.hasher.VerifyDummy(inDto.Password)
+	}
+	verified, needsRehash := service.hasher.Verify(password, inDto.Password)
+	if err != nil || !verified {
 		err = &myerrors.CustomError{
 			StatusCode:  200,
 			MessageCode: "EAU00",
@@ -74,29 +320,573 @@ func (service *authService) Login(ctx *gin.Context, inDto models.AuthDto) *model
 		_ = ctx.Error(err)
 		return nil
 	}
-	_, err = service.updateLoginStatus.Exec(inDto.Username, currentTime, loginToken)
+
+	// 旧的明文密码或哈希强度变更时重新生成哈希值，失败时不影响登录
+	if needsRehash {
+		if passwordHash, err := service.hasher.Hash(inDto.Password); err == nil {
+			_, _ = service.updatePassword.Exec(inDto.Username, passwordHash, password)
+		}
+	}
+
+	// 清理已超时的设备
+	_, err = service.deleteExpiredDevices.Exec(inDto.Username,
+		currentTime.Add(-service.absoluteTimeout), currentTime.Add(-service.idleTimeout))
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	_, err = service.insertLoginStatus.Exec(loginToken, deviceId, inDto.Username,
+		inDto.DeviceName, ctx.GetHeader("Version"), ctx.ClientIP(), currentTime, tokenExpireTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	refreshToken, err = service.newRefreshToken(deviceId, currentTime, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	accessToken, err := service.accessToken(inDto.Username, permission, deviceId, loginToken, tokenExpireTime)
 	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
 	outDto := &models.AuthDto{
-		LoginToken: loginToken,
-		Permission: permission,
+		Username:        inDto.Username,
+		LoginToken:      accessToken,
+		RefreshToken:    refreshToken,
+		TokenExpireTime: &tokenExpireTime,
+		Permission:      permission,
+		DeviceId:        deviceId,
+		DeviceName:      inDto.DeviceName,
 	}
 	return outDto
 }
 
-func (service *authService) Check(loginToken uuid.UUID) (*models.AuthDto, error) {
+func (service *authService) Register(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto {
 	var (
-		err           error
-		userName      string
-		password      string
-		permission    string
-		currentTime   = time.Now()
-		lastLoginTime time.Time
+		err          error
+		result       sql.Result
+		rowsAffected int64
+		passwordHash string
 	)
+	if !userNamePattern.MatchString(inDto.Username) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU05",
+			MessageText: "用户名只能包含字母、数字、下划线、连字符和点，长度为3到32个字符。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if !service.checkPasswordPolicy(ctx, inDto.Password) {
+		return nil
+	}
+
+	passwordHash, err = service.hasher.Hash(inDto.Password)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	result, err = service.insertAccount.Exec(inDto.Username, passwordHash)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU04",
+			MessageText: "用户名已被使用。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	outDto := &models.AuthDto{
+		Username:   inDto.Username,
+		Permission: "normal",
+	}
+	return outDto
+}
+
+func (service *authService) ChangePassword(ctx *gin.Context, inDto models.ChangePasswordDto) *models.AuthDto {
+	var (
+		userName     = ctx.GetString("UserName")
+		deviceId     = ctx.MustGet("DeviceId").(uuid.UUID)
+		err          error
+		result       sql.Result
+		rowsAffected int64
+		password     string
+		passwordHash string
+	)
+	password = service.verifyPassword(ctx, userName, inDto.Password)
+	if password == "" {
+		return nil
+	}
+	if !service.checkPasswordPolicy(ctx, inDto.NewPassword) {
+		return nil
+	}
+
+	passwordHash, err = service.hasher.Hash(inDto.NewPassword)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	result, err = service.updatePassword.Exec(userName, passwordHash, password)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		// 验证密码后密码已被其他请求修改
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU07",
+			MessageText: "密码错误。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	// 修改密码后其他设备需要重新登录
+	err = service.revokeTokens(service.revokeOtherDevices, userName, deviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	_, err = service.deleteOtherDevices.Exec(userName, deviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *authService) DeleteAccount(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto {
+	var (
+		userName = ctx.GetString("UserName")
+		err      error
+	)
+	if service.verifyPassword(ctx, userName, inDto.Password) == "" {
+		return nil
+	}
+
+	err = service.revokeTokens(service.revokeOtherDevices, userName, uuid.Nil)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	_, err = service.deleteAccount.Exec(userName)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *authService) Logout(ctx *gin.Context) *models.AuthDto {
+	var (
+		userName = ctx.GetString("UserName")
+		deviceId = ctx.MustGet("DeviceId").(uuid.UUID)
+		err      error
+	)
+	_, err = service.deleteLoginStatus.Exec(userName, deviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	err = service.revokeTokens(service.revokeDevice, deviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *authService) ListDevices(ctx *gin.Context) *models.DeviceListDto {
+	var (
+		userName = ctx.GetString("UserName")
+		deviceId = ctx.MustGet("DeviceId").(uuid.UUID)
+		err      error
+		rows     *sql.Rows
+		outDto   = &models.DeviceListDto{Devices: make([]models.DeviceDto, 0)}
+	)
+	rows, err = service.getLoginStatusByUser.Query(userName)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var device models.DeviceDto
+		err = rows.Scan(&device.DeviceId, &device.DeviceName, &device.ClientVersion, &device.IpAddress,
+			&device.LoginTime, &device.LastSeenTime)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		device.Current = device.DeviceId == deviceId
+		outDto.Devices = append(outDto.Devices, device)
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+func (service *authService) RevokeDevice(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto {
+	var (
+		userName     = ctx.GetString("UserName")
+		err          error
+		result       sql.Result
+		rowsAffected int64
+	)
+	result, err = service.deleteLoginStatus.Exec(userName, inDto.DeviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU08",
+			MessageText: "该设备不存在或已退出登录。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	err = service.revokeTokens(service.revokeDevice, inDto.DeviceId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *authService) Refresh(ctx *gin.Context, inDto models.AuthDto) *models.AuthDto {
+	var (
+		err             error
+		result          sql.Result
+		rowsAffected    int64
+		userName        string
+		password        string
+		permission      string
+		deviceId        uuid.UUID
+		lastLoginTime   time.Time
+		expireTime      time.Time
+		usedTime        sql.NullTime
+		currentTime     = time.Now()
+		loginToken      = uuid.New()
+		tokenExpireTime = currentTime.Add(service.accessTokenTTL)
+		refreshToken    uuid.UUID
+	)
+	err = service.getRefreshToken.QueryRow(inDto.RefreshToken).Scan(
+		&userName, &deviceId, &lastLoginTime, &expireTime, &usedTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU10",
+			MessageText: "刷新令牌无效，请重新登录。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if usedTime.Valid {
+		service.revokeReusedRefreshToken(ctx, userName, deviceId)
+		return nil
+	}
+	if !currentTime.Before(expireTime) || currentTime.Sub(lastLoginTime) >= service.absoluteTimeout {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU02",
+			MessageText: "登录已超时，请重新登录。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	result, err = service.useRefreshToken.Exec(inDto.RefreshToken, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		// 查询后被其他请求使用
+		service.revokeReusedRefreshToken(ctx, userName, deviceId)
+		return nil
+	}
+
+	err = service.getUserInfo.QueryRow(userName).Scan(&password, &permission)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU03",
+			MessageText: "用户已注销。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	_, err = service.updateLoginToken.Exec(deviceId, loginToken, tokenExpireTime, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	refreshToken, err = service.newRefreshToken(deviceId, lastLoginTime, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	accessToken, err := service.accessToken(userName, permission, deviceId, loginToken, tokenExpireTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	outDto := &models.AuthDto{
+		Username:        userName,
+		LoginToken:      accessToken,
+		RefreshToken:    refreshToken,
+		TokenExpireTime: &tokenExpireTime,
+		Permission:      permission,
+		DeviceId:        deviceId,
+	}
+	return outDto
+}
+
+// newRefreshToken 为设备生成新的刷新令牌，有效期不超过空闲超时和最长有效期
+func (service *authService) newRefreshToken(deviceId uuid.UUID, lastLoginTime time.Time, currentTime time.Time) (uuid.UUID, error) {
+	refreshToken := uuid.New()
+	expireTime := currentTime.Add(service.idleTimeout)
+	if absoluteExpireTime := lastLoginTime.Add(service.absoluteTimeout); absoluteExpireTime.Before(expireTime) {
+		expireTime = absoluteExpireTime
+	}
+	if _, err := service.insertRefreshToken.Exec(refreshToken, deviceId, expireTime); err != nil {
+		return uuid.Nil, err
+	}
+	return refreshToken, nil
+}
+
+// revokeReusedRefreshToken 已使用过的刷新令牌再次被使用时，令牌可能已经泄露，强制该设备退出登录并设置EAU11
+func (service *authService) revokeReusedRefreshToken(ctx *gin.Context, userName string, deviceId uuid.UUID) {
+	if _, err := service.deleteLoginStatus.Exec(userName, deviceId); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	if err := service.revokeTokens(service.revokeDevice, deviceId); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	err := &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EAU11",
+		MessageText: "刷新令牌已被使用过，为保护账号安全该设备已退出登录，请重新登录。",
+	}
+	_ = ctx.Error(err)
+}
+
+// accessToken opaque模式直接使用登录记录的令牌，jwt模式签发包含用户信息的签名令牌
+func (service *authService) accessToken(userName string, permission string, deviceId uuid.UUID,
+	loginToken uuid.UUID, tokenExpireTime time.Time) (string, error) {
+	if service.signer == nil {
+		return loginToken.String(), nil
+	}
+	return service.signer.Sign(tokens.Claims{
+		Permission: permission,
+		DeviceId:   deviceId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        loginToken.String(),
+			Subject:   userName,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(tokenExpireTime),
+		},
+	})
+}
+
+// revokeTokens jwt模式下将设备加入吊销列表，直到吊销前签发的访问令牌全部过期
+// opaque模式删除登录记录后令牌即失效，不需要吊销
+func (service *authService) revokeTokens(stmt *sql.Stmt, args ...any) error {
+	if service.signer == nil {
+		return nil
+	}
+	expireTime := time.Now().Add(service.accessTokenTTL)
+	rows, err := stmt.Query(append(args, expireTime)...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var deviceId uuid.UUID
+		if err = rows.Scan(&deviceId); err != nil {
+			return err
+		}
+		service.revocations.Add(deviceId, expireTime)
+	}
+	return rows.Err()
+}
+
+// syncRevocations 从数据库同步吊销列表并清理已失效的记录
+func (service *authService) syncRevocations() error {
+	currentTime := time.Now()
+	rows, err := service.getRevokedTokens.Query(currentTime)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	entries := make(map[uuid.UUID]time.Time)
+	for rows.Next() {
+		var (
+			deviceId   uuid.UUID
+			expireTime time.Time
+		)
+		if err = rows.Scan(&deviceId, &expireTime); err != nil {
+			return err
+		}
+		entries[deviceId] = expireTime
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	service.revocations.Merge(entries, currentTime)
+	_, err = service.deleteRevokedTokens.Exec(currentTime)
+	return err
+}
+
+func (service *authService) syncRevocationsLoop(interval time.Duration) {
+	defer close(service.syncDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// 只在同步状态变化时记录日志，数据库不可用时不会每次都输出
+	failing := false
+	for {
+		select {
+		case <-service.stopSync:
+			return
+		case <-ticker.C:
+			err := service.syncRevocations()
+			switch {
+			case err != nil && !failing:
+				fmt.Println("吊销列表同步失败，恢复前不再重复记录：", err)
+			case err == nil && failing:
+				fmt.Println("吊销列表同步已恢复")
+			}
+			failing = err != nil
+		}
+	}
+}
+
+// verifyPassword 验证当前用户的密码，返回保存的密码，验证失败时设置EAU07并返回空字符串
+func (service *authService) verifyPassword(ctx *gin.Context, userName string, password string) string {
+	var (
+		err        error
+		stored     string
+		permission string
+	)
+	err = service.getUserInfo.QueryRow(userName).Scan(&stored, &permission)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU03",
+			MessageText: "用户已注销。",
+		}
+		_ = ctx.Error(err)
+		return ""
+	}
+	if verified, _ := service.hasher.Verify(stored, password); !verified {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU07",
+			MessageText: "密码错误。",
+		}
+		_ = ctx.Error(err)
+		return ""
+	}
+	return stored
+}
+
+// checkPasswordPolicy 检查密码是否符合规则，不符合时设置EAU06
+func (service *authService) checkPasswordPolicy(ctx *gin.Context, password string) bool {
+	if service.passwordPolicy.Validate(password) {
+		return true
+	}
+	message := fmt.Sprintf("密码长度至少为%d个字符", service.passwordPolicy.MinLength)
+	if service.passwordPolicy.RequireLetter {
+		message += "，必须包含字母"
+	}
+	if service.passwordPolicy.RequireDigit {
+		message += "，必须包含数字"
+	}
+	err := &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EAU06",
+		MessageText: message + "。",
+	}
+	_ = ctx.Error(err)
+	return false
+}
+
+func (service *authService) Check(accessToken string) (*models.AuthDto, error) {
+	if service.signer != nil {
+		return service.checkSigned(accessToken)
+	}
+
+	var (
+		err             error
+		userName        string
+		password        string
+		permission      string
+		currentTime     = time.Now()
+		lastLoginTime   time.Time
+		lastSeenTime    time.Time
+		tokenExpireTime time.Time
+		deviceId        uuid.UUID
+		loginToken      uuid.UUID
+	)
+	loginToken, err = uuid.Parse(accessToken)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU01",
+			MessageText: "用户未登录。",
+		}
+		return nil, err
+	}
 	// 用户存在check
-	err = service.getLoginStatusByToken.QueryRow(loginToken).Scan(&userName, &lastLoginTime)
+	err = service.getLoginStatusByToken.QueryRow(loginToken).Scan(
+		&userName, &deviceId, &lastLoginTime, &lastSeenTime, &tokenExpireTime)
 	if err != nil {
 		err = &myerrors.CustomError{
 			StatusCode:  200,
@@ -105,7 +895,8 @@ func (service *authService) Check(loginToken uuid.UUID) (*models.AuthDto, error)
 		}
 		return nil, err
 	}
-	if currentTime.Sub(lastLoginTime).Hours() >= 24 {
+	// 空闲超时和最长有效期
+	if currentTime.Sub(lastSeenTime) >= service.idleTimeout || currentTime.Sub(lastLoginTime) >= service.absoluteTimeout {
 		err = &myerrors.CustomError{
 			StatusCode:  200,
 			MessageCode: "EAU02",
@@ -113,6 +904,15 @@ func (service *authService) Check(loginToken uuid.UUID) (*models.AuthDto, error)
 		}
 		return nil, err
 	}
+	// 访问令牌过期时客户端使用刷新令牌换取新的访问令牌
+	if !currentTime.Before(tokenExpireTime) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU09",
+			MessageText: "登录令牌已过期，请刷新令牌。",
+		}
+		return nil, err
+	}
 	err = service.getUserInfo.QueryRow(userName).Scan(&password, &permission)
 	if err != nil {
 		err = &myerrors.CustomError{
@@ -123,9 +923,74 @@ func (service *authService) Check(loginToken uuid.UUID) (*models.AuthDto, error)
 		return nil, err
 	}
 
+	// 记录最后请求时间，更新失败不影响本次请求
+	if currentTime.Sub(lastSeenTime) >= lastSeenInterval {
+		_, _ = service.updateLastSeen.Exec(deviceId, currentTime)
+	}
+
 	outDto := &models.AuthDto{
-		LoginToken: loginToken,
+		Username:   userName,
+		LoginToken: accessToken,
 		Permission: permission,
+		DeviceId:   deviceId,
 	}
 	return outDto, nil
 }
+
+// checkSigned jwt模式只验证签名、有效期和吊销列表，不查询数据库
+// 空闲超时和最长有效期在刷新令牌时检查
+func (service *authService) checkSigned(accessToken string) (*models.AuthDto, error) {
+	claims, err := service.signer.Parse(accessToken)
+	if errors.Is(err, tokens.ErrExpired) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU09",
+			MessageText: "登录令牌已过期，请刷新令牌。",
+		}
+		return nil, err
+	}
+	if err != nil || service.revocations.Contains(claims.DeviceId, time.Now()) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EAU01",
+			MessageText: "用户未登录。",
+		}
+		return nil, err
+	}
+
+	outDto := &models.AuthDto{
+		Username:   claims.Subject,
+		LoginToken: accessToken,
+		Permission: claims.Permission,
+		DeviceId:   claims.DeviceId,
+	}
+	return outDto, nil
+}
+
+func (service *authService) Close() error {
+	if service.stopSync != nil {
+		close(service.stopSync)
+		<-service.syncDone
+	}
+	return errors.Join(
+		service.getUserInfo.Close(),
+		service.insertAccount.Close(),
+		service.updatePassword.Close(),
+		service.deleteAccount.Close(),
+		service.insertLoginStatus.Close(),
+		service.getLoginStatusByToken.Close(),
+		service.getLoginStatusByUser.Close(),
+		service.deleteLoginStatus.Close(),
+		service.deleteOtherDevices.Close(),
+		service.deleteExpiredDevices.Close(),
+		service.updateLastSeen.Close(),
+		service.updateLoginToken.Close(),
+		service.insertRefreshToken.Close(),
+		service.getRefreshToken.Close(),
+		service.useRefreshToken.Close(),
+		service.revokeDevice.Close(),
+		service.revokeOtherDevices.Close(),
+		service.getRevokedTokens.Close(),
+		service.deleteRevokedTokens.Close(),
+	)
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// BlobStore 按键保存二进制数据，屏蔽不同存储的差异
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 键不存在时返回fs.ErrNotExist
+	Get(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// NewBlobStore 根据配置创建存储
+func NewBlobStore(imagesConfig config.ImagesConfig) (BlobStore, error) {
+	switch imagesConfig.Store {
+	case "local":
+		if err := os.MkdirAll(imagesConfig.Dir, 0o750); err != nil {
+			return nil, err
+		}
+		return &localBlobStore{dir: imagesConfig.Dir}, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储：%s", imagesConfig.Store)
+	}
+}
+
+// localBlobStore 本地文件系统，按键的前4个字符分两级目录保存
+type localBlobStore struct {
+	dir string
+}
+
+func (store *localBlobStore) path(key string) string {
+	if len(key) < 4 {
+		return filepath.Join(store.dir, key)
+	}
+	return filepath.Join(store.dir, key[:2], key[2:4], key)
+}
+
+func (store *localBlobStore) Put(_ context.Context, key string, data []byte) error {
+	path := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// 先写入临时文件再重命名，读取时不会读到写了一半的文件
+	file, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+func (store *localBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(store.path(key))
+}
+
+func (store *localBlobStore) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(store.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"slices"
+)
+
+const (
+	// 每条消息的角色和分隔符占用的token数
+	messageOverheadTokens = 4
+	// 图片的token数，low为低精度，其他按1024x1024的高精度图片估算
+	imageLowDetailTokens  = 85
+	imageHighDetailTokens = 765
+)
+
+// fitContext 在token预算内构建发送给模型服务的消息，返回省略的内容，预算不足以发送系统消息和最后一条消息时返回false
+// 保留所有系统消息和最后一条消息（本次的问题），超出预算时先将较早的用户消息中的图片替换为文字，再从最早的一轮对话开始省略
+// 不修改传入的消息
+func fitContext(messages []models.ChatMessage, budget int) ([]models.ChatMessage, *models.ChatTruncationDto, bool) {
+	total := 0
+	tokens := make([]int, len(messages))
+	for i, message := range messages {
+		tokens[i] = estimateMessageTokens(message)
+		total += tokens[i]
+	}
+	if total <= budget {
+		return messages, nil, true
+	}
+
+	var (
+		fitted     = slices.Clone(messages)
+		truncation = new(models.ChatTruncationDto)
+		last       = len(fitted) - 1
+	)
+
+	// 替换较早消息中的图片
+	for i := 0; i < last && total > budget; i++ {
+		if fitted[i].Role != models.ChatRoleUser {
+			continue
+		}
+		message, dropped := withoutImages(fitted[i])
+		if dropped == 0 {
+			continue
+		}
+		fitted[i] = message
+		truncation.DroppedImages += dropped
+		total -= tokens[i]
+		tokens[i] = estimateMessageTokens(message)
+		total += tokens[i]
+	}
+
+	// 按轮省略，一轮为一条用户消息及其之后的回答
+	keep := make([]bool, len(fitted))
+	for i := range keep {
+		keep[i] = true
+	}
+	for i := 0; i < last && total > budget; i++ {
+		if fitted[i].Role == models.ChatRoleSystem {
+			continue
+		}
+		for {
+			keep[i] = false
+			total -= tokens[i]
+			truncation.DroppedMessages++
+			next := i + 1
+			if next >= last || fitted[next].Role == models.ChatRoleUser || fitted[next].Role == models.ChatRoleSystem {
+				break
+			}
+			i = next
+		}
+	}
+	if total > budget {
+		return nil, nil, false
+	}
+
+	result := make([]models.ChatMessage, 0, len(fitted)-truncation.DroppedMessages)
+	for i, message := range fitted {
+		if keep[i] {
+			result = append(result, message)
+		}
+	}
+	return result, truncation, true
+}
+
+// withoutImages 返回将图片替换为文字的消息和替换的图片数
+func withoutImages(message models.ChatMessage) (models.ChatMessage, int) {
+	var (
+		dropped  int
+		contents = make([]models.ChatMessageContentPart, 0, len(message.Content))
+	)
+	for _, part := range message.Content {
+		if part.Type == models.ChatMessageContentPartTypeImage {
+			part = models.NewChatMessageContentPartText("[图片]")
+			dropped++
+		}
+		contents = append(contents, part)
+	}
+	message.Content = contents
+	return message, dropped
+}
+
+// estimateMessageTokens 估算消息的token数
+func estimateMessageTokens(message models.ChatMessage) int {
+	tokens := messageOverheadTokens
+	for _, part := range message.RequestContent() {
+		switch part.Type {
+		case models.ChatMessageContentPartTypeText:
+			tokens += estimateTextTokens(part.Text)
+		case models.ChatMessageContentPartTypeImage:
+			if part.ImageURL != nil && part.ImageURL.Detail == "low" {
+				tokens += imageLowDetailTokens
+			} else {
+				tokens += imageHighDetailTokens
+			}
+		}
+	}
+	for _, toolCall := range message.ToolCalls {
+		tokens += estimateTextTokens(toolCall.Function.Name) + estimateTextTokens(toolCall.Function.Arguments)
+	}
+	return tokens
+}
+
+// estimateTextTokens 估算文本的token数，ASCII字符按4个字符1个token，其他字符（中文等）按1个字符1个token
+// 比实际的分词结果略多，避免超出上下文长度
+func estimateTextTokens(text string) int {
+	var ascii, others int
+	for _, r := range text {
+		if r < 0x80 {
+			ascii++
+		} else {
+			others++
+		}
+	}
+	return (ascii+3)/4 + others
+}
+
+// estimateUsage 估算一次调用的用量，用于模型服务没有返回用量的情况
+// 请求按发送的消息和工具定义估算，回答按所有候选估算
+func estimateUsage(request ChatCompletionsRequest, resp *ChatCompletionsResponse) ChatCompletionsUsage {
+	var usage ChatCompletionsUsage
+	for _, message := range request.Messages {
+		usage.PromptTokens += estimateMessageTokens(message)
+	}
+	for _, tool := range request.Tools {
+		usage.PromptTokens += estimateTextTokens(tool.Name) + estimateTextTokens(tool.Description) + estimateTextTokens(string(tool.Parameters))
+	}
+	for _, choice := range resp.Choices {
+		usage.CompletionTokens += estimateMessageTokens(choice.Message)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"reflect"
+	"testing"
+)
+
+func TestFitContext(t *testing.T) {
+	text := func(role models.ChatRole, text string) models.ChatMessage {
+		return models.NewChatMessageText(role, text)
+	}
+	withImage := func(message models.ChatMessage, detail string) models.ChatMessage {
+		image := models.NewChatMessageContentPartImage("https://example.com/a.png")
+		image.ImageURL.Detail = detail
+		message.Content = append(message.Content, image)
+		return message
+	}
+	// 每条消息5个token：4个token的开销加上"aaaa"
+	var (
+		system     = text(models.ChatRoleSystem, "aaaa")
+		user1      = text(models.ChatRoleUser, "aaaa")
+		assistant1 = text(models.ChatRoleAssistant, "aaaa")
+		user2      = text(models.ChatRoleUser, "aaaa")
+		assistant2 = text(models.ChatRoleAssistant, "aaaa")
+		question   = text(models.ChatRoleUser, "aaaa")
+		toolCall   = models.ChatMessage{
+			Role: models.ChatRoleAssistant,
+			ToolCalls: []models.ChatMessageToolCall{{
+				Id:       "call_1",
+				Type:     models.ChatMessageToolCallTypeFunction,
+				Function: models.ChatMessageFunctionCall{Name: "f", Arguments: "{}"},
+			}},
+		}
+		toolResult    = models.NewChatMessageToolResult("call_1", "aaaa")
+		conversation  = []models.ChatMessage{system, user1, assistant1, user2, assistant2, question}
+		imageQuestion = withImage(text(models.ChatRoleUser, "aaaa"), "")
+	)
+
+	tests := []struct {
+		name       string
+		messages   []models.ChatMessage
+		budget     int
+		want       []models.ChatMessage
+		truncation *models.ChatTruncationDto
+		ok         bool
+	}{
+		{"预算内不省略", conversation, 30, conversation, nil, true},
+		{"省略最早的一轮", conversation, 29, []models.ChatMessage{system, user2, assistant2, question}, &models.ChatTruncationDto{DroppedMessages: 2}, true},
+		{"省略到刚好在预算内", conversation, 20, []models.ChatMessage{system, user2, assistant2, question}, &models.ChatTruncationDto{DroppedMessages: 2}, true},
+		{"只保留系统消息和问题", conversation, 10, []models.ChatMessage{system, question}, &models.ChatTruncationDto{DroppedMessages: 4}, true},
+		{"系统消息和问题超出预算", conversation, 9, nil, nil, false},
+		{
+			"先替换较早消息中的图片",
+			[]models.ChatMessage{withImage(user1, ""), assistant1, question},
+			// 替换后：4+1+3（"[图片]"）、5、5
+			18,
+			[]models.ChatMessage{
+				{Role: models.ChatRoleUser, Content: []models.ChatMessageContentPart{
+					models.NewChatMessageContentPartText("aaaa"),
+					models.NewChatMessageContentPartText("[图片]"),
+				}},
+				assistant1,
+				question,
+			},
+			&models.ChatTruncationDto{DroppedImages: 1},
+			true,
+		},
+		{
+			"低精度图片",
+			[]models.ChatMessage{withImage(user1, "low"), question},
+			5 + imageLowDetailTokens + 5,
+			[]models.ChatMessage{withImage(user1, "low"), question},
+			nil,
+			true,
+		},
+		{
+			"不替换问题中的图片",
+			[]models.ChatMessage{user1, assistant1, imageQuestion},
+			5 + imageHighDetailTokens,
+			[]models.ChatMessage{imageQuestion},
+			&models.ChatTruncationDto{DroppedMessages: 2},
+			true,
+		},
+		{
+			"工具调用与所在的一轮一起省略",
+			[]models.ChatMessage{user1, toolCall, toolResult, assistant1, question},
+			5,
+			[]models.ChatMessage{question},
+			&models.ChatTruncationDto{DroppedMessages: 4},
+			true,
+		},
+		{
+			"保留中间的系统消息",
+			[]models.ChatMessage{user1, assistant1, system, user2, assistant2, question},
+			20,
+			[]models.ChatMessage{system, user2, assistant2, question},
+			&models.ChatTruncationDto{DroppedMessages: 2},
+			true,
+		},
+	}
+	for _, test := range tests {
+		original := make([]models.ChatMessage, len(test.messages))
+		copy(original, test.messages)
+
+		got, truncation, ok := fitContext(test.messages, test.budget)
+		if ok != test.ok {
+			t.Errorf("%s: ok = %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: messages = %+v, want %+v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(truncation, test.truncation) {
+			t.Errorf("%s: truncation = %+v, want %+v", test.name, truncation, test.truncation)
+		}
+		if !reflect.DeepEqual(test.messages, original) {
+			t.Errorf("%s: input messages modified", test.name)
+		}
+		total := 0
+		for _, message := range got {
+			total += estimateMessageTokens(message)
+		}
+		if ok && total > test.budget {
+			t.Errorf("%s: %d tokens, more than budget %d", test.name, total, test.budget)
+		}
+	}
+}
+
+func TestEstimateTextTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好", 2},
+		{"hi，世界", 4},
+	}
+	for _, test := range tests {
+		if got := estimateTextTokens(test.text); got != test.want {
+			t.Errorf("estimateTextTokens(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestEstimateUsage(t *testing.T) {
+	request := ChatCompletionsRequest{
+		Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, "abcd")},
+		Tools:    []ChatTool{{Name: "calc", Description: "abcdefgh", Parameters: []byte("{}")}},
+	}
+	resp := &ChatCompletionsResponse{Choices: []ChatCompletionsChoice{
+		{Message: models.NewChatMessageText(models.ChatRoleAssistant, "你好")},
+		{Message: models.NewChatMessageText(models.ChatRoleAssistant, "abcd")},
+	}}
+	want := ChatCompletionsUsage{PromptTokens: 5 + 1 + 2 + 1, CompletionTokens: 6 + 5, TotalTokens: 20}
+	if got := estimateUsage(request, resp); got != want {
+		t.Errorf("estimateUsage() = %+v, want %+v", got, want)
+	}
+}
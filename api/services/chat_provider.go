@@ -0,0 +1,179 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChatProvider 模型服务接口，屏蔽不同模型服务SDK的差异
+type ChatProvider interface {
+	GetChatCompletions(ctx context.Context, request ChatCompletionsRequest) (*ChatCompletionsResponse, error)
+	GetChatCompletionsStream(ctx context.Context, request ChatCompletionsRequest) (ChatCompletionsStream, error)
+}
+
+// ChatCompletionsStream 流式回答
+type ChatCompletionsStream interface {
+	// Recv 返回下一段增量，全部返回后返回io.EOF
+	Recv() (*ChatCompletionsDelta, error)
+	Close() error
+}
+
+type ChatCompletionsRequest struct {
+	// Model 为空时使用模型服务的默认模型
+	Model      string
+	Messages   []models.ChatMessage
+	Parameters models.ChatParameters
+	// N 候选回答数，为0或1时不发送
+	N int
+	// Tools 模型可以调用的工具，为空时不发送工具定义
+	Tools []ChatTool
+	// ToolChoice none时要求模型不调用工具直接回答，为空时由模型决定
+	ToolChoice string
+}
+
+// ChatTool 发送给模型服务的工具定义，Parameters为参数的JSON Schema
+type ChatTool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+type ChatCompletionsResponse struct {
+	Model   string
+	Choices []ChatCompletionsChoice
+	Usage   ChatCompletionsUsage
+}
+
+type ChatCompletionsChoice struct {
+	Message      models.ChatMessage
+	FinishReason string
+}
+
+type ChatCompletionsDelta struct {
+	Model string
+	// Index 回答的序号，为-1时只包含用量
+	Index        int
+	Content      string
+	FinishReason string
+	// ToolCalls 工具调用的增量，同一调用的参数分多段返回
+	ToolCalls []ChatCompletionsToolCallDelta
+	// Usage 只在模型服务返回用量时设置
+	Usage *ChatCompletionsUsage
+}
+
+// ChatCompletionsToolCallDelta 工具调用的增量，Index相同的增量属于同一调用，Id和Name只在第一段设置
+type ChatCompletionsToolCallDelta struct {
+	Index     int
+	Id        string
+	Name      string
+	Arguments string
+}
+
+type ChatCompletionsUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// NewChatProvider 根据配置创建模型服务
+func NewChatProvider(providerConfig config.ProviderConfig) (ChatProvider, error) {
+	switch providerConfig.Type {
+	case "azure":
+		return newAzureChatProvider(providerConfig)
+	case "openai":
+		return newOpenAIChatProvider(providerConfig)
+	case "fake":
+		return newFakeChatProvider(providerConfig)
+	default:
+		return nil, fmt.Errorf("不支持的模型服务：%s", providerConfig.Type)
+	}
+}
+
+// candidateCount 发送给模型服务的候选回答数，只有一个候选时返回0（不发送）
+func candidateCount(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return n
+}
+
+// collectChatCompletionsStream 读取流式回答，逐段回调onDelta，并拼接成完整的回答
+// 读取中途出错（包括客户端断开连接）时同时返回已经读取的部分回答和错误，用于记录使用量
+func collectChatCompletionsStream(stream ChatCompletionsStream, onDelta func(delta models.ChatStreamDeltaDto)) (*ChatCompletionsResponse, error) {
+	defer func() {
+		_ = stream.Close()
+	}()
+
+	var (
+		response  = &ChatCompletionsResponse{}
+		contents  []*strings.Builder
+		toolCalls [][]models.ChatMessageToolCall
+		recvErr   error
+	)
+	for {
+		delta, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			recvErr = err
+			break
+		}
+		if delta.Model != "" {
+			response.Model = delta.Model
+		}
+		if delta.Usage != nil {
+			response.Usage = *delta.Usage
+		}
+		if delta.Index < 0 {
+			continue
+		}
+		for len(response.Choices) <= delta.Index {
+			response.Choices = append(response.Choices, ChatCompletionsChoice{})
+			contents = append(contents, new(strings.Builder))
+			toolCalls = append(toolCalls, nil)
+		}
+		if delta.FinishReason != "" {
+			response.Choices[delta.Index].FinishReason = delta.FinishReason
+		}
+		if delta.Content != "" {
+			contents[delta.Index].WriteString(delta.Content)
+			onDelta(models.ChatStreamDeltaDto{
+				Index:   delta.Index,
+				Content: delta.Content,
+			})
+		}
+		for _, toolCallDelta := range delta.ToolCalls {
+			calls := toolCalls[delta.Index]
+			for len(calls) <= toolCallDelta.Index {
+				calls = append(calls, models.ChatMessageToolCall{Type: models.ChatMessageToolCallTypeFunction})
+			}
+			call := &calls[toolCallDelta.Index]
+			if toolCallDelta.Id != "" {
+				call.Id = toolCallDelta.Id
+			}
+			if toolCallDelta.Name != "" {
+				call.Function.Name = toolCallDelta.Name
+			}
+			call.Function.Arguments += toolCallDelta.Arguments
+			toolCalls[delta.Index] = calls
+		}
+	}
+
+	for i := range response.Choices {
+		// 只调用工具的回答没有文本
+		if contents[i].Len() == 0 && len(toolCalls[i]) > 0 {
+			response.Choices[i].Message = models.ChatMessage{Role: models.ChatRoleAssistant}
+		} else {
+			response.Choices[i].Message = models.NewChatMessageText(models.ChatRoleAssistant, contents[i].String())
+		}
+		response.Choices[i].Message.ToolCalls = toolCalls[i]
+	}
+	return response, recvErr
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// azureChatProvider Azure OpenAI
+type azureChatProvider struct {
+	client            *azopenai.Client
+	modelDeploymentID string
+	timeout           time.Duration
+}
+
+func newAzureChatProvider(providerConfig config.ProviderConfig) (ChatProvider, error) {
+	keyCredential := azcore.NewKeyCredential(providerConfig.APIKey)
+	client, err := azopenai.NewClientWithKeyCredential(providerConfig.Endpoint, keyCredential, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureChatProvider{
+		client:            client,
+		modelDeploymentID: providerConfig.Model,
+		timeout:           providerConfig.Timeout,
+	}, nil
+}
+
+func (provider *azureChatProvider) GetChatCompletions(ctx context.Context, request ChatCompletionsRequest) (*ChatCompletionsResponse, error) {
+	deploymentName := provider.modelDeploymentID
+	if request.Model != "" {
+		deploymentName = request.Model
+	}
+
+	if provider.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, provider.timeout)
+		defer cancel()
+	}
+
+	resp, err := provider.client.GetChatCompletions(ctx, provider.toAzopenaiOptions(deploymentName, request), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ChatCompletionsResponse{
+		Model: deploymentName,
+	}
+	if resp.Model != nil {
+		response.Model = *resp.Model
+	}
+	for _, respChoice := range resp.Choices {
+		choice := ChatCompletionsChoice{}
+		if respChoice.Message != nil && respChoice.Message.Content != nil {
+			choice.Message = models.NewChatMessageText(models.ChatRoleAssistant, *respChoice.Message.Content)
+		} else {
+			choice.Message = models.ChatMessage{Role: models.ChatRoleAssistant}
+		}
+		if respChoice.Message != nil {
+			choice.Message.ToolCalls = fromAzopenaiToolCalls(respChoice.Message.ToolCalls)
+		}
+		if respChoice.FinishReason != nil {
+			choice.FinishReason = string(*respChoice.FinishReason)
+		}
+		response.Choices = append(response.Choices, choice)
+	}
+	if resp.Usage != nil {
+		response.Usage = ChatCompletionsUsage{
+			PromptTokens:     int32Value(resp.Usage.PromptTokens),
+			CompletionTokens: int32Value(resp.Usage.CompletionTokens),
+			TotalTokens:      int32Value(resp.Usage.TotalTokens),
+		}
+	}
+	return response, nil
+}
+
+func (provider *azureChatProvider) GetChatCompletionsStream(ctx context.Context, request ChatCompletionsRequest) (ChatCompletionsStream, error) {
+	deploymentName := provider.modelDeploymentID
+	if request.Model != "" {
+		deploymentName = request.Model
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if provider.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, provider.timeout)
+	}
+
+	resp, err := provider.client.GetChatCompletionsStream(ctx, provider.toAzopenaiOptions(deploymentName, request), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &azureChatCompletionsStream{
+		reader: resp.ChatCompletionsStream,
+		cancel: cancel,
+		model:  deploymentName,
+	}, nil
+}
+
+func (provider *azureChatProvider) toAzopenaiOptions(deploymentName string, request ChatCompletionsRequest) azopenai.ChatCompletionsOptions {
+	options := azopenai.ChatCompletionsOptions{
+		Messages:       toAzopenaiMessages(request.Messages),
+		DeploymentName: &deploymentName,
+		Temperature:    request.Parameters.Temperature,
+		TopP:           request.Parameters.TopP,
+		MaxTokens:      request.Parameters.MaxTokens,
+	}
+	if n := candidateCount(request.N); n > 0 {
+		options.N = to.Ptr(int32(n))
+	}
+	for _, tool := range request.Tools {
+		options.Tools = append(options.Tools, &azopenai.ChatCompletionsFunctionToolDefinition{
+			Type: to.Ptr(models.ChatMessageToolCallTypeFunction),
+			Function: &azopenai.FunctionDefinition{
+				Name:        to.Ptr(tool.Name),
+				Description: to.Ptr(tool.Description),
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	switch request.ToolChoice {
+	case "none":
+		options.ToolChoice = azopenai.ChatCompletionsToolChoiceNone
+	case "auto":
+		options.ToolChoice = azopenai.ChatCompletionsToolChoiceAuto
+	}
+	return options
+}
+
+// azureChatCompletionsStream 将azopenai的流式响应逐个choice转为增量
+type azureChatCompletionsStream struct {
+	reader  *azopenai.EventReader[azopenai.ChatCompletions]
+	cancel  context.CancelFunc
+	model   string
+	pending []*ChatCompletionsDelta
+	// toolCallCounts 每个choice已开始的工具调用数，azopenai的增量没有调用的序号，有Id时为新的调用
+	toolCallCounts map[int]int
+}
+
+func (stream *azureChatCompletionsStream) Recv() (*ChatCompletionsDelta, error) {
+	for len(stream.pending) == 0 {
+		chatCompletions, err := stream.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		model := stream.model
+		if chatCompletions.Model != nil {
+			model = *chatCompletions.Model
+		}
+		for _, choice := range chatCompletions.Choices {
+			delta := &ChatCompletionsDelta{
+				Model: model,
+				Index: int32Value(choice.Index),
+			}
+			if choice.Delta != nil && choice.Delta.Content != nil {
+				delta.Content = *choice.Delta.Content
+			}
+			if choice.FinishReason != nil {
+				delta.FinishReason = string(*choice.FinishReason)
+			}
+			if choice.Delta != nil {
+				delta.ToolCalls = stream.toolCallDeltas(delta.Index, choice.Delta.ToolCalls)
+			}
+			stream.pending = append(stream.pending, delta)
+		}
+		if chatCompletions.Usage != nil {
+			stream.pending = append(stream.pending, &ChatCompletionsDelta{
+				Model: model,
+				Index: -1,
+				Usage: &ChatCompletionsUsage{
+					PromptTokens:     int32Value(chatCompletions.Usage.PromptTokens),
+					CompletionTokens: int32Value(chatCompletions.Usage.CompletionTokens),
+					TotalTokens:      int32Value(chatCompletions.Usage.TotalTokens),
+				},
+			})
+		}
+	}
+	delta := stream.pending[0]
+	stream.pending = stream.pending[1:]
+	return delta, nil
+}
+
+func (stream *azureChatCompletionsStream) toolCallDeltas(index int, toolCalls []azopenai.ChatCompletionsToolCallClassification) []ChatCompletionsToolCallDelta {
+	var deltas []ChatCompletionsToolCallDelta
+	for _, toolCall := range toolCalls {
+		functionToolCall, ok := toolCall.(*azopenai.ChatCompletionsFunctionToolCall)
+		if !ok {
+			continue
+		}
+		if stream.toolCallCounts == nil {
+			stream.toolCallCounts = make(map[int]int)
+		}
+		if functionToolCall.ID != nil && *functionToolCall.ID != "" {
+			stream.toolCallCounts[index]++
+		}
+		delta := ChatCompletionsToolCallDelta{
+			Index: max(stream.toolCallCounts[index]-1, 0),
+			Id:    stringValue(functionToolCall.ID),
+		}
+		if functionToolCall.Function != nil {
+			delta.Name = stringValue(functionToolCall.Function.Name)
+			delta.Arguments = stringValue(functionToolCall.Function.Arguments)
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+func (stream *azureChatCompletionsStream) Close() error {
+	defer stream.cancel()
+	return stream.reader.Close()
+}
+
+// toAzopenaiMessages 将对话消息转为azopenai的输入
+func toAzopenaiMessages(chatMessages []models.ChatMessage) []azopenai.ChatRequestMessageClassification {
+	var messages []azopenai.ChatRequestMessageClassification
+	for _, chatMessage := range chatMessages {
+		switch chatMessage.Role {
+		case models.ChatRoleSystem:
+			messages = append(messages, &azopenai.ChatRequestSystemMessage{
+				Content: to.Ptr(chatMessage.Text()),
+			})
+		case models.ChatRoleAssistant:
+			message := &azopenai.ChatRequestAssistantMessage{}
+			// 只调用工具的回答内容为null
+			if text := chatMessage.Text(); text != "" || len(chatMessage.ToolCalls) == 0 {
+				message.Content = to.Ptr(text)
+			}
+			for _, toolCall := range chatMessage.ToolCalls {
+				message.ToolCalls = append(message.ToolCalls, &azopenai.ChatCompletionsFunctionToolCall{
+					ID:   to.Ptr(toolCall.Id),
+					Type: to.Ptr(models.ChatMessageToolCallTypeFunction),
+					Function: &azopenai.FunctionCall{
+						Name:      to.Ptr(toolCall.Function.Name),
+						Arguments: to.Ptr(toolCall.Function.Arguments),
+					},
+				})
+			}
+			messages = append(messages, message)
+		case models.ChatRoleTool:
+			messages = append(messages, &azopenai.ChatRequestToolMessage{
+				Content:    to.Ptr(chatMessage.Text()),
+				ToolCallID: to.Ptr(chatMessage.ToolCallId),
+			})
+		case models.ChatRoleUser:
+			var contents []azopenai.ChatCompletionRequestMessageContentPartClassification
+			for _, part := range chatMessage.RequestContent() {
+				switch part.Type {
+				case models.ChatMessageContentPartTypeText:
+					contents = append(contents, &azopenai.ChatCompletionRequestMessageContentPartText{
+						Text: to.Ptr(part.Text),
+					})
+				case models.ChatMessageContentPartTypeImage:
+					imageURL := &azopenai.ChatCompletionRequestMessageContentPartImageURL{
+						URL: to.Ptr(part.ImageURL.URL),
+					}
+					if part.ImageURL.Detail != "" {
+						imageURL.Detail = to.Ptr(azopenai.ChatCompletionRequestMessageContentPartImageURLDetail(part.ImageURL.Detail))
+					}
+					contents = append(contents, &azopenai.ChatCompletionRequestMessageContentPartImage{
+						ImageURL: imageURL,
+					})
+				}
+			}
+			messages = append(messages, &azopenai.ChatRequestUserMessage{
+				Content: azopenai.NewChatRequestUserMessageContent(contents),
+			})
+		}
+	}
+	return messages
+}
+
+// fromAzopenaiToolCalls 将回答中的工具调用转为对话消息的格式
+func fromAzopenaiToolCalls(toolCalls []azopenai.ChatCompletionsToolCallClassification) []models.ChatMessageToolCall {
+	var result []models.ChatMessageToolCall
+	for _, toolCall := range toolCalls {
+		functionToolCall, ok := toolCall.(*azopenai.ChatCompletionsFunctionToolCall)
+		if !ok || functionToolCall.Function == nil {
+			continue
+		}
+		result = append(result, models.ChatMessageToolCall{
+			Id:   stringValue(functionToolCall.ID),
+			Type: models.ChatMessageToolCallTypeFunction,
+			Function: models.ChatMessageFunctionCall{
+				Name:      stringValue(functionToolCall.Function.Name),
+				Arguments: stringValue(functionToolCall.Function.Arguments),
+			},
+		})
+	}
+	return result
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func int32Value(value *int32) int {
+	if value == nil {
+		return 0
+	}
+	return int(*value)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// fakeChatProvider 进程内的模拟模型服务，不访问网络，相同输入总是返回相同的回答
+// 问题为“/tool 工具名 JSON参数”且请求中有该工具时返回工具调用，之后复述工具的执行结果
+// 请求多个候选时第2个以后的候选在回答后加上序号
+type fakeChatProvider struct {
+	model string
+}
+
+func newFakeChatProvider(providerConfig config.ProviderConfig) (ChatProvider, error) {
+	model := providerConfig.Model
+	if model == "" {
+		model = "fake"
+	}
+	return &fakeChatProvider{model: model}, nil
+}
+
+func (provider *fakeChatProvider) GetChatCompletions(_ context.Context, request ChatCompletionsRequest) (*ChatCompletionsResponse, error) {
+	model := provider.model
+	if request.Model != "" {
+		model = request.Model
+	}
+
+	var (
+		answer           = provider.answer(request.Messages)
+		toolCall, isTool = provider.toolCall(request)
+		choices          []ChatCompletionsChoice
+		completionTokens int
+	)
+	for i := 0; i < max(request.N, 1); i++ {
+		choice := ChatCompletionsChoice{
+			Message:      models.NewChatMessageText(models.ChatRoleAssistant, answer),
+			FinishReason: "stop",
+		}
+		if i > 0 {
+			choice.Message = models.NewChatMessageText(models.ChatRoleAssistant, fmt.Sprintf("%s (%d)", answer, i+1))
+		}
+		if isTool {
+			choice = ChatCompletionsChoice{
+				Message: models.ChatMessage{
+					Role:      models.ChatRoleAssistant,
+					ToolCalls: []models.ChatMessageToolCall{toolCall},
+				},
+				FinishReason: "tool_calls",
+			}
+		}
+		completionTokens += utf8.RuneCountInString(choice.Message.Text())
+		for _, toolCall := range choice.Message.ToolCalls {
+			completionTokens += utf8.RuneCountInString(toolCall.Function.Name + toolCall.Function.Arguments)
+		}
+		choices = append(choices, choice)
+	}
+	promptTokens := 0
+	for _, message := range request.Messages {
+		promptTokens += utf8.RuneCountInString(message.Text())
+	}
+
+	return &ChatCompletionsResponse{
+		Model:   model,
+		Choices: choices,
+		Usage: ChatCompletionsUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+func (provider *fakeChatProvider) GetChatCompletionsStream(ctx context.Context, request ChatCompletionsRequest) (ChatCompletionsStream, error) {
+	response, err := provider.GetChatCompletions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个候选每4个字符作为一段增量返回
+	var deltas []*ChatCompletionsDelta
+	for index, choice := range response.Choices {
+		answer := []rune(choice.Message.Text())
+		for start := 0; start < len(answer); start += 4 {
+			end := min(start+4, len(answer))
+			deltas = append(deltas, &ChatCompletionsDelta{
+				Model:   response.Model,
+				Index:   index,
+				Content: string(answer[start:end]),
+			})
+		}
+		for i, toolCall := range choice.Message.ToolCalls {
+			deltas = append(deltas, &ChatCompletionsDelta{
+				Model: response.Model,
+				Index: index,
+				ToolCalls: []ChatCompletionsToolCallDelta{{
+					Index:     i,
+					Id:        toolCall.Id,
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				}},
+			})
+		}
+		deltas = append(deltas, &ChatCompletionsDelta{
+			Model:        response.Model,
+			Index:        index,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	deltas = append(deltas, &ChatCompletionsDelta{
+		Model: response.Model,
+		Index: -1,
+		Usage: &response.Usage,
+	})
+	return &fakeChatCompletionsStream{deltas: deltas}, nil
+}
+
+type fakeChatCompletionsStream struct {
+	deltas []*ChatCompletionsDelta
+}
+
+func (stream *fakeChatCompletionsStream) Recv() (*ChatCompletionsDelta, error) {
+	if len(stream.deltas) == 0 {
+		return nil, io.EOF
+	}
+	delta := stream.deltas[0]
+	stream.deltas = stream.deltas[1:]
+	return delta, nil
+}
+
+func (stream *fakeChatCompletionsStream) Close() error {
+	return nil
+}
+
+// answer 复述最后一条用户消息，最后是工具消息时复述工具的执行结果
+func (provider *fakeChatProvider) answer(messages []models.ChatMessage) string {
+	var results []string
+	for i := len(messages) - 1; i >= 0 && messages[i].Role == models.ChatRoleTool; i-- {
+		results = append([]string{messages[i].Text()}, results...)
+	}
+	if len(results) > 0 {
+		return fmt.Sprintf("[%d] %s", len(messages), strings.Join(results, "\n"))
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == models.ChatRoleUser {
+			return fmt.Sprintf("[%d] %s", len(messages), messages[i].Text())
+		}
+	}
+	return fmt.Sprintf("[%d]", len(messages))
+}
+
+// toolCall 最后一条消息为“/tool 工具名 JSON参数”且请求中有该工具时返回工具调用
+func (provider *fakeChatProvider) toolCall(request ChatCompletionsRequest) (models.ChatMessageToolCall, bool) {
+	if request.ToolChoice == "none" || len(request.Messages) == 0 {
+		return models.ChatMessageToolCall{}, false
+	}
+	last := request.Messages[len(request.Messages)-1]
+	if last.Role != models.ChatRoleUser {
+		return models.ChatMessageToolCall{}, false
+	}
+	command, found := strings.CutPrefix(strings.TrimSpace(last.Text()), "/tool ")
+	if !found {
+		return models.ChatMessageToolCall{}, false
+	}
+	name, arguments, _ := strings.Cut(strings.TrimSpace(command), " ")
+	if !slices.ContainsFunc(request.Tools, func(tool ChatTool) bool { return tool.Name == name }) {
+		return models.ChatMessageToolCall{}, false
+	}
+	if arguments = strings.TrimSpace(arguments); arguments == "" {
+		arguments = "{}"
+	}
+	return models.ChatMessageToolCall{
+		Id:   fmt.Sprintf("call_%d", len(request.Messages)),
+		Type: models.ChatMessageToolCallTypeFunction,
+		Function: models.ChatMessageFunctionCall{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}, true
+}
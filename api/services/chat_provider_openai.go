@@ -0,0 +1,352 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// openAIChatProvider OpenAI兼容的HTTP接口（OpenAI、llama.cpp、vLLM等）
+type openAIChatProvider struct {
+	client   *http.Client
+	endpoint string
+	apiKey   string
+	model    string
+}
+
+type openAIChatMessage struct {
+	Role       models.ChatRole              `json:"role"`
+	Content    any                          `json:"content"`
+	ToolCalls  []models.ChatMessageToolCall `json:"tool_calls,omitempty"`
+	ToolCallId string                       `json:"tool_call_id,omitempty"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIChatCompletionsRequest struct {
+	Model         string                   `json:"model"`
+	Messages      []openAIChatMessage      `json:"messages"`
+	Tools         []openAITool             `json:"tools,omitempty"`
+	ToolChoice    string                   `json:"tool_choice,omitempty"`
+	Temperature   *float32                 `json:"temperature,omitempty"`
+	TopP          *float32                 `json:"top_p,omitempty"`
+	MaxTokens     *int32                   `json:"max_tokens,omitempty"`
+	N             int                      `json:"n,omitempty"`
+	Stream        bool                     `json:"stream,omitempty"`
+	StreamOptions *openAIChatStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIChatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatCompletionsResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Role      models.ChatRole              `json:"role"`
+			Content   *string                      `json:"content"`
+			ToolCalls []models.ChatMessageToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type openAIChatCompletionsChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content   *string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				Id       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newOpenAIChatProvider(providerConfig config.ProviderConfig) (ChatProvider, error) {
+	return &openAIChatProvider{
+		client:   &http.Client{Timeout: providerConfig.Timeout},
+		endpoint: strings.TrimRight(providerConfig.Endpoint, "/"),
+		apiKey:   providerConfig.APIKey,
+		model:    providerConfig.Model,
+	}, nil
+}
+
+func (provider *openAIChatProvider) GetChatCompletions(ctx context.Context, request ChatCompletionsRequest) (*ChatCompletionsResponse, error) {
+	body := openAIChatCompletionsRequest{
+		Model:       provider.model,
+		Messages:    toOpenAIMessages(request.Messages),
+		Tools:       toOpenAITools(request.Tools),
+		ToolChoice:  request.ToolChoice,
+		Temperature: request.Parameters.Temperature,
+		TopP:        request.Parameters.TopP,
+		MaxTokens:   request.Parameters.MaxTokens,
+		N:           candidateCount(request.N),
+	}
+	if request.Model != "" {
+		body.Model = request.Model
+	}
+
+	var resp openAIChatCompletionsResponse
+	if err := provider.post(ctx, "/chat/completions", body, &resp); err != nil {
+		return nil, err
+	}
+
+	response := &ChatCompletionsResponse{
+		Model: resp.Model,
+		Usage: ChatCompletionsUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+	if response.Model == "" {
+		response.Model = body.Model
+	}
+	for _, respChoice := range resp.Choices {
+		choice := ChatCompletionsChoice{
+			Message:      models.ChatMessage{Role: models.ChatRoleAssistant},
+			FinishReason: respChoice.FinishReason,
+		}
+		if respChoice.Message.Content != nil {
+			choice.Message = models.NewChatMessageText(models.ChatRoleAssistant, *respChoice.Message.Content)
+		}
+		choice.Message.ToolCalls = respChoice.Message.ToolCalls
+		response.Choices = append(response.Choices, choice)
+	}
+	return response, nil
+}
+
+func (provider *openAIChatProvider) GetChatCompletionsStream(ctx context.Context, request ChatCompletionsRequest) (ChatCompletionsStream, error) {
+	body := openAIChatCompletionsRequest{
+		Model:         provider.model,
+		Messages:      toOpenAIMessages(request.Messages),
+		Tools:         toOpenAITools(request.Tools),
+		ToolChoice:    request.ToolChoice,
+		Temperature:   request.Parameters.Temperature,
+		TopP:          request.Parameters.TopP,
+		MaxTokens:     request.Parameters.MaxTokens,
+		N:             candidateCount(request.N),
+		Stream:        true,
+		StreamOptions: &openAIChatStreamOptions{IncludeUsage: true},
+	}
+	if request.Model != "" {
+		body.Model = request.Model
+	}
+
+	resp, err := provider.send(ctx, "/chat/completions", body)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &openAIChatCompletionsStream{
+		body:    resp.Body,
+		scanner: scanner,
+		model:   body.Model,
+	}, nil
+}
+
+// openAIChatCompletionsStream 解析SSE格式的流式响应
+type openAIChatCompletionsStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	model   string
+	pending []*ChatCompletionsDelta
+}
+
+func (stream *openAIChatCompletionsStream) Recv() (*ChatCompletionsDelta, error) {
+	for len(stream.pending) == 0 {
+		if !stream.scanner.Scan() {
+			if err := stream.scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		line := stream.scanner.Text()
+		data, found := strings.CutPrefix(line, "data:")
+		if !found {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil, io.EOF
+		}
+
+		var chunk openAIChatCompletionsChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+		if chunk.Model != "" {
+			stream.model = chunk.Model
+		}
+		for _, choice := range chunk.Choices {
+			delta := &ChatCompletionsDelta{
+				Model: stream.model,
+				Index: choice.Index,
+			}
+			if choice.Delta.Content != nil {
+				delta.Content = *choice.Delta.Content
+			}
+			if choice.FinishReason != nil {
+				delta.FinishReason = *choice.FinishReason
+			}
+			for _, toolCall := range choice.Delta.ToolCalls {
+				delta.ToolCalls = append(delta.ToolCalls, ChatCompletionsToolCallDelta{
+					Index:     toolCall.Index,
+					Id:        toolCall.Id,
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				})
+			}
+			stream.pending = append(stream.pending, delta)
+		}
+		if chunk.Usage != nil {
+			stream.pending = append(stream.pending, &ChatCompletionsDelta{
+				Model: stream.model,
+				Index: -1,
+				Usage: &ChatCompletionsUsage{
+					PromptTokens:     chunk.Usage.PromptTokens,
+					CompletionTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:      chunk.Usage.TotalTokens,
+				},
+			})
+		}
+	}
+	delta := stream.pending[0]
+	stream.pending = stream.pending[1:]
+	return delta, nil
+}
+
+func (stream *openAIChatCompletionsStream) Close() error {
+	return stream.body.Close()
+}
+
+// post 发送JSON请求并解析JSON响应
+func (provider *openAIChatProvider) post(ctx context.Context, path string, body any, result any) error {
+	resp, err := provider.send(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// send 发送JSON请求，非2xx响应作为错误返回
+func (provider *openAIChatProvider) send(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return openAIPost(ctx, provider.client, provider.endpoint, provider.apiKey, path, "application/json", bytes.NewReader(data))
+}
+
+// openAIPost 向OpenAI兼容接口发送POST请求，非2xx响应按OpenAI的错误格式解析后作为错误返回
+// 聊天、语音识别和embeddings接口共用
+func openAIPost(ctx context.Context, client *http.Client, endpoint string, apiKey string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var errorResponse openAIErrorResponse
+		if json.Unmarshal(respBody, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			return nil, fmt.Errorf("%s %s: %d %s", http.MethodPost, path, resp.StatusCode, errorResponse.Error.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %d %s", http.MethodPost, path, resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// toOpenAIMessages 将对话消息转为OpenAI接口的消息格式
+func toOpenAIMessages(chatMessages []models.ChatMessage) []openAIChatMessage {
+	messages := make([]openAIChatMessage, 0, len(chatMessages))
+	for _, chatMessage := range chatMessages {
+		message := openAIChatMessage{
+			Role:       chatMessage.Role,
+			ToolCalls:  chatMessage.ToolCalls,
+			ToolCallId: chatMessage.ToolCallId,
+		}
+		switch {
+		case chatMessage.Role == models.ChatRoleUser:
+			message.Content = chatMessage.RequestContent()
+		case len(chatMessage.ToolCalls) > 0 && chatMessage.Text() == "":
+			// 只调用工具的回答内容为null
+		default:
+			message.Content = chatMessage.Text()
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// toOpenAITools 将工具定义转为OpenAI接口的格式
+func toOpenAITools(chatTools []ChatTool) []openAITool {
+	var tools []openAITool
+	for _, chatTool := range chatTools {
+		tools = append(tools, openAITool{
+			Type: models.ChatMessageToolCallTypeFunction,
+			Function: openAIToolFunction{
+				Name:        chatTool.Name,
+				Description: chatTool.Description,
+				Parameters:  chatTool.Parameters,
+			},
+		})
+	}
+	return tools
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedStream 按顺序返回预设的增量，最后返回err（为nil时返回io.EOF）
+type scriptedStream struct {
+	deltas []*ChatCompletionsDelta
+	err    error
+	closed bool
+}
+
+func (stream *scriptedStream) Recv() (*ChatCompletionsDelta, error) {
+	if len(stream.deltas) == 0 {
+		if stream.err != nil {
+			return nil, stream.err
+		}
+		return nil, io.EOF
+	}
+	delta := stream.deltas[0]
+	stream.deltas = stream.deltas[1:]
+	return delta, nil
+}
+
+func (stream *scriptedStream) Close() error {
+	stream.closed = true
+	return nil
+}
+
+func TestCollectChatCompletionsStreamMatchesFakeProvider(t *testing.T) {
+	provider, err := newFakeChatProvider(config.ProviderConfig{Model: "fake-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calculatorTool := ChatTool{Name: "calculator", Parameters: json.RawMessage(`{"type":"object"}`)}
+
+	tests := []struct {
+		name    string
+		request ChatCompletionsRequest
+	}{
+		{"文本", ChatCompletionsRequest{
+			Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, "你好，请介绍一下你自己")},
+		}},
+		{"多个候选", ChatCompletionsRequest{
+			Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, "hello")},
+			N:        3,
+		}},
+		{"工具调用", ChatCompletionsRequest{
+			Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, `/tool calculator {"expression":"1+1"}`)},
+			Tools:    []ChatTool{calculatorTool},
+		}},
+		{"空问题", ChatCompletionsRequest{
+			Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, "")},
+		}},
+	}
+	for _, test := range tests {
+		want, err := provider.GetChatCompletions(context.Background(), test.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, err := provider.GetChatCompletionsStream(context.Background(), test.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed := make(map[int]string)
+		got, err := collectChatCompletionsStream(stream, func(delta models.ChatStreamDeltaDto) {
+			streamed[delta.Index] += delta.Content
+		})
+		if err != nil {
+			t.Errorf("%s: collectChatCompletionsStream() error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: collectChatCompletionsStream() = %+v, want %+v", test.name, got, want)
+		}
+		for i, choice := range want.Choices {
+			if streamed[i] != choice.Message.Text() {
+				t.Errorf("%s: streamed choice %d = %q, want %q", test.name, i, streamed[i], choice.Message.Text())
+			}
+		}
+	}
+}
+
+func TestCollectChatCompletionsStream(t *testing.T) {
+	recvErr := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		stream   *scriptedStream
+		want     *ChatCompletionsResponse
+		wantErr  error
+		streamed []models.ChatStreamDeltaDto
+	}{
+		{
+			"工具调用的参数分段返回",
+			&scriptedStream{deltas: []*ChatCompletionsDelta{
+				{Model: "m", Index: 0, ToolCalls: []ChatCompletionsToolCallDelta{{Index: 0, Id: "call_1", Name: "calculator", Arguments: `{"expr`}}},
+				{Index: 0, ToolCalls: []ChatCompletionsToolCallDelta{{Index: 0, Arguments: `ession":"1+1"}`}}},
+				{Index: 0, ToolCalls: []ChatCompletionsToolCallDelta{{Index: 1, Id: "call_2", Name: "current_time"}}},
+				{Index: 0, FinishReason: "tool_calls"},
+				{Index: -1, Usage: &ChatCompletionsUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}},
+			}},
+			&ChatCompletionsResponse{
+				Model: "m",
+				Choices: []ChatCompletionsChoice{{
+					Message: models.ChatMessage{
+						Role: models.ChatRoleAssistant,
+						ToolCalls: []models.ChatMessageToolCall{
+							{Id: "call_1", Type: "function", Function: models.ChatMessageFunctionCall{Name: "calculator", Arguments: `{"expression":"1+1"}`}},
+							{Id: "call_2", Type: "function", Function: models.ChatMessageFunctionCall{Name: "current_time"}},
+						},
+					},
+					FinishReason: "tool_calls",
+				}},
+				Usage: ChatCompletionsUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			},
+			nil,
+			nil,
+		},
+		{
+			"候选的增量交错返回",
+			&scriptedStream{deltas: []*ChatCompletionsDelta{
+				{Model: "m", Index: 1, Content: "B1"},
+				{Index: 0, Content: "A1"},
+				{Index: 1, Content: "B2", FinishReason: "stop"},
+				{Index: 0, Content: "A2", FinishReason: "length"},
+				{Index: -1, Usage: &ChatCompletionsUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}},
+			}},
+			&ChatCompletionsResponse{
+				Model: "m",
+				Choices: []ChatCompletionsChoice{
+					{Message: models.NewChatMessageText(models.ChatRoleAssistant, "A1A2"), FinishReason: "length"},
+					{Message: models.NewChatMessageText(models.ChatRoleAssistant, "B1B2"), FinishReason: "stop"},
+				},
+				Usage: ChatCompletionsUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			},
+			nil,
+			[]models.ChatStreamDeltaDto{
+				{Index: 1, Content: "B1"},
+				{Index: 0, Content: "A1"},
+				{Index: 1, Content: "B2"},
+				{Index: 0, Content: "A2"},
+			},
+		},
+		{
+			"中途出错时返回部分回答",
+			&scriptedStream{
+				deltas: []*ChatCompletionsDelta{
+					{Model: "m", Index: 0, Content: "部分"},
+				},
+				err: recvErr,
+			},
+			&ChatCompletionsResponse{
+				Model: "m",
+				Choices: []ChatCompletionsChoice{
+					{Message: models.NewChatMessageText(models.ChatRoleAssistant, "部分")},
+				},
+			},
+			recvErr,
+			[]models.ChatStreamDeltaDto{{Index: 0, Content: "部分"}},
+		},
+		{
+			"没有增量",
+			&scriptedStream{},
+			&ChatCompletionsResponse{},
+			nil,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		var streamed []models.ChatStreamDeltaDto
+		got, err := collectChatCompletionsStream(test.stream, func(delta models.ChatStreamDeltaDto) {
+			streamed = append(streamed, delta)
+		})
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: response = %+v, want %+v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(streamed, test.streamed) {
+			t.Errorf("%s: deltas = %+v, want %+v", test.name, streamed, test.streamed)
+		}
+		if !test.stream.closed {
+			t.Errorf("%s: stream not closed", test.name)
+		}
+	}
+}
+
+func newTestOpenAIProvider(t *testing.T, handler http.HandlerFunc) ChatProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	provider, err := newOpenAIChatProvider(config.ProviderConfig{
+		Type:     "openai",
+		Endpoint: server.URL + "/v1/",
+		APIKey:   "test-key",
+		Model:    "default-model",
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestFakeChatProvider(t *testing.T) {
+	provider, err := newFakeChatProvider(config.ProviderConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		request ChatCompletionsRequest
+		want    *ChatCompletionsResponse
+	}{
+		{
+			"复述最后一条用户消息",
+			ChatCompletionsRequest{Messages: []models.ChatMessage{
+				models.NewChatMessageText(models.ChatRoleSystem, "sys"),
+				models.NewChatMessageText(models.ChatRoleUser, "你好"),
+			}},
+			&ChatCompletionsResponse{
+				Model:   "fake",
+				Choices: []ChatCompletionsChoice{{Message: models.NewChatMessageText(models.ChatRoleAssistant, "[2] 你好"), FinishReason: "stop"}},
+				Usage:   ChatCompletionsUsage{PromptTokens: 5, CompletionTokens: 6, TotalTokens: 11},
+			},
+		},
+		{
+			"指定模型",
+			ChatCompletionsRequest{Model: "gpt-x"},
+			&ChatCompletionsResponse{
+				Model:   "gpt-x",
+				Choices: []ChatCompletionsChoice{{Message: models.NewChatMessageText(models.ChatRoleAssistant, "[0]"), FinishReason: "stop"}},
+				Usage:   ChatCompletionsUsage{CompletionTokens: 3, TotalTokens: 3},
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := provider.GetChatCompletions(context.Background(), test.request)
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: response = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenAIChatCompletionsRequest(t *testing.T) {
+	var requestBody map[string]any
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			t.Error(err)
+		}
+		_, _ = io.WriteString(w, `{"choices":[]}`)
+	})
+
+	_, err := provider.GetChatCompletions(context.Background(), ChatCompletionsRequest{
+		Model: "gpt-x",
+		Messages: []models.ChatMessage{
+			models.NewChatMessageText(models.ChatRoleSystem, "sys"),
+			models.NewChatMessageText(models.ChatRoleUser, "hi"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"model": "gpt-x",
+		"messages": []any{
+			map[string]any{"role": "system", "content": "sys"},
+			map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "hi"}}},
+		},
+	}
+	if !reflect.DeepEqual(requestBody, want) {
+		t.Errorf("request = %v, want %v", requestBody, want)
+	}
+}
+
+func TestOpenAIChatCompletions(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *ChatCompletionsResponse
+		wantErr string
+	}{
+		{
+			"文本回答",
+			http.StatusOK,
+			`{"model":"gpt-x","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],` +
+				`"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`,
+			&ChatCompletionsResponse{
+				Model:   "gpt-x",
+				Choices: []ChatCompletionsChoice{{Message: models.NewChatMessageText(models.ChatRoleAssistant, "hi"), FinishReason: "stop"}},
+				Usage:   ChatCompletionsUsage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+			},
+			"",
+		},
+		{
+			"没有模型名时使用请求的模型",
+			http.StatusOK,
+			`{"choices":[{"message":{"role":"assistant","content":null},"finish_reason":"content_filter"}]}`,
+			&ChatCompletionsResponse{
+				Model:   "default-model",
+				Choices: []ChatCompletionsChoice{{Message: models.ChatMessage{Role: models.ChatRoleAssistant}, FinishReason: "content_filter"}},
+			},
+			"",
+		},
+		{
+			"OpenAI格式的错误",
+			http.StatusTooManyRequests,
+			`{"error":{"message":"Rate limit reached","type":"requests"}}`,
+			nil,
+			"429 Rate limit reached",
+		},
+		{
+			"其他格式的错误",
+			http.StatusBadGateway,
+			`upstream unavailable`,
+			nil,
+			"502 upstream unavailable",
+		},
+	}
+	for _, test := range tests {
+		provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			_, _ = io.WriteString(w, test.body)
+		})
+		got, err := provider.GetChatCompletions(context.Background(), ChatCompletionsRequest{})
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error = %v, want containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: response = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenAIChatCompletionsStream(t *testing.T) {
+	const body = ": keep-alive comment\n" +
+		"\n" +
+		`data: {"model":"gpt-x","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":"你好"}}]}` + "\n\n" +
+		`data:{"choices":[{"index":0,"delta":{"content":"，世界"},"finish_reason":null}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"calculator","arguments":""}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"expression\":"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"2*3\"}"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+		`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":7,"total_tokens":19}}` + "\n\n" +
+		"data: [DONE]\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":"ignored"}}]}` + "\n\n"
+
+	var requestBody openAIChatCompletionsRequest
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, body)
+	})
+
+	stream, err := provider.GetChatCompletionsStream(context.Background(), ChatCompletionsRequest{
+		Model:    "gpt-x",
+		Messages: []models.ChatMessage{models.NewChatMessageText(models.ChatRoleUser, "2*3")},
+		Tools:    []ChatTool{{Name: "calculator"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	got, err := collectChatCompletionsStream(stream, func(delta models.ChatStreamDeltaDto) {
+		streamed.WriteString(delta.Content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !requestBody.Stream || requestBody.StreamOptions == nil || !requestBody.StreamOptions.IncludeUsage {
+		t.Errorf("request stream options = %v %+v, want stream with usage", requestBody.Stream, requestBody.StreamOptions)
+	}
+	if requestBody.Model != "gpt-x" || len(requestBody.Tools) != 1 {
+		t.Errorf("request = %+v", requestBody)
+	}
+
+	want := &ChatCompletionsResponse{
+		Model: "gpt-x",
+		Choices: []ChatCompletionsChoice{{
+			Message:      models.NewChatMessageText(models.ChatRoleAssistant, "你好，世界"),
+			FinishReason: "tool_calls",
+		}},
+		Usage: ChatCompletionsUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19},
+	}
+	want.Choices[0].Message.ToolCalls = []models.ChatMessageToolCall{{
+		Id:       "call_1",
+		Type:     "function",
+		Function: models.ChatMessageFunctionCall{Name: "calculator", Arguments: `{"expression":"2*3"}`},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("response = %+v, want %+v", got, want)
+	}
+	if streamed.String() != "你好，世界" {
+		t.Errorf("streamed = %q", streamed.String())
+	}
+}
+
+func TestOpenAIChatCompletionsStreamInvalidChunk(t *testing.T) {
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":"ok"}}]}`+"\n\ndata: {broken\n\n")
+	})
+	stream, err := provider.GetChatCompletionsStream(context.Background(), ChatCompletionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := collectChatCompletionsStream(stream, func(models.ChatStreamDeltaDto) {})
+	if err == nil {
+		t.Fatal("collectChatCompletionsStream() succeeded with invalid chunk")
+	}
+	if got == nil || len(got.Choices) != 1 || got.Choices[0].Message.Text() != "ok" || got.Model != "default-model" {
+		t.Errorf("partial response = %+v", got)
+	}
+}
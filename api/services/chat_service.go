@@ -2,17 +2,17 @@ package services
 
 import (
 	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
 	"LaoQGChat/internal/myerrors"
-	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
@@ -21,37 +21,71 @@ import (
 type ChatService interface {
 	StartChat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto
 	Chat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto
+	StartChatStream(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto
+	ChatStream(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto
 	EndChat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto
+	ListSessions(ctx *gin.Context, inDto models.ChatSessionListInDto) *models.ChatSessionListOutDto
+	GetSession(ctx *gin.Context, inDto models.ChatInDto) *models.ChatSessionDetailDto
+	SelectChoice(ctx *gin.Context, inDto models.ChatSelectChoiceInDto) *models.ChatOutDto
+	ListModels(ctx *gin.Context) *models.ChatModelListDto
+	Close() error
 }
 
 type chatService struct {
-	azureOpenAIKey      string
-	modelDeploymentID   string
-	azureOpenAIEndpoint string
+	db               *sql.DB
+	provider         ChatProvider
+	usageService     UsageService
+	audioService     AudioService
+	ocrService       OCRService
+	imageService     ImageService
+	documentService  DocumentService
+	knowledgeService KnowledgeService
+	toolService      ToolService
+	catalog          *modelCatalog
 
 	getAllChatContexts  *sql.Stmt
 	getUserChatContexts *sql.Stmt
+	listChatContexts    *sql.Stmt
 	getChatContextById  *sql.Stmt
+	getChatRecordById   *sql.Stmt
 	insertChatContext   *sql.Stmt
 	updateChatContext   *sql.Stmt
+	lockChatContext     *sql.Stmt
 	deleteChatContext   *sql.Stmt
+	getChatMessages     *sql.Stmt
+	insertChatMessage   *sql.Stmt
+	getLastChatMessage  *sql.Stmt
+	selectChatChoice    *sql.Stmt
+	getPersonaById      *sql.Stmt
 }
 
-func NewChatService(db *sql.DB) ChatService {
+func NewChatService(db *sql.DB, provider ChatProvider, usageService UsageService, audioService AudioService, ocrService OCRService, imageService ImageService, documentService DocumentService, knowledgeService KnowledgeService, toolService ToolService, modelsConfig config.ModelsConfig, providerModel string) ChatService {
 	var (
 		err                 error
 		getAllChatContexts  *sql.Stmt
 		getUserChatContexts *sql.Stmt
+		listChatContexts    *sql.Stmt
 		getChatContextById  *sql.Stmt
+		getChatRecordById   *sql.Stmt
 		insertChatContext   *sql.Stmt
 		updateChatContext   *sql.Stmt
+		lockChatContext     *sql.Stmt
 		deleteChatContext   *sql.Stmt
+		getChatMessages     *sql.Stmt
+		insertChatMessage   *sql.Stmt
+		getLastChatMessage  *sql.Stmt
+		selectChatChoice    *sql.Stmt
+		getPersonaById      *sql.Stmt
 	)
 
+	// 按最后更新时间倒序分页，$1：游标的更新时间，$2：游标的SessionId，$3：件数
 	getAllChatContexts, err = db.Prepare(`
-		SELECT user_name, session_id
+		SELECT user_name, session_id, model, COALESCE(title, ''), COALESCE(preview, ''), message_count,
+		       create_timestamp, update_timestamp
 		FROM chat_record
-		ORDER BY user_name, create_timestamp`)
+		WHERE ($1::timestamp IS NULL OR (update_timestamp, session_id) < ($1::timestamp, $2::uuid))
+		ORDER BY update_timestamp DESC, session_id DESC
+		LIMIT $3`)
 	if err != nil {
 		return nil
 	}
@@ -65,8 +99,30 @@ func NewChatService(db *sql.DB) ChatService {
 		return nil
 	}
 
+	// 按最后更新时间倒序分页，$1：用户名，$2：游标的更新时间，$3：游标的SessionId，$4：件数
+	listChatContexts, err = db.Prepare(`
+		SELECT user_name, session_id, model, COALESCE(title, ''), COALESCE(preview, ''), message_count,
+		       create_timestamp, update_timestamp
+		FROM chat_record
+		WHERE user_name = $1
+		  AND ($2::timestamp IS NULL OR (update_timestamp, session_id) < ($2::timestamp, $3::uuid))
+		ORDER BY update_timestamp DESC, session_id DESC
+		LIMIT $4`)
+	if err != nil {
+		return nil
+	}
+
 	getChatContextById, err = db.Prepare(`
-		SELECT context
+		SELECT model, parameters, knowledge_base_id
+		FROM chat_record
+		WHERE session_id = $1`)
+	if err != nil {
+		return nil
+	}
+
+	getChatRecordById, err = db.Prepare(`
+		SELECT user_name, model, COALESCE(title, ''), COALESCE(preview, ''), message_count,
+		       create_timestamp, update_timestamp, knowledge_base_id
 		FROM chat_record
 		WHERE session_id = $1`)
 	if err != nil {
@@ -75,20 +131,31 @@ func NewChatService(db *sql.DB) ChatService {
 
 	insertChatContext, err = db.Prepare(`
 		INSERT INTO chat_record
-		(user_name, session_id, context, create_timestamp, update_timestamp)
-		VALUES ($1, $2, $3, $4, $4)`)
+		(user_name, session_id, create_timestamp, update_timestamp, title, preview, message_count, model, parameters,
+		 knowledge_base_id)
+		VALUES ($1, $2, $3, $3, $4, $5, $6, $7, $8, $9)`)
 	if err != nil {
 		return nil
 	}
 
 	updateChatContext, err = db.Prepare(`
 		UPDATE chat_record
-		SET context = $2, update_timestamp = $3
+		SET update_timestamp = $2, message_count = $3, knowledge_base_id = $4
 		WHERE session_id = $1`)
 	if err != nil {
 		return nil
 	}
 
+	// 锁定对话记录并返回下一条消息的序号，同一会话同时保存回答时按顺序追加
+	lockChatContext, err = db.Prepare(`
+		SELECT (SELECT COALESCE(max(sequence) + 1, 0) FROM chat_message WHERE session_id = $1)
+		FROM chat_record
+		WHERE session_id = $1
+		FOR UPDATE`)
+	if err != nil {
+		return nil
+	}
+
 	deleteChatContext, err = db.Prepare(`
 		DELETE FROM chat_record
 		WHERE session_id = $1`)
@@ -96,158 +163,230 @@ func NewChatService(db *sql.DB) ChatService {
 		return nil
 	}
 
+	getChatMessages, err = db.Prepare(`
+		SELECT role, content, model, tool_calls, tool_call_id, choices, choice_index, create_timestamp
+		FROM chat_message
+		WHERE session_id = $1
+		ORDER BY sequence`)
+	if err != nil {
+		return nil
+	}
+
+	// 回答的消息记录生成时的模型和使用的token数，其他消息为空值
+	// 要求调用工具的回答记录工具调用，工具消息记录对应的调用，有多个候选的回答记录所有候选
+	insertChatMessage, err = db.Prepare(`
+		INSERT INTO chat_message
+		(session_id, sequence, role, content, model, prompt_tokens, completion_tokens, create_timestamp,
+		 tool_calls, tool_call_id, choices, choice_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`)
+	if err != nil {
+		return nil
+	}
+
+	getLastChatMessage, err = db.Prepare(`
+		SELECT sequence, role, choices
+		FROM chat_message
+		WHERE session_id = $1
+		ORDER BY sequence DESC
+		LIMIT 1`)
+	if err != nil {
+		return nil
+	}
+
+	// $1：SessionId，$2：消息的序号，$3：候选的序号
+	selectChatChoice, err = db.Prepare(`
+		UPDATE chat_message
+		SET content = choices -> $3::integer, choice_index = $3::integer
+		WHERE session_id = $1 AND sequence = $2`)
+	if err != nil {
+		return nil
+	}
+
+	getPersonaById, err = db.Prepare(`
+		SELECT system_prompt, model, parameters
+		FROM persona
+		WHERE persona_id = $1`)
+	if err != nil {
+		return nil
+	}
+
 	service := &chatService{
-		azureOpenAIKey:      os.Getenv("AOAI_API_KEY"),
-		modelDeploymentID:   os.Getenv("AOAI_CHAT_COMPLETIONS_MODEL"),
-		azureOpenAIEndpoint: os.Getenv("AOAI_ENDPOINT"),
+		db:                  db,
+		provider:            provider,
+		usageService:        usageService,
+		audioService:        audioService,
+		ocrService:          ocrService,
+		imageService:        imageService,
+		documentService:     documentService,
+		knowledgeService:    knowledgeService,
+		toolService:         toolService,
+		catalog:             newModelCatalog(modelsConfig, providerModel),
 		getAllChatContexts:  getAllChatContexts,
 		getUserChatContexts: getUserChatContexts,
+		listChatContexts:    listChatContexts,
 		getChatContextById:  getChatContextById,
+		getChatRecordById:   getChatRecordById,
 		insertChatContext:   insertChatContext,
 		updateChatContext:   updateChatContext,
+		lockChatContext:     lockChatContext,
 		deleteChatContext:   deleteChatContext,
+		getChatMessages:     getChatMessages,
+		insertChatMessage:   insertChatMessage,
+		getLastChatMessage:  getLastChatMessage,
+		selectChatChoice:    selectChatChoice,
+		getPersonaById:      getPersonaById,
 	}
 	return service
 }
 
 func (service *chatService) StartChat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto {
+	return service.startChat(ctx, inDto, nil)
+}
+
+func (service *chatService) StartChatStream(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto {
+	return service.startChat(ctx, inDto, onDelta)
+}
+
+func (service *chatService) startChat(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto {
 	var (
-		userName       = ctx.GetString("UserName")
-		err            error
-		keyCredential  = azcore.NewKeyCredential(service.azureOpenAIKey)
-		currentTime    = time.Now()
-		sessionId      = uuid.New()
-		chatContextStr []byte
-		chatContext    models.ChatContext
-		outDto         = new(models.ChatOutDto)
+		userName      = ctx.GetString("UserName")
+		err           error
+		currentTime   = time.Now()
+		sessionId     = uuid.New()
+		parametersStr []byte
+		outDto        = new(models.ChatOutDto)
 	)
 
-	// azopenai认证
-	client, err := azopenai.NewClientWithKeyCredential(service.azureOpenAIEndpoint, keyCredential, nil)
+	// 角色和系统提示词
+	systemPrompt, requestModel, parameters, ok := service.sessionPersona(ctx, inDto)
+	if !ok {
+		return nil
+	}
+
+	// 会话使用的模型
+	model, deployment, err := service.catalog.resolve(requestModel, ctx.GetString("Permission"))
 	if err != nil {
-		err = &myerrors.CustomError{
-			StatusCode:  200,
-			MessageCode: "ECH01",
-			MessageText: "Azure OpenAI认证失败，请联系管理员。",
-		}
 		_ = ctx.Error(err)
 		return nil
 	}
+	if !checkChoiceCount(ctx, inDto.N) {
+		return nil
+	}
 
-	// 将inDto转为azopenai的输入
-	chatRequestUserMessage := inDto.ToAzopenai()
-	messages := []azopenai.ChatRequestMessageClassification{
-		&chatRequestUserMessage,
+	// 会话使用的知识库
+	if inDto.KnowledgeBaseId != uuid.Nil && !service.knowledgeService.CheckAccess(ctx, inDto.KnowledgeBaseId) {
+		return nil
 	}
 
-	// 发送azopenai请求
-	resp, err := client.GetChatCompletions(context.TODO(), azopenai.ChatCompletionsOptions{
-		Messages:       messages,
-		DeploymentName: &service.modelDeploymentID,
-	}, nil)
-	if err != nil {
-		err = &myerrors.CustomError{
-			StatusCode:  200,
-			MessageCode: "ECH02",
-			MessageText: "Azure OpenAI获取答案失败，请联系管理员。",
-		}
-		_ = ctx.Error(err)
+	// 检查引用的上传图片，识别问题中的语音和图片中的文字，提取文档的文字
+	if !service.imageService.CheckContents(ctx, inDto.Contents) {
 		return nil
 	}
-	if resp.Choices == nil || len(resp.Choices) == 0 {
-		err = &myerrors.CustomError{
-			StatusCode:  100,
-			MessageCode: "WCH01",
-			MessageText: "无法回答该问题。",
-		}
-		_ = ctx.Error(err)
+	transcripts, ok := service.audioService.TranscribeContents(ctx, sessionId, inDto.Contents)
+	if !ok || !service.ocrService.RecognizeContents(ctx, sessionId, inDto.Contents) ||
+		!service.documentService.ExtractContents(ctx, inDto.Contents) {
 		return nil
 	}
 
-	// 设置回答
-	answer := *resp.Choices[0].Message.Content
-	var choices = make([]string, 0)
-	if len(resp.Choices) > 1 {
-		for _, respChoice := range resp.Choices[1:] {
-			choices = append(choices, *respChoice.Message.Content)
-		}
+	// 将inDto转为对话消息，系统提示词作为第一条消息
+	question := inDto.ToChatMessage()
+	question.Timestamp = &currentTime
+	var messages []models.ChatMessage
+	if systemPrompt != "" {
+		systemMessage := models.NewChatMessageText(models.ChatRoleSystem, systemPrompt)
+		systemMessage.Timestamp = &currentTime
+		messages = append(messages, systemMessage)
 	}
+	messages = append(messages, question)
 
-	// TODO：设置选项
+	// 检索知识库
+	citations, ok := service.retrieveCitations(ctx, sessionId, inDto.KnowledgeBaseId, question)
+	if !ok {
+		return nil
+	}
 
-	//
-	chatContext = models.ChatContext{
-		ChatMessages: append(messages, &azopenai.ChatRequestAssistantMessage{
-			Content: to.Ptr(answer),
-		}),
+	// 发送模型服务请求
+	requestMessages, truncation, ok := service.fitContext(ctx, withCitations(messages, citations), model, parameters)
+	if !ok {
+		return nil
+	}
+	requestMessages, err = service.imageService.RequestMessages(ctx.Request.Context(), requestMessages)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
 	}
+	resp, toolMessages, ok := service.getAnswer(ctx, sessionId, ChatCompletionsRequest{
+		Model:      deployment,
+		Messages:   requestMessages,
+		Parameters: parameters,
+		N:          inDto.N,
+	}, onDelta)
+	if !ok {
+		return nil
+	}
+
+	// 设置回答，有多个候选时保存第一个候选，可以通过SelectChoice选择其他候选
+	answer, choices := answerWithChoices(resp)
+
+	// 工具调用和执行结果保存在问题和回答之间
+	messages = append(messages, toolMessages...)
+	messages = append(messages, answer)
 
-	// 插入对话上下文
-	chatContextStr, err = json.Marshal(chatContext)
+	// 插入对话记录和消息
+	parametersStr, err = json.Marshal(parameters)
 	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
-	_, err = service.insertChatContext.Exec(userName, sessionId, chatContextStr, currentTime)
+	title, preview := sessionSummary(question)
+	err = service.saveChatMessages(func(tx *sql.Tx) (int, error) {
+		_, err := tx.Stmt(service.insertChatContext).Exec(userName, sessionId, currentTime,
+			title, preview, len(messages), model, parametersStr, nullUUID(inDto.KnowledgeBaseId))
+		return 0, err
+	}, sessionId, messages, resp.Usage)
 	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
 
 	outDto.SessionId = sessionId
-	outDto.Answer = answer
+	outDto.Model = model
+	outDto.Answer = answer.Text()
 	outDto.Choices = choices
+	outDto.Transcripts = transcripts
+	outDto.Truncation = truncation
+	outDto.Citations = citations
+	outDto.ToolCalls = toolCallResults(toolMessages)
 	return outDto
 }
 
 func (service *chatService) Chat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto {
+	return service.chat(ctx, inDto, nil)
+}
+
+func (service *chatService) ChatStream(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto {
+	return service.chat(ctx, inDto, onDelta)
+}
+
+func (service *chatService) chat(ctx *gin.Context, inDto models.ChatInDto, onDelta func(delta models.ChatStreamDeltaDto)) *models.ChatOutDto {
 	var (
-		userName       = ctx.GetString("UserName")
-		permission     = ctx.GetString("Permission")
-		err            error
-		keyCredential  = azcore.NewKeyCredential(service.azureOpenAIKey)
-		currentTime    = time.Now()
-		sessionId      uuid.UUID
-		chatContextStr []byte
-		chatContext    models.ChatContext
-		outDto         = new(models.ChatOutDto)
+		err                    error
+		currentTime            = time.Now()
+		chatContext            models.ChatContext
+		sessionModel           string
+		sessionKnowledgeBaseId uuid.NullUUID
+		parametersStr          []byte
+		parameters             models.ChatParameters
+		outDto                 = new(models.ChatOutDto)
 	)
 
 	// 非管理员用户检测SessionId是否在自己的对话记录中
-	if permission != "super" {
-		rows, err := service.getUserChatContexts.Query(userName)
-		if err != nil {
-			err = &myerrors.CustomError{
-				StatusCode:  200,
-				MessageCode: "ECH03",
-				MessageText: "不存在该会话或该会话已被删除。",
-			}
-			_ = ctx.Error(err)
-			return nil
-		}
-		err = &myerrors.CustomError{
-			StatusCode:  200,
-			MessageCode: "ECH03",
-			MessageText: "不存在该会话或该会话已被删除。",
-		}
-		for rows.Next() {
-			if rows.Scan(&sessionId) != nil {
-				_ = ctx.Error(err)
-				return nil
-			}
-			if sessionId == inDto.SessionId {
-				err = nil
-				break
-			}
-		}
-		if err != nil {
-			_ = ctx.Error(err)
-			return nil
-		}
+	if !service.checkSessionOwner(ctx, inDto.SessionId) {
+		return nil
 	}
 
-	// 获取对话上下文
-	err = service.getChatContextById.QueryRow(inDto.SessionId).Scan(&chatContextStr)
+	// 获取会话的模型和生成参数
+	err = service.getChatContextById.QueryRow(inDto.SessionId).Scan(&sessionModel, &parametersStr, &sessionKnowledgeBaseId)
 	if err != nil {
 		err = &myerrors.CustomError{
 			StatusCode:  200,
@@ -258,7 +397,7 @@ func (service *chatService) Chat(ctx *gin.Context, inDto models.ChatInDto) *mode
 		return nil
 	}
 
-	err = json.Unmarshal(chatContextStr, &chatContext)
+	err = json.Unmarshal(parametersStr, &parameters)
 	if err != nil {
 		err = &myerrors.CustomError{
 			StatusCode:  990,
@@ -269,123 +408,731 @@ func (service *chatService) Chat(ctx *gin.Context, inDto models.ChatInDto) *mode
 		return nil
 	}
 
-	// azopenai认证
-	client, err := azopenai.NewClientWithKeyCredential(service.azureOpenAIEndpoint, keyCredential, nil)
+	// 未指定模型时使用会话的模型，会话的模型已从配置中删除时使用默认模型
+	requestModel := inDto.Model
+	if requestModel == "" && service.catalog.exists(sessionModel) {
+		requestModel = sessionModel
+	}
+	model, deployment, err := service.catalog.resolve(requestModel, ctx.GetString("Permission"))
 	if err != nil {
-		err = &myerrors.CustomError{
-			StatusCode:  200,
-			MessageCode: "ECH01",
-			MessageText: "Azure OpenAI认证失败，请联系管理员。",
+		_ = ctx.Error(err)
+		return nil
+	}
+	if !checkChoiceCount(ctx, inDto.N) {
+		return nil
+	}
+
+	// 指定知识库时替换会话的知识库
+	knowledgeBaseId := sessionKnowledgeBaseId.UUID
+	if inDto.KnowledgeBaseId != uuid.Nil {
+		if !service.knowledgeService.CheckAccess(ctx, inDto.KnowledgeBaseId) {
+			return nil
 		}
+		knowledgeBaseId = inDto.KnowledgeBaseId
+	}
+
+	// 检查引用的上传图片，识别问题中的语音和图片中的文字，提取文档的文字
+	if !service.imageService.CheckContents(ctx, inDto.Contents) {
+		return nil
+	}
+	transcripts, ok := service.audioService.TranscribeContents(ctx, inDto.SessionId, inDto.Contents)
+	if !ok || !service.ocrService.RecognizeContents(ctx, inDto.SessionId, inDto.Contents) ||
+		!service.documentService.ExtractContents(ctx, inDto.Contents) {
+		return nil
+	}
+
+	// 将inDto转为对话消息
+	question := inDto.ToChatMessage()
+	question.Timestamp = &currentTime
+	messages := []models.ChatMessage{
+		question,
+	}
+
+	// 由保存的消息重建对话上下文
+	chatContext, err = service.loadChatContext(inDto.SessionId)
+	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
 
-	// 将inDto转为azopenai的输入
-	chatRequestUserMessage := inDto.ToAzopenai()
-	messages := []azopenai.ChatRequestMessageClassification{
-		&chatRequestUserMessage,
+	// 将转换后的inDto拼接在原回答之后，开始会话时的系统提示词保持在第一条
+	history := chatContext.ChatMessages
+	messages = append(history, messages...)
+
+	// 检索知识库
+	citations, ok := service.retrieveCitations(ctx, inDto.SessionId, knowledgeBaseId, question)
+	if !ok {
+		return nil
 	}
 
-	// 将转换后的inDto拼接在原回答之后
-	messages = append(chatContext.ChatMessages, messages...)
-	resp, err := client.GetChatCompletions(context.TODO(), azopenai.ChatCompletionsOptions{
-		Messages:       messages,
-		DeploymentName: &service.modelDeploymentID,
-	}, nil)
+	requestMessages, truncation, ok := service.fitContext(ctx, withCitations(messages, citations), model, parameters)
+	if !ok {
+		return nil
+	}
+	requestMessages, err = service.imageService.RequestMessages(ctx.Request.Context(), requestMessages)
 	if err != nil {
-		err = &myerrors.CustomError{
-			StatusCode:  200,
-			MessageCode: "ECH02",
-			MessageText: "Azure OpenAI获取答案失败，请联系管理员。",
-		}
 		_ = ctx.Error(err)
 		return nil
 	}
-	if resp.Choices == nil || len(resp.Choices) == 0 {
-		err = &myerrors.CustomError{
-			StatusCode:  100,
-			MessageCode: "WCH01",
-			MessageText: "无法回答该问题。",
+	resp, toolMessages, ok := service.getAnswer(ctx, inDto.SessionId, ChatCompletionsRequest{
+		Model:      deployment,
+		Messages:   requestMessages,
+		Parameters: parameters,
+		N:          inDto.N,
+	}, onDelta)
+	if !ok {
+		return nil
+	}
+
+	answer, choices := answerWithChoices(resp)
+	messages = append(messages, toolMessages...)
+	messages = append(messages, answer)
+
+	// 更新对话记录，只追加本次的问题、工具调用和回答
+	// 同一会话的其他请求在读取历史消息之后保存了回答时，追加在其之后
+	newMessages := messages[len(history):]
+	err = service.saveChatMessages(func(tx *sql.Tx) (int, error) {
+		var sequence int
+		err := tx.Stmt(service.lockChatContext).QueryRow(inDto.SessionId).Scan(&sequence)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, &myerrors.CustomError{
+				StatusCode:  200,
+				MessageCode: "ECH03",
+				MessageText: "不存在该会话或该会话已被删除。",
+			}
+		}
+		if err != nil {
+			return 0, err
 		}
+		_, err = tx.Stmt(service.updateChatContext).Exec(inDto.SessionId, currentTime, sequence+len(newMessages),
+			nullUUID(knowledgeBaseId))
+		return sequence, err
+	}, inDto.SessionId, newMessages, resp.Usage)
+	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
 
-	answer := *resp.Choices[0].Message.Content
-	var choices = make([]string, 0)
-	if len(resp.Choices) > 1 {
-		for _, respChoice := range resp.Choices[1:] {
-			choices = append(choices, *respChoice.Message.Content)
-		}
+	outDto.SessionId = inDto.SessionId
+	outDto.Model = model
+	outDto.Answer = answer.Text()
+	outDto.Choices = choices
+	outDto.Transcripts = transcripts
+	outDto.Truncation = truncation
+	outDto.Citations = citations
+	outDto.ToolCalls = toolCallResults(toolMessages)
+	return outDto
+}
+
+func (service *chatService) GetSession(ctx *gin.Context, inDto models.ChatInDto) *models.ChatSessionDetailDto {
+	var (
+		err         error
+		chatContext models.ChatContext
+		outDto      = new(models.ChatSessionDetailDto)
+	)
+
+	// 非管理员用户检测SessionId是否在自己的对话记录中
+	if !service.checkSessionOwner(ctx, inDto.SessionId) {
+		return nil
 	}
-	chatContext.ChatMessages = append(
-		messages, &azopenai.ChatRequestAssistantMessage{
-			Content: to.Ptr(answer),
-		})
 
-	// 更新对话上下文
-	chatContextStr, err = json.Marshal(chatContext)
+	// 获取对话记录
+	var knowledgeBaseId uuid.NullUUID
+	err = service.getChatRecordById.QueryRow(inDto.SessionId).Scan(
+		&outDto.UserName, &outDto.Model, &outDto.Title, &outDto.Preview, &outDto.MessageCount,
+		&outDto.CreateTimestamp, &outDto.UpdateTimestamp, &knowledgeBaseId)
 	if err != nil {
 		err = &myerrors.CustomError{
-			StatusCode:  990,
-			MessageCode: "ECH90",
-			MessageText: "JSON序列化失败。",
+			StatusCode:  200,
+			MessageCode: "ECH03",
+			MessageText: "不存在该会话或该会话已被删除。",
 		}
 		_ = ctx.Error(err)
 		return nil
 	}
-	_, err = service.updateChatContext.Exec(inDto.SessionId, chatContextStr, currentTime)
+
+	chatContext, err = service.loadChatContext(inDto.SessionId)
 	if err != nil {
 		_ = ctx.Error(err)
 		return nil
 	}
 
 	outDto.SessionId = inDto.SessionId
-	outDto.Answer = answer
-	outDto.Choices = choices
+	if knowledgeBaseId.Valid {
+		outDto.KnowledgeBaseId = &knowledgeBaseId.UUID
+	}
+	outDto.Messages = make([]models.ChatMessageDto, 0, len(chatContext.ChatMessages))
+	for _, chatMessage := range chatContext.ChatMessages {
+		chatMessageDto := models.NewChatMessageDto(chatMessage)
+		// 上传的图片转为签名URL
+		for i := range chatMessageDto.Contents {
+			chatMessageDto.Contents[i].ImageUrl = service.imageService.ClientURL(chatMessageDto.Contents[i].ImageUrl)
+		}
+		outDto.Messages = append(outDto.Messages, chatMessageDto)
+	}
 	return outDto
 }
 
-func (service *chatService) EndChat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto {
+// SelectChoice 将会话最后一个回答保存的内容改为选择的候选，之后的对话以选择的候选作为上下文
+func (service *chatService) SelectChoice(ctx *gin.Context, inDto models.ChatSelectChoiceInDto) *models.ChatOutDto {
 	var (
-		userName   = ctx.GetString("UserName")
-		permission = ctx.GetString("Permission")
-		err        error
-		sessionId  uuid.UUID
+		err             error
+		sequence        int
+		role            models.ChatRole
+		choicesStr      []byte
+		choices         [][]models.ChatMessageContentPart
+		sessionModel    string
+		parametersStr   []byte
+		knowledgeBaseId uuid.NullUUID
+		outDto          = new(models.ChatOutDto)
 	)
 
 	// 非管理员用户检测SessionId是否在自己的对话记录中
-	if permission != "super" {
-		rows, err := service.getUserChatContexts.Query(userName)
+	if !service.checkSessionOwner(ctx, inDto.SessionId) {
+		return nil
+	}
+
+	// 只能选择最后一个回答的候选，之前的回答已作为上下文发送给模型服务
+	err = service.getLastChatMessage.QueryRow(inDto.SessionId).Scan(&sequence, &role, &choicesStr)
+	if err == nil {
+		err = json.Unmarshal(choicesStr, &choices)
+	}
+	if err != nil || role != models.ChatRoleAssistant || len(choices) == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH11",
+			MessageText: "该会话的最后一个回答没有候选回答。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if inDto.Index < 0 || inDto.Index >= len(choices) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH12",
+			MessageText: "不存在该候选回答。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	_, err = service.selectChatChoice.Exec(inDto.SessionId, sequence, inDto.Index)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	err = service.getChatContextById.QueryRow(inDto.SessionId).Scan(&sessionModel, &parametersStr, &knowledgeBaseId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	outDto.SessionId = inDto.SessionId
+	outDto.Model = sessionModel
+	outDto.Choices = make([]string, 0, len(choices))
+	for _, content := range choices {
+		choice := models.ChatMessage{Role: models.ChatRoleAssistant, Content: content}
+		outDto.Choices = append(outDto.Choices, choice.Text())
+	}
+	outDto.Answer = outDto.Choices[inDto.Index]
+	return outDto
+}
+
+// sessionPersona 返回开始会话时的系统提示词、模型名和生成参数，出错时设置错误并返回false
+// 模型的优先顺序为请求指定的模型、角色的模型、默认模型
+func (service *chatService) sessionPersona(ctx *gin.Context, inDto models.ChatInDto) (string, string, models.ChatParameters, bool) {
+	var (
+		err           error
+		systemPrompt  = inDto.SystemPrompt
+		requestModel  = inDto.Model
+		parameters    models.ChatParameters
+		personaPrompt string
+		personaModel  string
+		parametersStr []byte
+	)
+	if inDto.PersonaId != uuid.Nil {
+		err = service.getPersonaById.QueryRow(inDto.PersonaId).Scan(&personaPrompt, &personaModel, &parametersStr)
 		if err != nil {
 			err = &myerrors.CustomError{
 				StatusCode:  200,
-				MessageCode: "ECH03",
-				MessageText: "不存在该会话或该会话已被删除。",
+				MessageCode: "EPE02",
+				MessageText: "不存在该角色或该角色已被删除。",
 			}
 			_ = ctx.Error(err)
+			return "", "", parameters, false
 		}
-		err = errors.New("")
-		for rows.Next() {
-			if rows.Scan(&sessionId) != nil {
-				_ = ctx.Error(err)
+		if err = json.Unmarshal(parametersStr, &parameters); err != nil {
+			err = &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH91",
+				MessageText: "JSON反序列化失败。",
 			}
-			if sessionId == inDto.SessionId {
-				err = nil
-				break
+			_ = ctx.Error(err)
+			return "", "", parameters, false
+		}
+		if systemPrompt == "" {
+			systemPrompt = personaPrompt
+		}
+		if requestModel == "" && service.catalog.exists(personaModel) {
+			requestModel = personaModel
+		}
+	}
+
+	if utf8.RuneCountInString(systemPrompt) > maxSystemPromptLength {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH07",
+			MessageText: fmt.Sprintf("系统提示词不能超过%d个字符。", maxSystemPromptLength),
+		}
+		_ = ctx.Error(err)
+		return "", "", parameters, false
+	}
+	return systemPrompt, requestModel, parameters, true
+}
+
+// fitContext 历史消息超出模型的上下文长度时省略较早的内容，问题本身超出时设置ECH08并返回false
+func (service *chatService) fitContext(ctx *gin.Context, messages []models.ChatMessage, model string, parameters models.ChatParameters) ([]models.ChatMessage, *models.ChatTruncationDto, bool) {
+	requestMessages, truncation, ok := fitContext(messages, service.catalog.contextBudget(model, parameters))
+	if !ok {
+		err := &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH08",
+			MessageText: "问题过长，超出了模型的上下文长度。",
+		}
+		_ = ctx.Error(err)
+		return nil, nil, false
+	}
+	return requestMessages, truncation, true
+}
+
+// ListModels 返回当前用户可以使用的模型
+func (service *chatService) ListModels(ctx *gin.Context) *models.ChatModelListDto {
+	defaultModel, _, err := service.catalog.resolve("", ctx.GetString("Permission"))
+	if err != nil {
+		defaultModel = ""
+	}
+	outDto := &models.ChatModelListDto{
+		DefaultModel: defaultModel,
+		Models:       service.catalog.allowed(ctx.GetString("Permission")),
+	}
+	return outDto
+}
+
+// answerMessage 取第一个回答作为保存到对话上下文的消息
+func answerMessage(resp *ChatCompletionsResponse) models.ChatMessage {
+	answer := resp.Choices[0].Message
+	answerTime := time.Now()
+	answer.Timestamp = &answerTime
+	answer.Model = resp.Model
+	return answer
+}
+
+// answerWithChoices 取第一个候选作为保存的回答，有多个候选时在回答中保存所有候选的内容，并按顺序返回所有候选的文本
+func answerWithChoices(resp *ChatCompletionsResponse) (models.ChatMessage, []string) {
+	answer := answerMessage(resp)
+	choices := make([]string, 0)
+	if len(resp.Choices) > 1 {
+		for _, respChoice := range resp.Choices {
+			content := respChoice.Message.Content
+			if content == nil {
+				content = make([]models.ChatMessageContentPart, 0)
+			}
+			answer.Choices = append(answer.Choices, content)
+			choices = append(choices, respChoice.Message.Text())
+		}
+	}
+	return answer, choices
+}
+
+// checkChoiceCount 检查候选回答数，超出范围时设置ECH10
+func checkChoiceCount(ctx *gin.Context, n int) bool {
+	if n < 0 || n > maxChatChoices {
+		err := &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH10",
+			MessageText: fmt.Sprintf("候选回答数必须在1到%d之间。", maxChatChoices),
+		}
+		_ = ctx.Error(err)
+		return false
+	}
+	return true
+}
+
+// retrieveCitations 从知识库检索与问题相关的片段，没有知识库时返回空
+func (service *chatService) retrieveCitations(ctx *gin.Context, sessionId uuid.UUID, knowledgeBaseId uuid.UUID, question models.ChatMessage) ([]models.ChatCitationDto, bool) {
+	if knowledgeBaseId == uuid.Nil {
+		return nil, true
+	}
+	return service.knowledgeService.Retrieve(ctx, sessionId, knowledgeBaseId, question.Text())
+}
+
+// withCitations 将检索到的片段作为系统消息插入在本次的问题之前，只发送给模型服务，不保存到会话记录
+func withCitations(messages []models.ChatMessage, citations []models.ChatCitationDto) []models.ChatMessage {
+	if len(citations) == 0 {
+		return messages
+	}
+	var builder strings.Builder
+	builder.WriteString("以下是从知识库中检索到的与问题相关的内容。请优先根据这些内容回答，并在使用的内容后以[编号]标注来源；内容与问题无关时忽略。\n")
+	for _, citation := range citations {
+		fmt.Fprintf(&builder, "\n[%d] %s\n%s\n", citation.Index, citationSource(citation), citation.Text)
+	}
+
+	last := len(messages) - 1
+	result := make([]models.ChatMessage, 0, len(messages)+1)
+	result = append(result, messages[:last]...)
+	result = append(result, models.NewChatMessageText(models.ChatRoleSystem, builder.String()))
+	return append(result, messages[last])
+}
+
+// citationSource 片段的文件名和页码
+func citationSource(citation models.ChatCitationDto) string {
+	switch {
+	case citation.PageStart == 0:
+		return citation.FileName
+	case citation.PageStart == citation.PageEnd:
+		return fmt.Sprintf("%s 第%d页", citation.FileName, citation.PageStart)
+	default:
+		return fmt.Sprintf("%s 第%d-%d页", citation.FileName, citation.PageStart, citation.PageEnd)
+	}
+}
+
+// nullUUID uuid.Nil保存为NULL
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// loadChatContext 按顺序读取会话的消息，重建对话上下文
+func (service *chatService) loadChatContext(sessionId uuid.UUID) (models.ChatContext, error) {
+	var chatContext models.ChatContext
+	rows, err := service.getChatMessages.Query(sessionId)
+	if err != nil {
+		return chatContext, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			message      models.ChatMessage
+			contentStr   []byte
+			toolCallsStr []byte
+			choicesStr   []byte
+		)
+		err = rows.Scan(&message.Role, &contentStr, &message.Model, &toolCallsStr, &message.ToolCallId,
+			&choicesStr, &message.ChoiceIndex, &message.Timestamp)
+		if err != nil {
+			return chatContext, err
+		}
+		if err = json.Unmarshal(contentStr, &message.Content); err != nil {
+			return chatContext, &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH91",
+				MessageText: "JSON反序列化失败。",
+			}
+		}
+		if err = json.Unmarshal(toolCallsStr, &message.ToolCalls); err != nil {
+			return chatContext, &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH91",
+				MessageText: "JSON反序列化失败。",
+			}
+		}
+		if err = json.Unmarshal(choicesStr, &message.Choices); err != nil {
+			return chatContext, &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH91",
+				MessageText: "JSON反序列化失败。",
+			}
+		}
+		if len(message.ToolCalls) == 0 {
+			message.ToolCalls = nil
+		}
+		if len(message.Choices) == 0 {
+			message.Choices = nil
+		}
+		chatContext.ChatMessages = append(chatContext.ChatMessages, message)
+	}
+	if err = rows.Err(); err != nil {
+		return chatContext, err
+	}
+	return chatContext, nil
+}
+
+// saveChatMessages 在同一事务中保存对话记录和新增的消息，saveRecord返回第一条新消息的序号
+// 最后一条消息（回答）记录本次调用的token数，执行工具时为所有调用的合计
+func (service *chatService) saveChatMessages(saveRecord func(tx *sql.Tx) (int, error), sessionId uuid.UUID, messages []models.ChatMessage, usage ChatCompletionsUsage) error {
+	tx, err := service.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	sequence, err := saveRecord(tx)
+	if err != nil {
+		return err
+	}
+	insertChatMessage := tx.Stmt(service.insertChatMessage)
+	for i, message := range messages {
+		content := message.Content
+		if content == nil {
+			content = make([]models.ChatMessageContentPart, 0)
+		}
+		contentStr, err := json.Marshal(content)
+		if err != nil {
+			return &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH90",
+				MessageText: "JSON序列化失败。",
 			}
 		}
+		toolCalls := message.ToolCalls
+		if toolCalls == nil {
+			toolCalls = make([]models.ChatMessageToolCall, 0)
+		}
+		toolCallsStr, err := json.Marshal(toolCalls)
+		if err != nil {
+			return &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH90",
+				MessageText: "JSON序列化失败。",
+			}
+		}
+		choices := message.Choices
+		if choices == nil {
+			choices = make([][]models.ChatMessageContentPart, 0)
+		}
+		choicesStr, err := json.Marshal(choices)
+		if err != nil {
+			return &myerrors.CustomError{
+				StatusCode:  990,
+				MessageCode: "ECH90",
+				MessageText: "JSON序列化失败。",
+			}
+		}
+		var promptTokens, completionTokens int
+		if i == len(messages)-1 && message.Role == models.ChatRoleAssistant {
+			promptTokens, completionTokens = usage.PromptTokens, usage.CompletionTokens
+		}
+		_, err = insertChatMessage.Exec(sessionId, sequence+i, message.Role, contentStr, message.Model,
+			promptTokens, completionTokens, message.Timestamp, toolCallsStr, message.ToolCallId,
+			choicesStr, message.ChoiceIndex)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkSessionOwner 非管理员用户检测SessionId是否在自己的对话记录中，不在时设置ECH03
+func (service *chatService) checkSessionOwner(ctx *gin.Context, sessionId uuid.UUID) bool {
+	var (
+		userName      = ctx.GetString("UserName")
+		permission    = ctx.GetString("Permission")
+		userSessionId uuid.UUID
+		err           error
+	)
+	if permission == "super" {
+		return true
+	}
+
+	err = &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "ECH03",
+		MessageText: "不存在该会话或该会话已被删除。",
+	}
+	rows, queryErr := service.getUserChatContexts.Query(userName)
+	if queryErr != nil {
+		_ = ctx.Error(err)
+		return false
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		if rows.Scan(&userSessionId) != nil {
+			_ = ctx.Error(err)
+			return false
+		}
+		if userSessionId == sessionId {
+			return true
+		}
+	}
+	_ = ctx.Error(err)
+	return false
+}
+
+// getChatCompletions 获取回答并记录使用量，onDelta不为nil时使用流式接口并逐段回调onDelta
+func (service *chatService) getChatCompletions(ctx *gin.Context, sessionId uuid.UUID, request ChatCompletionsRequest, onDelta func(delta models.ChatStreamDeltaDto)) (*ChatCompletionsResponse, error) {
+	var (
+		resp      *ChatCompletionsResponse
+		err       error
+		stream    ChatCompletionsStream
+		startTime = time.Now()
+	)
+	if onDelta == nil {
+		resp, err = service.provider.GetChatCompletions(ctx.Request.Context(), request)
+	} else {
+		stream, err = service.provider.GetChatCompletionsStream(ctx.Request.Context(), request)
+		if err == nil {
+			resp, err = collectChatCompletionsStream(stream, onDelta)
+		}
+	}
+
+	// 模型服务没有返回用量时（azure的流式接口、中途断开的流式回答）按请求和已生成的回答估算
+	if resp != nil && resp.Usage.TotalTokens == 0 {
+		resp.Usage = estimateUsage(request, resp)
+	}
+
+	// 成功和失败的调用都记录，记录失败不影响回答
+	// 要求调用工具的调用记录为工具调用的中间步骤，一个问题只在得到回答的调用计入提问次数
+	record := UsageRecord{
+		UserName:  ctx.GetString("UserName"),
+		SessionId: sessionId,
+		Model:     request.Model,
+		Latency:   time.Since(startTime),
+	}
+	if err == nil && len(resp.Choices) > 0 && len(resp.Choices[0].Message.ToolCalls) > 0 {
+		record.Kind = UsageKindToolStep
+	}
+	switch {
+	case err != nil:
+		if resp != nil {
+			record.Usage = resp.Usage
+		}
+		record.ErrorCode = "ECH02"
+	case len(resp.Choices) == 0:
+		record.Model = resp.Model
+		record.Usage = resp.Usage
+		record.ErrorCode = "WCH01"
+	default:
+		record.Model = resp.Model
+		record.Usage = resp.Usage
+		record.FinishReason = resp.Choices[0].FinishReason
+	}
+	_ = service.usageService.RecordUsage(record)
+
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// getAnswer 获取回答，回答要求调用工具时执行工具并将结果发送给模型服务，直到得到不调用工具的回答，出错时设置错误并返回false
+// 工具调用达到最大轮数后要求模型直接回答，返回的用量为所有调用的合计，要求调用工具的回答和工具消息按顺序返回
+func (service *chatService) getAnswer(ctx *gin.Context, sessionId uuid.UUID, request ChatCompletionsRequest, onDelta func(delta models.ChatStreamDeltaDto)) (*ChatCompletionsResponse, []models.ChatMessage, bool) {
+	var (
+		toolMessages []models.ChatMessage
+		usage        ChatCompletionsUsage
+	)
+	request.Tools = service.toolService.Definitions()
+	for step := 0; ; step++ {
+		if len(request.Tools) > 0 && step >= service.toolService.MaxSteps() {
+			request.ToolChoice = "none"
+		}
+		// 增量标记所在的轮数，要求调用工具的轮次的文本不是回答，与工具调用一起保存
+		stepDelta := onDelta
+		if onDelta != nil {
+			currentStep := step
+			stepDelta = func(delta models.ChatStreamDeltaDto) {
+				delta.Step = currentStep
+				onDelta(delta)
+			}
+		}
+		resp, err := service.getChatCompletions(ctx, sessionId, request, stepDelta)
 		if err != nil {
 			err = &myerrors.CustomError{
 				StatusCode:  200,
-				MessageCode: "ECH03",
-				MessageText: "不存在该会话或该会话已被删除。",
+				MessageCode: "ECH02",
+				MessageText: "模型服务获取答案失败，请联系管理员。",
 			}
 			_ = ctx.Error(err)
-			return nil
+			return nil, nil, false
+		}
+		if resp.Choices == nil || len(resp.Choices) == 0 {
+			err = &myerrors.CustomError{
+				StatusCode:  100,
+				MessageCode: "WCH01",
+				MessageText: "无法回答该问题。",
+			}
+			_ = ctx.Error(err)
+			return nil, nil, false
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+
+		if len(resp.Choices[0].Message.ToolCalls) == 0 {
+			// 只执行第一个候选的工具调用，其他候选要求调用的工具不执行也不保存
+			for i := 1; i < len(resp.Choices); i++ {
+				resp.Choices[i].Message.ToolCalls = nil
+			}
+			resp.Usage = usage
+			return resp, toolMessages, true
+		}
+		// 没有发送工具或已要求直接回答时仍然调用工具
+		if len(request.Tools) == 0 || request.ToolChoice == "none" {
+			err = &myerrors.CustomError{
+				StatusCode:  200,
+				MessageCode: "ECH09",
+				MessageText: "工具调用次数超过上限，未能得到回答。",
+			}
+			_ = ctx.Error(err)
+			return nil, nil, false
+		}
+
+		// 执行工具，将要求调用工具的回答和执行结果追加到请求中
+		toolCallMessage := answerMessage(resp)
+		stepMessages := []models.ChatMessage{toolCallMessage}
+		for _, toolCall := range toolCallMessage.ToolCalls {
+			stepMessages = append(stepMessages, service.toolService.Execute(ctx.Request.Context(), toolCall))
+		}
+		request.Messages = append(request.Messages, stepMessages...)
+		toolMessages = append(toolMessages, stepMessages...)
+
+		// 通知客户端该轮已经流式返回的文本不是回答
+		if onDelta != nil {
+			onDelta(models.ChatStreamDeltaDto{
+				Step:      step,
+				ToolCalls: toolCallResults(stepMessages),
+			})
 		}
 	}
+}
+
+// toolCallResults 按顺序返回本次执行的工具调用和执行结果
+func toolCallResults(toolMessages []models.ChatMessage) []models.ChatToolCallDto {
+	results := make(map[string]string)
+	for _, message := range toolMessages {
+		if message.Role == models.ChatRoleTool {
+			results[message.ToolCallId] = message.Text()
+		}
+	}
+	var toolCalls []models.ChatToolCallDto
+	for _, message := range toolMessages {
+		for _, toolCall := range message.ToolCalls {
+			toolCalls = append(toolCalls, models.ChatToolCallDto{
+				Id:        toolCall.Id,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+				Result:    results[toolCall.Id],
+			})
+		}
+	}
+	return toolCalls
+}
+
+func (service *chatService) EndChat(ctx *gin.Context, inDto models.ChatInDto) *models.ChatOutDto {
+	var (
+		err error
+	)
+
+	// 非管理员用户检测SessionId是否在自己的对话记录中
+	if !service.checkSessionOwner(ctx, inDto.SessionId) {
+		return nil
+	}
 
 	// 删除对话上下文
 	_, err = service.deleteChatContext.Exec(inDto.SessionId)
@@ -400,3 +1147,155 @@ func (service *chatService) EndChat(ctx *gin.Context, inDto models.ChatInDto) *m
 	}
 	return nil
 }
+
+func (service *chatService) ListSessions(ctx *gin.Context, inDto models.ChatSessionListInDto) *models.ChatSessionListOutDto {
+	var (
+		userName   = ctx.GetString("UserName")
+		permission = ctx.GetString("Permission")
+		err        error
+		rows       *sql.Rows
+		limit      = inDto.Limit
+		cursorTime any
+		cursorId   any
+		outDto     = &models.ChatSessionListOutDto{Sessions: make([]models.ChatSessionDto, 0)}
+	)
+
+	if limit <= 0 {
+		limit = defaultSessionListLimit
+	}
+	limit = min(limit, maxSessionListLimit)
+
+	// 解析游标
+	if inDto.Cursor != "" {
+		updateTimestamp, sessionId, err := decodeSessionCursor(inDto.Cursor)
+		if err != nil {
+			err = &myerrors.CustomError{
+				StatusCode:  200,
+				MessageCode: "ECH04",
+				MessageText: "分页游标格式错误。",
+			}
+			_ = ctx.Error(err)
+			return nil
+		}
+		cursorTime, cursorId = updateTimestamp, sessionId
+	}
+
+	// 多取一件用于判断是否有下一页，管理员可以查看所有用户的会话
+	if permission == "super" {
+		rows, err = service.getAllChatContexts.Query(cursorTime, cursorId, limit+1)
+	} else {
+		rows, err = service.listChatContexts.Query(userName, cursorTime, cursorId, limit+1)
+	}
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var session models.ChatSessionDto
+		err = rows.Scan(&session.UserName, &session.SessionId, &session.Model, &session.Title, &session.Preview,
+			&session.MessageCount, &session.CreateTimestamp, &session.UpdateTimestamp)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		outDto.Sessions = append(outDto.Sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	if len(outDto.Sessions) > limit {
+		outDto.Sessions = outDto.Sessions[:limit]
+		last := outDto.Sessions[limit-1]
+		outDto.NextCursor = encodeSessionCursor(last.UpdateTimestamp, last.SessionId)
+	}
+	return outDto
+}
+
+func (service *chatService) Close() error {
+	return errors.Join(
+		service.getAllChatContexts.Close(),
+		service.getUserChatContexts.Close(),
+		service.listChatContexts.Close(),
+		service.getChatContextById.Close(),
+		service.getChatRecordById.Close(),
+		service.insertChatContext.Close(),
+		service.updateChatContext.Close(),
+		service.lockChatContext.Close(),
+		service.deleteChatContext.Close(),
+		service.getChatMessages.Close(),
+		service.insertChatMessage.Close(),
+		service.getLastChatMessage.Close(),
+		service.selectChatChoice.Close(),
+		service.getPersonaById.Close(),
+	)
+}
+
+const (
+	defaultSessionListLimit = 20
+	maxSessionListLimit     = 100
+
+	maxSystemPromptLength = 4000
+
+	// maxChatChoices 每次最多请求的候选回答数
+	maxChatChoices = 5
+
+	sessionTitleLength   = 20
+	sessionPreviewLength = 100
+
+	// 与timestamp without time zone的精度一致
+	sessionCursorTimeLayout = "2006-01-02T15:04:05.999999"
+)
+
+// sessionSummary 由第一个问题生成会话标题和预览
+func sessionSummary(question models.ChatMessage) (string, string) {
+	text := strings.Join(strings.Fields(question.Text()), " ")
+	if text == "" {
+		for _, part := range question.Content {
+			if part.Type == models.ChatMessageContentPartTypeImage {
+				text = "[图片]"
+				break
+			}
+		}
+	}
+	return truncateRunes(text, sessionTitleLength), truncateRunes(text, sessionPreviewLength)
+}
+
+func truncateRunes(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length])
+}
+
+// encodeSessionCursor 游标由最后一件的更新时间和SessionId组成
+func encodeSessionCursor(updateTimestamp time.Time, sessionId uuid.UUID) string {
+	cursor := updateTimestamp.Format(sessionCursorTimeLayout) + "|" + sessionId.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeSessionCursor(cursor string) (time.Time, uuid.UUID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	timePart, idPart, found := strings.Cut(string(data), "|")
+	if !found {
+		return time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	updateTimestamp, err := time.Parse(sessionCursorTimeLayout, timePart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	sessionId, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return updateTimestamp, sessionId, nil
+}
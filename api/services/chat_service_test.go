@@ -0,0 +1,88 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionCursor(t *testing.T) {
+	sessionId := uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e")
+	tests := []struct {
+		name            string
+		updateTimestamp time.Time
+	}{
+		{"微秒", time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)},
+		{"整秒", time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"末尾为0的小数", time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC)},
+	}
+	for _, test := range tests {
+		cursor := encodeSessionCursor(test.updateTimestamp, sessionId)
+		updateTimestamp, gotId, err := decodeSessionCursor(cursor)
+		if err != nil {
+			t.Errorf("%s: decodeSessionCursor(%q) error = %v", test.name, cursor, err)
+			continue
+		}
+		if !updateTimestamp.Equal(test.updateTimestamp) || gotId != sessionId {
+			t.Errorf("%s: decodeSessionCursor() = (%v, %v), want (%v, %v)", test.name, updateTimestamp, gotId, test.updateTimestamp, sessionId)
+		}
+	}
+}
+
+func TestSessionCursorTruncatesToMicroseconds(t *testing.T) {
+	// 与数据库的精度一致，纳秒部分舍去
+	updateTimestamp := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	got, _, err := decodeSessionCursor(encodeSessionCursor(updateTimestamp, uuid.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := updateTimestamp.Truncate(time.Microsecond); !got.Equal(want) {
+		t.Errorf("decodeSessionCursor() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeSessionCursorInvalid(t *testing.T) {
+	encode := func(text string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(text))
+	}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"不是base64", "!!!"},
+		{"有填充的base64", base64.URLEncoding.EncodeToString([]byte("2024-05-06T07:08:09|x"))},
+		{"没有分隔符", encode("2024-05-06T07:08:09")},
+		{"时间格式错误", encode("2024/05/06|0f8fad5b-d9cb-469f-a165-70867728950e")},
+		{"SessionId格式错误", encode("2024-05-06T07:08:09|not-a-uuid")},
+	}
+	for _, test := range tests {
+		if _, _, err := decodeSessionCursor(test.cursor); err == nil {
+			t.Errorf("%s: decodeSessionCursor(%q) succeeded", test.name, test.cursor)
+		}
+	}
+}
+
+func TestSessionSummary(t *testing.T) {
+	tests := []struct {
+		name        string
+		question    models.ChatMessage
+		wantTitle   string
+		wantPreview string
+	}{
+		{"合并空白", models.NewChatMessageText(models.ChatRoleUser, "  hello \n\t world "), "hello world", "hello world"},
+		{"标题按字符截断", models.NewChatMessageText(models.ChatRoleUser, "一二三四五六七八九十一二三四五六七八九十一二"), "一二三四五六七八九十一二三四五六七八九十", "一二三四五六七八九十一二三四五六七八九十一二"},
+		{"只有图片", models.ChatMessage{
+			Role:    models.ChatRoleUser,
+			Content: []models.ChatMessageContentPart{models.NewChatMessageContentPartImage("https://example.com/a.png")},
+		}, "[图片]", "[图片]"},
+	}
+	for _, test := range tests {
+		title, preview := sessionSummary(test.question)
+		if title != test.wantTitle || preview != test.wantPreview {
+			t.Errorf("%s: sessionSummary() = (%q, %q), want (%q, %q)", test.name, title, preview, test.wantTitle, test.wantPreview)
+		}
+	}
+}
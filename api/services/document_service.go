@@ -0,0 +1,130 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/documents"
+	"LaoQGChat/internal/myerrors"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DocumentService interface {
+	// ExtractContents 提取问题中文档的文字并分割为片段，出错时设置错误并返回false
+	ExtractContents(ctx *gin.Context, contents []models.ChatQuestionContentPartsDto) bool
+}
+
+type documentService struct {
+	maxBytes   int64
+	maxChars   int
+	chunkChars int
+}
+
+func NewDocumentService(documentsConfig config.DocumentsConfig) DocumentService {
+	service := &documentService{
+		maxBytes:   documentsConfig.MaxBytes,
+		maxChars:   documentsConfig.MaxChars,
+		chunkChars: documentsConfig.ChunkChars,
+	}
+	return service
+}
+
+func (service *documentService) ExtractContents(ctx *gin.Context, contents []models.ChatQuestionContentPartsDto) bool {
+	for _, content := range contents {
+		documentContent, ok := content.(*models.ChatQuestionContentPartsDtoDocument)
+		if !ok {
+			continue
+		}
+		document, err := service.extract(documentContent.Data, documentContent.FileName)
+		if err != nil {
+			_ = ctx.Error(err)
+			return false
+		}
+		documentContent.Document = document
+	}
+	return true
+}
+
+// extract 解码文档，按内容检测格式，提取文字并按页分割
+func (service *documentService) extract(data string, fileName string) (*models.ChatMessageDocument, error) {
+	document, err := decodeMediaData(data, service.maxBytes)
+	if errors.Is(err, errMediaTooLarge) {
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO03",
+			MessageText: fmt.Sprintf("文档不能超过%s。", formatBytes(service.maxBytes)),
+		}
+	}
+	if err != nil {
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO01",
+			MessageText: "文档数据格式错误。",
+		}
+	}
+
+	fileName = documentFileName(fileName)
+	mimeType, err := documents.Detect(document, fileName)
+	if err != nil {
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO02",
+			MessageText: "不支持的文档格式，请上传PDF、DOCX、Markdown或纯文本文档。",
+		}
+	}
+
+	pages, err := documents.Extract(document, mimeType)
+	if err != nil {
+		fmt.Println("文档解析失败：", fileName, err)
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO05",
+			MessageText: "文档解析失败，请确认文档没有损坏或加密。",
+		}
+	}
+	if documents.CountChars(pages) > service.maxChars {
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO04",
+			MessageText: fmt.Sprintf("文档内容不能超过%d字。", service.maxChars),
+		}
+	}
+	chunks := documents.Split(pages, service.chunkChars)
+	if len(chunks) == 0 {
+		return nil, &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EDO06",
+			MessageText: "没有提取到文档中的文字，扫描件请转为图片后使用ImageOCR。",
+		}
+	}
+
+	result := &models.ChatMessageDocument{
+		FileName: fileName,
+		MimeType: mimeType,
+		Chunks:   make([]models.ChatMessageDocumentChunk, 0, len(chunks)),
+	}
+	if len(pages) > 0 {
+		result.Pages = pages[len(pages)-1].Number
+	}
+	for _, chunk := range chunks {
+		result.Chunks = append(result.Chunks, models.ChatMessageDocumentChunk{
+			PageStart: chunk.PageStart,
+			PageEnd:   chunk.PageEnd,
+			Text:      chunk.Text,
+		})
+	}
+	return result, nil
+}
+
+// documentFileName 去掉客户端文件名中的路径，没有文件名时返回“文档”
+func documentFileName(fileName string) string {
+	fileName = filepath.Base(strings.ReplaceAll(strings.TrimSpace(fileName), "\\", "/"))
+	if fileName == "." || fileName == "/" {
+		return "文档"
+	}
+	return fileName
+}
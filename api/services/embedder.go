@@ -0,0 +1,120 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder 向量模型接口，屏蔽不同向量模型服务的差异
+type Embedder interface {
+	// Model 向量模型的名称，知识库记录创建时的模型，模型不同的向量不能比较
+	Model() string
+	// Embed 按顺序返回每段文本的向量
+	Embed(ctx context.Context, texts []string) (*EmbeddingsResponse, error)
+}
+
+type EmbeddingsResponse struct {
+	Vectors [][]float32
+	// PromptTokens 模型服务返回的token数，没有返回时为0
+	PromptTokens int
+}
+
+// localEmbedderDimensions local向量的默认维数
+const localEmbedderDimensions = 512
+
+// NewEmbedder 根据配置创建向量模型服务，knowledge.embedder为none时返回nil
+func NewEmbedder(knowledgeConfig config.KnowledgeConfig, providerConfig config.ProviderConfig) (Embedder, error) {
+	embedder := knowledgeConfig.Embedder
+	if embedder == "provider" {
+		embedder = providerConfig.Type
+	}
+	switch embedder {
+	case "azure":
+		return newAzureEmbedder(knowledgeConfig, providerConfig)
+	case "openai":
+		return newOpenAIEmbedder(knowledgeConfig, providerConfig)
+	case "local", "fake":
+		dimensions := knowledgeConfig.Dimensions
+		if dimensions == 0 {
+			dimensions = localEmbedderDimensions
+		}
+		return &localEmbedder{dimensions: dimensions}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("不支持的向量模型服务：%s", knowledgeConfig.Embedder)
+	}
+}
+
+// localEmbedder 进程内的向量模型，将英文单词和中文的单字、相邻两字哈希到固定维数
+// 只能按字面匹配，用于开发和测试
+type localEmbedder struct {
+	dimensions int
+}
+
+func (embedder *localEmbedder) Model() string {
+	return fmt.Sprintf("local-hash-%d", embedder.dimensions)
+}
+
+func (embedder *localEmbedder) Embed(_ context.Context, texts []string) (*EmbeddingsResponse, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		counts := make(map[string]int)
+		for _, term := range localTerms(text) {
+			counts[term]++
+		}
+		vector := make([]float32, embedder.dimensions)
+		for term, count := range counts {
+			hash := fnv.New64a()
+			_, _ = hash.Write([]byte(term))
+			sum := hash.Sum64()
+			// 最高位决定符号，减少哈希冲突的影响
+			weight := float32(1 + math.Log(float64(count)))
+			if sum>>63 == 1 {
+				weight = -weight
+			}
+			vector[sum%uint64(embedder.dimensions)] += weight
+		}
+		vectors = append(vectors, vector)
+	}
+	return &EmbeddingsResponse{Vectors: vectors}, nil
+}
+
+// localTerms 英文和数字按单词，中文等其他文字按单字和相邻两字
+func localTerms(text string) []string {
+	var (
+		terms []string
+		word  []rune
+		prev  rune
+	)
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, r)
+			prev = 0
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			flushWord()
+			terms = append(terms, string(r))
+			if prev != 0 {
+				terms = append(terms, string([]rune{prev, r}))
+			}
+			prev = r
+		default:
+			flushWord()
+			prev = 0
+		}
+	}
+	flushWord()
+	return terms
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// azureEmbedder Azure OpenAI的embeddings部署
+type azureEmbedder struct {
+	client         *azopenai.Client
+	deploymentName string
+	dimensions     int
+	timeout        time.Duration
+}
+
+func newAzureEmbedder(knowledgeConfig config.KnowledgeConfig, providerConfig config.ProviderConfig) (Embedder, error) {
+	keyCredential := azcore.NewKeyCredential(providerConfig.APIKey)
+	client, err := azopenai.NewClientWithKeyCredential(providerConfig.Endpoint, keyCredential, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureEmbedder{
+		client:         client,
+		deploymentName: knowledgeConfig.Model,
+		dimensions:     knowledgeConfig.Dimensions,
+		timeout:        providerConfig.Timeout,
+	}, nil
+}
+
+func (embedder *azureEmbedder) Model() string {
+	return embedder.deploymentName
+}
+
+func (embedder *azureEmbedder) Embed(ctx context.Context, texts []string) (*EmbeddingsResponse, error) {
+	if embedder.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, embedder.timeout)
+		defer cancel()
+	}
+
+	options := azopenai.EmbeddingsOptions{
+		Input:          texts,
+		DeploymentName: to.Ptr(embedder.deploymentName),
+		EncodingFormat: to.Ptr(azopenai.EmbeddingEncodingFormatFloat),
+	}
+	if embedder.dimensions > 0 {
+		options.Dimensions = to.Ptr(int32(embedder.dimensions))
+	}
+	resp, err := embedder.client.GetEmbeddings(ctx, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按Index还原输入的顺序
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index == nil || int(*item.Index) < 0 || int(*item.Index) >= len(texts) {
+			return nil, errors.New("invalid embedding index")
+		}
+		vectors[*item.Index] = item.Embedding
+	}
+	for _, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, errors.New("missing embedding")
+		}
+	}
+	response := &EmbeddingsResponse{Vectors: vectors}
+	if resp.Usage != nil {
+		response.PromptTokens = int32Value(resp.Usage.PromptTokens)
+	}
+	return response, nil
+}
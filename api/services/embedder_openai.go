@@ -0,0 +1,96 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// openAIEmbedder OpenAI兼容的embeddings接口（OpenAI、llama.cpp、vLLM等）
+type openAIEmbedder struct {
+	client     *http.Client
+	endpoint   string
+	apiKey     string
+	model      string
+	dimensions int
+}
+
+type openAIEmbeddingsRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage *struct {
+		PromptTokens int `json:"prompt_tokens"`
+	} `json:"usage"`
+}
+
+func newOpenAIEmbedder(knowledgeConfig config.KnowledgeConfig, providerConfig config.ProviderConfig) (Embedder, error) {
+	return &openAIEmbedder{
+		client:     &http.Client{Timeout: providerConfig.Timeout},
+		endpoint:   strings.TrimRight(providerConfig.Endpoint, "/"),
+		apiKey:     providerConfig.APIKey,
+		model:      knowledgeConfig.Model,
+		dimensions: knowledgeConfig.Dimensions,
+	}, nil
+}
+
+func (embedder *openAIEmbedder) Model() string {
+	return embedder.model
+}
+
+func (embedder *openAIEmbedder) Embed(ctx context.Context, texts []string) (*EmbeddingsResponse, error) {
+	body, err := json.Marshal(openAIEmbeddingsRequest{
+		Model:          embedder.model,
+		Input:          texts,
+		EncodingFormat: "float",
+		Dimensions:     embedder.dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := openAIPost(ctx, embedder.client, embedder.endpoint, embedder.apiKey,
+		"/embeddings", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var embeddings openAIEmbeddingsResponse
+	if err = json.NewDecoder(resp.Body).Decode(&embeddings); err != nil {
+		return nil, err
+	}
+	// 按index还原输入的顺序
+	vectors := make([][]float32, len(texts))
+	for _, item := range embeddings.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("invalid embedding index: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for _, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, errors.New("missing embedding")
+		}
+	}
+	response := &EmbeddingsResponse{Vectors: vectors}
+	if embeddings.Usage != nil {
+		response.PromptTokens = embeddings.Usage.PromptTokens
+	}
+	return response, nil
+}
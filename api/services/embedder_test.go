@@ -0,0 +1,94 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLocalTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Hello, World 42", []string{"hello", "world", "42"}},
+		{"知识库", []string{"知", "识", "知识", "库", "识库"}},
+		{"Go语言v2", []string{"go", "语", "言", "语言", "v2"}},
+		{"中，文", []string{"中", "文"}},
+	}
+	for _, test := range tests {
+		if got := localTerms(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("localTerms(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestLocalEmbedder(t *testing.T) {
+	embedder, err := NewEmbedder(config.KnowledgeConfig{Embedder: "local", Dimensions: 64}, config.ProviderConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder.Model() != "local-hash-64" {
+		t.Errorf("Model() = %q", embedder.Model())
+	}
+
+	texts := []string{"数据库迁移的步骤", "如何执行数据库迁移", "今天天气很好", "数据库迁移的步骤"}
+	resp, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Vectors) != len(texts) {
+		t.Fatalf("got %d vectors, want %d", len(resp.Vectors), len(texts))
+	}
+	vectors := make([][]float64, len(resp.Vectors))
+	for i, vector := range resp.Vectors {
+		if len(vector) != 64 {
+			t.Fatalf("vector %d has %d dimensions, want 64", i, len(vector))
+		}
+		for _, value := range vector {
+			vectors[i] = append(vectors[i], float64(value))
+		}
+	}
+
+	// 相同的文本向量相同，字面相近的文本比无关的文本更相似
+	if !reflect.DeepEqual(vectors[0], vectors[3]) {
+		t.Error("same text produced different vectors")
+	}
+	related := cosineSimilarity(vectors[0], vectors[1])
+	unrelated := cosineSimilarity(vectors[0], vectors[2])
+	if related <= unrelated {
+		t.Errorf("similarity of related texts %v <= unrelated %v", related, unrelated)
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	tests := []struct {
+		name      string
+		knowledge config.KnowledgeConfig
+		provider  config.ProviderConfig
+		wantModel string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{"local使用默认维数", config.KnowledgeConfig{Embedder: "local"}, config.ProviderConfig{}, "local-hash-512", false, false},
+		{"fake模型服务使用local", config.KnowledgeConfig{Embedder: "provider"}, config.ProviderConfig{Type: "fake"}, "local-hash-512", false, false},
+		{"none", config.KnowledgeConfig{Embedder: "none"}, config.ProviderConfig{}, "", true, false},
+		{"不支持", config.KnowledgeConfig{Embedder: "other"}, config.ProviderConfig{}, "", true, true},
+	}
+	for _, test := range tests {
+		embedder, err := NewEmbedder(test.knowledge, test.provider)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if (embedder == nil) != test.wantNil {
+			t.Errorf("%s: embedder = %v, wantNil %v", test.name, embedder, test.wantNil)
+			continue
+		}
+		if embedder != nil && embedder.Model() != test.wantModel {
+			t.Errorf("%s: Model() = %q, want %q", test.name, embedder.Model(), test.wantModel)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+type ImageService interface {
+	Upload(ctx *gin.Context, inDto models.ImageUploadInDto) *models.ImageUploadOutDto
+	// Get 验证签名URL并返回图片和格式，签名无效、已过期或图片不存在时返回false
+	Get(ctx *gin.Context, inDto models.ImageGetInDto) ([]byte, string, bool)
+	// CheckContents 检查问题中引用的上传图片是否存在且由当前用户上传过，否则设置EIM05并返回false
+	CheckContents(ctx *gin.Context, contents []models.ChatQuestionContentPartsDto) bool
+	// Load 读取上传的图片
+	Load(ctx context.Context, imageId string) ([]byte, error)
+	// RequestMessages 将消息中上传图片的引用转为data URL或签名URL，发送给模型服务
+	RequestMessages(ctx context.Context, messages []models.ChatMessage) ([]models.ChatMessage, error)
+	// ClientURL 将上传图片的引用转为返回给客户端的签名URL，其他URL原样返回
+	ClientURL(imageUrl string) string
+	Close() error
+}
+
+type imageService struct {
+	store         BlobStore
+	maxBytes      int64
+	delivery      string
+	publicURL     string
+	signingSecret []byte
+	urlTTL        time.Duration
+
+	insertImage     *sql.Stmt
+	insertImageUser *sql.Stmt
+	getImage        *sql.Stmt
+	checkImageUser  *sql.Stmt
+}
+
+// imageMimeTypes 可以上传的图片格式，与模型服务支持的格式一致
+var imageMimeTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+}
+
+func NewImageService(db *sql.DB, store BlobStore, imagesConfig config.ImagesConfig) ImageService {
+	var (
+		err             error
+		insertImage     *sql.Stmt
+		insertImageUser *sql.Stmt
+		getImage        *sql.Stmt
+		checkImageUser  *sql.Stmt
+	)
+	// 相同内容的图片已存在时不更新
+	insertImage, err = db.Prepare(`
+		INSERT INTO image
+		(image_id, mime_type, size_bytes, user_name, create_timestamp)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (image_id) DO NOTHING`)
+	if err != nil {
+		return nil
+	}
+	// 图片按内容去重，每个上传过的用户都记录，已记录时不更新
+	insertImageUser, err = db.Prepare(`
+		INSERT INTO image_user
+		(image_id, user_name, create_timestamp)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (image_id, user_name) DO NOTHING`)
+	if err != nil {
+		return nil
+	}
+	getImage, err = db.Prepare(`
+		SELECT mime_type
+		FROM image
+		WHERE image_id = $1`)
+	if err != nil {
+		return nil
+	}
+	checkImageUser, err = db.Prepare(`
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM image_user
+		    WHERE image_id = $1 AND user_name = $2
+		)`)
+	if err != nil {
+		return nil
+	}
+
+	// 未配置密钥时随机生成，重启后以前的签名URL失效
+	signingSecret := []byte(imagesConfig.SigningSecret)
+	if len(signingSecret) == 0 {
+		signingSecret = make([]byte, 32)
+		if _, err = rand.Read(signingSecret); err != nil {
+			return nil
+		}
+	}
+
+	service := &imageService{
+		store:           store,
+		maxBytes:        imagesConfig.MaxBytes,
+		delivery:        imagesConfig.Delivery,
+		publicURL:       strings.TrimRight(imagesConfig.PublicURL, "/"),
+		signingSecret:   signingSecret,
+		urlTTL:          imagesConfig.URLTTL,
+		insertImage:     insertImage,
+		insertImageUser: insertImageUser,
+		getImage:        getImage,
+		checkImageUser:  checkImageUser,
+	}
+	return service
+}
+
+func (service *imageService) Upload(ctx *gin.Context, inDto models.ImageUploadInDto) *models.ImageUploadOutDto {
+	var (
+		userName    = ctx.GetString("UserName")
+		currentTime = time.Now()
+		image       []byte
+		err         error
+	)
+
+	// 读取图片
+	if inDto.File != nil {
+		if inDto.File.Size > service.maxBytes {
+			_ = ctx.Error(service.mediaError(errMediaTooLarge))
+			return nil
+		}
+		file, openErr := inDto.File.Open()
+		if openErr != nil {
+			_ = ctx.Error(service.mediaError(errMediaFormat))
+			return nil
+		}
+		image, err = readMedia(file, service.maxBytes)
+		_ = file.Close()
+	} else {
+		image, err = decodeMediaData(inDto.Data, service.maxBytes)
+	}
+	if err != nil {
+		_ = ctx.Error(service.mediaError(err))
+		return nil
+	}
+
+	// 按内容检测图片格式
+	mime := mimetype.Detect(image)
+	supported := false
+	for _, mimeType := range imageMimeTypes {
+		if mime.Is(mimeType) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EIM02",
+			MessageText: fmt.Sprintf("不支持的图片格式：%s。", mime.String()),
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	// 相同内容的图片只保存一份
+	hash := sha256.Sum256(image)
+	imageId := hex.EncodeToString(hash[:])
+	exists, err := service.store.Exists(ctx.Request.Context(), imageId)
+	if err == nil && !exists {
+		err = service.store.Put(ctx.Request.Context(), imageId, image)
+	}
+	if err == nil {
+		_, err = service.insertImage.Exec(imageId, mime.String(), len(image), userName, currentTime)
+	}
+	if err == nil {
+		_, err = service.insertImageUser.Exec(imageId, userName, currentTime)
+	}
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EIM04",
+			MessageText: "图片保存失败，请联系管理员。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	imageUrl, expireTime := service.signedURL(imageId)
+	outDto := &models.ImageUploadOutDto{
+		ImageId:    imageId,
+		MimeType:   mime.String(),
+		Size:       int64(len(image)),
+		Url:        imageUrl,
+		ExpireTime: expireTime,
+	}
+	return outDto
+}
+
+func (service *imageService) Get(ctx *gin.Context, inDto models.ImageGetInDto) ([]byte, string, bool) {
+	if !validImageId(inDto.ImageId) || time.Now().Unix() > inDto.Expires {
+		return nil, "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(inDto.Signature)
+	if err != nil || !hmac.Equal(signature, service.sign(inDto.ImageId, inDto.Expires)) {
+		return nil, "", false
+	}
+
+	var mimeType string
+	if err = service.getImage.QueryRow(inDto.ImageId).Scan(&mimeType); err != nil {
+		return nil, "", false
+	}
+	image, err := service.store.Get(ctx.Request.Context(), inDto.ImageId)
+	if err != nil {
+		return nil, "", false
+	}
+	return image, mimeType, true
+}
+
+func (service *imageService) CheckContents(ctx *gin.Context, contents []models.ChatQuestionContentPartsDto) bool {
+	userName := ctx.GetString("UserName")
+	for _, content := range contents {
+		var imageId string
+		switch imageContent := content.(type) {
+		case *models.ChatQuestionContentPartsDtoImage:
+			imageId = imageContent.ImageId
+		case *models.ChatQuestionContentPartsDtoImageOCR:
+			imageId = imageContent.ImageId
+		}
+		if imageId == "" {
+			continue
+		}
+
+		// 其他用户上传的图片与不存在的图片同样处理，不泄露图片是否存在
+		var uploaded bool
+		if validImageId(imageId) {
+			_ = service.checkImageUser.QueryRow(imageId, userName).Scan(&uploaded)
+		}
+		if !uploaded {
+			err := &myerrors.CustomError{
+				StatusCode:  200,
+				MessageCode: "EIM05",
+				MessageText: "不存在该图片。",
+			}
+			_ = ctx.Error(err)
+			return false
+		}
+	}
+	return true
+}
+
+func (service *imageService) Load(ctx context.Context, imageId string) ([]byte, error) {
+	if !validImageId(imageId) {
+		return nil, errMediaFormat
+	}
+	return service.store.Get(ctx, imageId)
+}
+
+func (service *imageService) RequestMessages(ctx context.Context, messages []models.ChatMessage) ([]models.ChatMessage, error) {
+	result := make([]models.ChatMessage, 0, len(messages))
+	for _, message := range messages {
+		var contents []models.ChatMessageContentPart
+		for i, part := range message.Content {
+			if part.Type != models.ChatMessageContentPartTypeImage || part.ImageURL == nil {
+				continue
+			}
+			imageId, ok := models.ParseImageRef(part.ImageURL.URL)
+			if !ok {
+				continue
+			}
+
+			imageUrl, err := service.requestURL(ctx, imageId)
+			if err != nil {
+				return nil, &myerrors.CustomError{
+					StatusCode:  200,
+					MessageCode: "EIM05",
+					MessageText: "不存在该图片。",
+				}
+			}
+			// 不修改保存到对话上下文的消息
+			if contents == nil {
+				contents = append([]models.ChatMessageContentPart(nil), message.Content...)
+			}
+			imageURL := *part.ImageURL
+			imageURL.URL = imageUrl
+			contents[i].ImageURL = &imageURL
+		}
+		if contents != nil {
+			message.Content = contents
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
+
+func (service *imageService) ClientURL(imageUrl string) string {
+	imageId, ok := models.ParseImageRef(imageUrl)
+	if !ok {
+		return imageUrl
+	}
+	signedURL, _ := service.signedURL(imageId)
+	return signedURL
+}
+
+func (service *imageService) Close() error {
+	return errors.Join(
+		service.insertImage.Close(),
+		service.insertImageUser.Close(),
+		service.getImage.Close(),
+		service.checkImageUser.Close(),
+	)
+}
+
+// requestURL 返回发送给模型服务的图片URL
+func (service *imageService) requestURL(ctx context.Context, imageId string) (string, error) {
+	if service.delivery == "signed" {
+		signedURL, _ := service.signedURL(imageId)
+		return signedURL, nil
+	}
+
+	var mimeType string
+	if err := service.getImage.QueryRow(imageId).Scan(&mimeType); err != nil {
+		return "", err
+	}
+	image, err := service.Load(ctx, imageId)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image), nil
+}
+
+// signedURL 返回带签名的短期URL和过期时间，未配置public_url时为相对路径
+func (service *imageService) signedURL(imageId string) (string, time.Time) {
+	expireTime := time.Now().Add(service.urlTTL)
+	expires := expireTime.Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {base64.RawURLEncoding.EncodeToString(service.sign(imageId, expires))},
+	}
+	return service.publicURL + "/Image/Get/" + imageId + "?" + query.Encode(), expireTime
+}
+
+func (service *imageService) sign(imageId string, expires int64) []byte {
+	mac := hmac.New(sha256.New, service.signingSecret)
+	mac.Write([]byte(imageId + "\n" + strconv.FormatInt(expires, 10)))
+	return mac.Sum(nil)
+}
+
+// mediaError 将读取数据的错误转为EIM01或EIM03
+func (service *imageService) mediaError(err error) error {
+	if errors.Is(err, errMediaTooLarge) {
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EIM03",
+			MessageText: fmt.Sprintf("图片不能超过%s。", formatBytes(service.maxBytes)),
+		}
+	}
+	return &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EIM01",
+		MessageText: "图片数据格式错误。",
+	}
+}
+
+// validImageId 图片ID为64位小写十六进制的SHA-256
+func validImageId(imageId string) bool {
+	if len(imageId) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range imageId {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,857 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/documents"
+	"LaoQGChat/internal/myerrors"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type KnowledgeService interface {
+	ListKnowledgeBases(ctx *gin.Context) *models.KnowledgeBaseListDto
+	CreateKnowledgeBase(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeBaseDto
+	DeleteKnowledgeBase(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeBaseDto
+	ListDocuments(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeDocumentListDto
+	UploadDocument(ctx *gin.Context, inDto models.KnowledgeDocumentUploadInDto) *models.KnowledgeDocumentDto
+	DeleteDocument(ctx *gin.Context, inDto models.KnowledgeDocumentDto) *models.KnowledgeDocumentDto
+	Search(ctx *gin.Context, inDto models.KnowledgeSearchInDto) *models.KnowledgeSearchOutDto
+	// CheckAccess 检查是否可以在对话中使用知识库，不能使用时设置错误并返回false
+	CheckAccess(ctx *gin.Context, knowledgeBaseId uuid.UUID) bool
+	// Retrieve 检索与query相关的片段，按会话记录生成向量的使用量，出错时设置错误并返回false，知识库没有文档时返回空
+	Retrieve(ctx *gin.Context, sessionId uuid.UUID, knowledgeBaseId uuid.UUID, query string) ([]models.ChatCitationDto, bool)
+	Close() error
+}
+
+type knowledgeService struct {
+	db *sql.DB
+	// embedder 为nil时不支持知识库
+	embedder     Embedder
+	usageService UsageService
+	pgvector     bool
+	chunkChars   int
+	batchSize    int
+	topK         int
+	minScore     float64
+	maxBytes     int64
+	maxChunks    int
+
+	listKnowledgeBases  *sql.Stmt
+	getKnowledgeBase    *sql.Stmt
+	insertKnowledgeBase *sql.Stmt
+	updateKnowledgeBase *sql.Stmt
+	deleteKnowledgeBase *sql.Stmt
+	listDocuments       *sql.Stmt
+	getDocument         *sql.Stmt
+	insertDocument      *sql.Stmt
+	deleteDocument      *sql.Stmt
+	insertChunk         *sql.Stmt
+	searchChunks        *sql.Stmt
+}
+
+// knowledgeBaseInfo 检查权限和向量模型时使用的知识库信息
+type knowledgeBaseInfo struct {
+	userName       string
+	shared         bool
+	embeddingModel string
+	// dimensions 第一次上传文档时设置，没有文档时为0
+	dimensions int
+}
+
+// maxQueryChars 检索时使用的问题的最大字符数
+const maxQueryChars = 2000
+
+func NewKnowledgeService(db *sql.DB, embedder Embedder, usageService UsageService, knowledgeConfig config.KnowledgeConfig) (KnowledgeService, error) {
+	var (
+		err                 error
+		pgvector            bool
+		listKnowledgeBases  *sql.Stmt
+		getKnowledgeBase    *sql.Stmt
+		insertKnowledgeBase *sql.Stmt
+		updateKnowledgeBase *sql.Stmt
+		deleteKnowledgeBase *sql.Stmt
+		listDocuments       *sql.Stmt
+		getDocument         *sql.Stmt
+		insertDocument      *sql.Stmt
+		deleteDocument      *sql.Stmt
+		insertChunk         *sql.Stmt
+		searchChunks        *sql.Stmt
+	)
+
+	// pgvector已启用时在数据库中检索
+	if knowledgeConfig.VectorSearch != "brute_force" {
+		err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')`).Scan(&pgvector)
+		if err != nil {
+			return nil, fmt.Errorf("检查pgvector扩展失败：%w", err)
+		}
+		if !pgvector && knowledgeConfig.VectorSearch == "pgvector" {
+			return nil, errors.New("knowledge.vector_search为pgvector，但数据库没有安装vector扩展")
+		}
+	}
+
+	// 自己的知识库和共享的知识库，$2为true（管理员）时返回所有知识库
+	listKnowledgeBases, err = db.Prepare(`
+		SELECT base.knowledge_base_id, base.user_name, base.name, base.description, base.shared, base.embedding_model,
+		       (SELECT COUNT(*) FROM knowledge_document AS document
+		        WHERE document.knowledge_base_id = base.knowledge_base_id),
+		       (SELECT COALESCE(SUM(document.chunk_count), 0) FROM knowledge_document AS document
+		        WHERE document.knowledge_base_id = base.knowledge_base_id),
+		       base.create_timestamp, base.update_timestamp
+		FROM knowledge_base AS base
+		WHERE base.user_name = $1 OR base.shared OR $2
+		ORDER BY base.name, base.create_timestamp`)
+	if err != nil {
+		return nil, err
+	}
+	getKnowledgeBase, err = db.Prepare(`
+		SELECT user_name, shared, embedding_model, dimensions
+		FROM knowledge_base
+		WHERE knowledge_base_id = $1`)
+	if err != nil {
+		return nil, err
+	}
+	insertKnowledgeBase, err = db.Prepare(`
+		INSERT INTO knowledge_base
+		(knowledge_base_id, user_name, name, description, shared, embedding_model, dimensions,
+		 create_timestamp, update_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $7)`)
+	if err != nil {
+		return nil, err
+	}
+	updateKnowledgeBase, err = db.Prepare(`
+		UPDATE knowledge_base
+		SET dimensions = $2, update_timestamp = $3
+		WHERE knowledge_base_id = $1`)
+	if err != nil {
+		return nil, err
+	}
+	deleteKnowledgeBase, err = db.Prepare(
+		"DELETE FROM knowledge_base WHERE knowledge_base_id = $1")
+	if err != nil {
+		return nil, err
+	}
+	listDocuments, err = db.Prepare(`
+		SELECT document_id, file_name, mime_type, size_bytes, pages, chunk_count, user_name, create_timestamp
+		FROM knowledge_document
+		WHERE knowledge_base_id = $1
+		ORDER BY create_timestamp, file_name`)
+	if err != nil {
+		return nil, err
+	}
+	getDocument, err = db.Prepare(`
+		SELECT knowledge_base_id
+		FROM knowledge_document
+		WHERE document_id = $1`)
+	if err != nil {
+		return nil, err
+	}
+	insertDocument, err = db.Prepare(`
+		INSERT INTO knowledge_document
+		(document_id, knowledge_base_id, file_name, mime_type, size_bytes, pages, chunk_count, user_name,
+		 create_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return nil, err
+	}
+	deleteDocument, err = db.Prepare(
+		"DELETE FROM knowledge_document WHERE document_id = $1")
+	if err != nil {
+		return nil, err
+	}
+	insertChunk, err = db.Prepare(`
+		INSERT INTO knowledge_chunk
+		(document_id, chunk_index, knowledge_base_id, page_start, page_end, content, embedding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		return nil, err
+	}
+	if pgvector {
+		// 余弦距离按相似度排序，$2：问题的向量，$3：件数
+		searchChunks, err = db.Prepare(`
+			SELECT chunk.document_id, document.file_name, chunk.page_start, chunk.page_end, chunk.content,
+			       1 - (chunk.embedding::vector <=> $2::real[]::vector)
+			FROM knowledge_chunk AS chunk
+			JOIN knowledge_document AS document ON document.document_id = chunk.document_id
+			WHERE chunk.knowledge_base_id = $1
+			ORDER BY chunk.embedding::vector <=> $2::real[]::vector
+			LIMIT $3`)
+	} else {
+		// 读取知识库的所有片段，在服务端计算相似度
+		searchChunks, err = db.Prepare(`
+			SELECT chunk.document_id, document.file_name, chunk.page_start, chunk.page_end, chunk.content,
+			       chunk.embedding
+			FROM knowledge_chunk AS chunk
+			JOIN knowledge_document AS document ON document.document_id = chunk.document_id
+			WHERE chunk.knowledge_base_id = $1`)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service := &knowledgeService{
+		db:                  db,
+		embedder:            embedder,
+		usageService:        usageService,
+		pgvector:            pgvector,
+		chunkChars:          knowledgeConfig.ChunkChars,
+		batchSize:           knowledgeConfig.BatchSize,
+		topK:                knowledgeConfig.TopK,
+		minScore:            knowledgeConfig.MinScore,
+		maxBytes:            knowledgeConfig.MaxBytes,
+		maxChunks:           knowledgeConfig.MaxChunks,
+		listKnowledgeBases:  listKnowledgeBases,
+		getKnowledgeBase:    getKnowledgeBase,
+		insertKnowledgeBase: insertKnowledgeBase,
+		updateKnowledgeBase: updateKnowledgeBase,
+		deleteKnowledgeBase: deleteKnowledgeBase,
+		listDocuments:       listDocuments,
+		getDocument:         getDocument,
+		insertDocument:      insertDocument,
+		deleteDocument:      deleteDocument,
+		insertChunk:         insertChunk,
+		searchChunks:        searchChunks,
+	}
+	return service, nil
+}
+
+func (service *knowledgeService) ListKnowledgeBases(ctx *gin.Context) *models.KnowledgeBaseListDto {
+	var (
+		err    error
+		rows   *sql.Rows
+		outDto = &models.KnowledgeBaseListDto{KnowledgeBases: make([]models.KnowledgeBaseDto, 0)}
+	)
+	rows, err = service.listKnowledgeBases.Query(ctx.GetString("UserName"), ctx.GetString("Permission") == "super")
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var knowledgeBase models.KnowledgeBaseDto
+		err = rows.Scan(&knowledgeBase.KnowledgeBaseId, &knowledgeBase.UserName, &knowledgeBase.Name,
+			&knowledgeBase.Description, &knowledgeBase.Shared, &knowledgeBase.EmbeddingModel,
+			&knowledgeBase.DocumentCount, &knowledgeBase.ChunkCount,
+			&knowledgeBase.CreateTimestamp, &knowledgeBase.UpdateTimestamp)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		outDto.KnowledgeBases = append(outDto.KnowledgeBases, knowledgeBase)
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+func (service *knowledgeService) CreateKnowledgeBase(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeBaseDto {
+	var (
+		err         error
+		userName    = ctx.GetString("UserName")
+		currentTime = time.Now()
+	)
+	if !service.checkEnabled(ctx) {
+		return nil
+	}
+
+	inDto.Name = strings.TrimSpace(inDto.Name)
+	if inDto.Name == "" {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB03",
+			MessageText: "知识库名称不能为空。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if inDto.Shared && ctx.GetString("Permission") != "super" {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB04",
+			MessageText: "只有管理员可以创建共享知识库。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	inDto.KnowledgeBaseId = uuid.New()
+	inDto.UserName = userName
+	inDto.EmbeddingModel = service.embedder.Model()
+	_, err = service.insertKnowledgeBase.Exec(inDto.KnowledgeBaseId, userName, inDto.Name, inDto.Description,
+		inDto.Shared, inDto.EmbeddingModel, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	inDto.DocumentCount = 0
+	inDto.ChunkCount = 0
+	inDto.CreateTimestamp = currentTime
+	inDto.UpdateTimestamp = currentTime
+	return &inDto
+}
+
+func (service *knowledgeService) DeleteKnowledgeBase(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeBaseDto {
+	if _, ok := service.loadKnowledgeBase(ctx, inDto.KnowledgeBaseId, true); !ok {
+		return nil
+	}
+	// 文档和片段级联删除，使用该知识库的会话不再检索
+	if _, err := service.deleteKnowledgeBase.Exec(inDto.KnowledgeBaseId); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *knowledgeService) ListDocuments(ctx *gin.Context, inDto models.KnowledgeBaseDto) *models.KnowledgeDocumentListDto {
+	var (
+		err    error
+		rows   *sql.Rows
+		outDto = &models.KnowledgeDocumentListDto{Documents: make([]models.KnowledgeDocumentDto, 0)}
+	)
+	if _, ok := service.loadKnowledgeBase(ctx, inDto.KnowledgeBaseId, false); !ok {
+		return nil
+	}
+
+	rows, err = service.listDocuments.Query(inDto.KnowledgeBaseId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		document := models.KnowledgeDocumentDto{KnowledgeBaseId: inDto.KnowledgeBaseId}
+		err = rows.Scan(&document.DocumentId, &document.FileName, &document.MimeType, &document.Size,
+			&document.Pages, &document.ChunkCount, &document.UserName, &document.CreateTimestamp)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		outDto.Documents = append(outDto.Documents, document)
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+func (service *knowledgeService) UploadDocument(ctx *gin.Context, inDto models.KnowledgeDocumentUploadInDto) *models.KnowledgeDocumentDto {
+	var (
+		err         error
+		userName    = ctx.GetString("UserName")
+		currentTime = time.Now()
+		data        []byte
+		fileName    = inDto.FileName
+	)
+	if !service.checkEnabled(ctx) {
+		return nil
+	}
+	knowledgeBaseId, err := uuid.Parse(inDto.KnowledgeBaseId)
+	if err != nil {
+		_ = ctx.Error(knowledgeBaseNotFound())
+		return nil
+	}
+	knowledgeBase, ok := service.loadKnowledgeBase(ctx, knowledgeBaseId, true)
+	if !ok || !service.checkEmbeddingModel(ctx, knowledgeBase) {
+		return nil
+	}
+
+	// 读取文档
+	if inDto.File != nil {
+		fileName = inDto.File.Filename
+		if inDto.File.Size > service.maxBytes {
+			_ = ctx.Error(service.mediaError(errMediaTooLarge))
+			return nil
+		}
+		file, openErr := inDto.File.Open()
+		if openErr != nil {
+			_ = ctx.Error(service.mediaError(errMediaFormat))
+			return nil
+		}
+		data, err = readMedia(file, service.maxBytes)
+		_ = file.Close()
+	} else {
+		data, err = decodeMediaData(inDto.Data, service.maxBytes)
+	}
+	if err != nil {
+		_ = ctx.Error(service.mediaError(err))
+		return nil
+	}
+
+	// 提取文字并分割为片段
+	fileName = documentFileName(fileName)
+	mimeType, err := documents.Detect(data, fileName)
+	if err != nil {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB06",
+			MessageText: "不支持的文档格式，请上传PDF、DOCX、Markdown或纯文本文档。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	pages, err := documents.Extract(data, mimeType)
+	if err != nil {
+		fmt.Println("文档解析失败：", fileName, err)
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB08",
+			MessageText: "文档解析失败，请确认文档没有损坏或加密。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	chunks := documents.Split(pages, service.chunkChars)
+	if len(chunks) == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB09",
+			MessageText: "没有提取到文档中的文字。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if len(chunks) > service.maxChunks {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB10",
+			MessageText: fmt.Sprintf("文档内容过多（超过%d个片段），请拆分后上传。", service.maxChunks),
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	// 分批生成向量
+	embeddings := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += service.batchSize {
+		end := min(start+service.batchSize, len(chunks))
+		texts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			texts = append(texts, chunk.Text)
+		}
+		vectors, ok := service.embed(ctx, uuid.Nil, knowledgeBase, texts)
+		if !ok {
+			return nil
+		}
+		embeddings = append(embeddings, vectors...)
+		knowledgeBase.dimensions = len(vectors[0])
+	}
+
+	outDto := &models.KnowledgeDocumentDto{
+		DocumentId:      uuid.New(),
+		KnowledgeBaseId: knowledgeBaseId,
+		FileName:        fileName,
+		MimeType:        mimeType,
+		Size:            int64(len(data)),
+		ChunkCount:      len(chunks),
+		UserName:        userName,
+		CreateTimestamp: currentTime,
+	}
+	if len(pages) > 0 {
+		outDto.Pages = pages[len(pages)-1].Number
+	}
+
+	// 文档和片段在同一事务中保存
+	err = service.saveDocument(outDto, chunks, embeddings, knowledgeBase.dimensions)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+func (service *knowledgeService) DeleteDocument(ctx *gin.Context, inDto models.KnowledgeDocumentDto) *models.KnowledgeDocumentDto {
+	var knowledgeBaseId uuid.UUID
+	err := service.getDocument.QueryRow(inDto.DocumentId).Scan(&knowledgeBaseId)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB14",
+			MessageText: "不存在该文档或该文档已被删除。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	knowledgeBase, ok := service.loadKnowledgeBase(ctx, knowledgeBaseId, true)
+	if !ok {
+		return nil
+	}
+
+	// 片段级联删除
+	if _, err = service.deleteDocument.Exec(inDto.DocumentId); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if _, err = service.updateKnowledgeBase.Exec(knowledgeBaseId, knowledgeBase.dimensions, time.Now()); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+func (service *knowledgeService) Search(ctx *gin.Context, inDto models.KnowledgeSearchInDto) *models.KnowledgeSearchOutDto {
+	if strings.TrimSpace(inDto.Query) == "" {
+		err := &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB15",
+			MessageText: "检索内容不能为空。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	citations, ok := service.Retrieve(ctx, uuid.Nil, inDto.KnowledgeBaseId, inDto.Query)
+	if !ok {
+		return nil
+	}
+	if citations == nil {
+		citations = make([]models.ChatCitationDto, 0)
+	}
+	return &models.KnowledgeSearchOutDto{Citations: citations}
+}
+
+func (service *knowledgeService) CheckAccess(ctx *gin.Context, knowledgeBaseId uuid.UUID) bool {
+	if !service.checkEnabled(ctx) {
+		return false
+	}
+	knowledgeBase, ok := service.loadKnowledgeBase(ctx, knowledgeBaseId, false)
+	return ok && service.checkEmbeddingModel(ctx, knowledgeBase)
+}
+
+func (service *knowledgeService) Retrieve(ctx *gin.Context, sessionId uuid.UUID, knowledgeBaseId uuid.UUID, query string) ([]models.ChatCitationDto, bool) {
+	if !service.checkEnabled(ctx) {
+		return nil, false
+	}
+	knowledgeBase, ok := service.loadKnowledgeBase(ctx, knowledgeBaseId, false)
+	if !ok || !service.checkEmbeddingModel(ctx, knowledgeBase) {
+		return nil, false
+	}
+	// 问题没有文字（只有图片等）或知识库还没有文档时不检索
+	query = truncateRunes(strings.TrimSpace(query), maxQueryChars)
+	if query == "" || knowledgeBase.dimensions == 0 {
+		return nil, true
+	}
+
+	vectors, ok := service.embed(ctx, sessionId, knowledgeBase, []string{query})
+	if !ok {
+		return nil, false
+	}
+	citations, err := service.search(knowledgeBaseId, vectors[0])
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil, false
+	}
+	return citations, true
+}
+
+func (service *knowledgeService) Close() error {
+	return errors.Join(
+		service.listKnowledgeBases.Close(),
+		service.getKnowledgeBase.Close(),
+		service.insertKnowledgeBase.Close(),
+		service.updateKnowledgeBase.Close(),
+		service.deleteKnowledgeBase.Close(),
+		service.listDocuments.Close(),
+		service.getDocument.Close(),
+		service.insertDocument.Close(),
+		service.deleteDocument.Close(),
+		service.insertChunk.Close(),
+		service.searchChunks.Close(),
+	)
+}
+
+// checkEnabled 未配置向量模型时设置EKB01
+func (service *knowledgeService) checkEnabled(ctx *gin.Context) bool {
+	if service.embedder != nil {
+		return true
+	}
+	err := &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EKB01",
+		MessageText: "未启用知识库。",
+	}
+	_ = ctx.Error(err)
+	return false
+}
+
+// loadKnowledgeBase 读取知识库并检查权限，manage为true时只有创建者和管理员可以操作
+// 自己的知识库和共享的知识库可以在对话中使用，其他用户的知识库视为不存在
+func (service *knowledgeService) loadKnowledgeBase(ctx *gin.Context, knowledgeBaseId uuid.UUID, manage bool) (knowledgeBaseInfo, bool) {
+	var knowledgeBase knowledgeBaseInfo
+	err := service.getKnowledgeBase.QueryRow(knowledgeBaseId).Scan(&knowledgeBase.userName, &knowledgeBase.shared,
+		&knowledgeBase.embeddingModel, &knowledgeBase.dimensions)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = ctx.Error(knowledgeBaseNotFound())
+		return knowledgeBase, false
+	}
+	if err != nil {
+		_ = ctx.Error(err)
+		return knowledgeBase, false
+	}
+
+	owner := knowledgeBase.userName == ctx.GetString("UserName") || ctx.GetString("Permission") == "super"
+	if !owner && !knowledgeBase.shared {
+		_ = ctx.Error(knowledgeBaseNotFound())
+		return knowledgeBase, false
+	}
+	if manage && !owner {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB13",
+			MessageText: "只有创建者和管理员可以维护该知识库。",
+		}
+		_ = ctx.Error(err)
+		return knowledgeBase, false
+	}
+	return knowledgeBase, true
+}
+
+// checkEmbeddingModel 当前的向量模型与知识库创建时不一致时设置EKB12，不同模型的向量不能比较
+func (service *knowledgeService) checkEmbeddingModel(ctx *gin.Context, knowledgeBase knowledgeBaseInfo) bool {
+	if knowledgeBase.embeddingModel == service.embedder.Model() {
+		return true
+	}
+	err := &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EKB12",
+		MessageText: fmt.Sprintf("知识库的向量模型（%s）与当前配置（%s）不一致，请重新创建知识库。",
+			knowledgeBase.embeddingModel, service.embedder.Model()),
+	}
+	_ = ctx.Error(err)
+	return false
+}
+
+// embed 生成归一化的向量，维数与知识库已有的向量不一致时设置EKB12
+func (service *knowledgeService) embed(ctx *gin.Context, sessionId uuid.UUID, knowledgeBase knowledgeBaseInfo, texts []string) ([][]float32, bool) {
+	var (
+		vectors   [][]float32
+		startTime = time.Now()
+	)
+	resp, err := service.embedder.Embed(ctx.Request.Context(), texts)
+	if err == nil {
+		vectors = resp.Vectors
+		if len(vectors) != len(texts) {
+			err = errors.New("embedding count mismatch")
+		}
+	}
+
+	// 与回答一样记录使用量，失败的调用也记录，模型服务没有返回token数时按文本估算，记录失败不影响处理
+	record := UsageRecord{
+		UserName:  ctx.GetString("UserName"),
+		SessionId: sessionId,
+		Kind:      UsageKindEmbedding,
+		Model:     service.embedder.Model(),
+		Latency:   time.Since(startTime),
+	}
+	if err != nil {
+		record.ErrorCode = "EKB11"
+	} else {
+		record.Usage.PromptTokens = resp.PromptTokens
+		if record.Usage.PromptTokens == 0 {
+			for _, text := range texts {
+				record.Usage.PromptTokens += estimateTextTokens(text)
+			}
+		}
+		record.Usage.TotalTokens = record.Usage.PromptTokens
+	}
+	_ = service.usageService.RecordUsage(record)
+
+	if err != nil {
+		fmt.Println("生成向量失败：", err)
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB11",
+			MessageText: "生成向量失败，请联系管理员。",
+		}
+		_ = ctx.Error(err)
+		return nil, false
+	}
+	for _, vector := range vectors {
+		if len(vector) != len(vectors[0]) || (knowledgeBase.dimensions != 0 && len(vector) != knowledgeBase.dimensions) {
+			err = &myerrors.CustomError{
+				StatusCode:  200,
+				MessageCode: "EKB12",
+				MessageText: fmt.Sprintf("知识库的向量维数（%d）与当前配置（%d）不一致，请重新创建知识库。",
+					knowledgeBase.dimensions, len(vector)),
+			}
+			_ = ctx.Error(err)
+			return nil, false
+		}
+		normalize(vector)
+	}
+	return vectors, true
+}
+
+// saveDocument 在同一事务中保存文档和片段，并记录知识库的向量维数
+func (service *knowledgeService) saveDocument(document *models.KnowledgeDocumentDto, chunks []documents.Chunk,
+	embeddings [][]float32, dimensions int) error {
+	tx, err := service.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Stmt(service.insertDocument).Exec(document.DocumentId, document.KnowledgeBaseId, document.FileName,
+		document.MimeType, document.Size, document.Pages, document.ChunkCount, document.UserName,
+		document.CreateTimestamp)
+	if err != nil {
+		return err
+	}
+	insertChunk := tx.Stmt(service.insertChunk)
+	for i, chunk := range chunks {
+		embedding := make(pq.Float64Array, len(embeddings[i]))
+		for j, value := range embeddings[i] {
+			embedding[j] = float64(value)
+		}
+		_, err = insertChunk.Exec(document.DocumentId, i, document.KnowledgeBaseId, chunk.PageStart, chunk.PageEnd,
+			chunk.Text, embedding)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Stmt(service.updateKnowledgeBase).Exec(document.KnowledgeBaseId, dimensions, document.CreateTimestamp)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// search 返回相似度最高的片段，pgvector不可用时读取所有片段计算余弦相似度
+func (service *knowledgeService) search(knowledgeBaseId uuid.UUID, vector []float32) ([]models.ChatCitationDto, error) {
+	query := make(pq.Float64Array, len(vector))
+	for i, value := range vector {
+		query[i] = float64(value)
+	}
+
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if service.pgvector {
+		rows, err = service.searchChunks.Query(knowledgeBaseId, query, service.topK)
+	} else {
+		rows, err = service.searchChunks.Query(knowledgeBaseId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var citations []models.ChatCitationDto
+	for rows.Next() {
+		var citation models.ChatCitationDto
+		if service.pgvector {
+			err = rows.Scan(&citation.DocumentId, &citation.FileName, &citation.PageStart, &citation.PageEnd,
+				&citation.Text, &citation.Score)
+		} else {
+			var embedding pq.Float64Array
+			err = rows.Scan(&citation.DocumentId, &citation.FileName, &citation.PageStart, &citation.PageEnd,
+				&citation.Text, &embedding)
+			citation.Score = cosineSimilarity(query, embedding)
+		}
+		if err != nil {
+			return nil, err
+		}
+		citations = append(citations, citation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(citations, func(i, j int) bool {
+		return citations[i].Score > citations[j].Score
+	})
+	if len(citations) > service.topK {
+		citations = citations[:service.topK]
+	}
+	result := make([]models.ChatCitationDto, 0, len(citations))
+	for _, citation := range citations {
+		if citation.Score < service.minScore {
+			break
+		}
+		citation.Index = len(result) + 1
+		result = append(result, citation)
+	}
+	return result, nil
+}
+
+// mediaError 将读取数据的错误转为EKB05或EKB07
+func (service *knowledgeService) mediaError(err error) error {
+	if errors.Is(err, errMediaTooLarge) {
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EKB07",
+			MessageText: fmt.Sprintf("文档不能超过%s。", formatBytes(service.maxBytes)),
+		}
+	}
+	return &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EKB05",
+		MessageText: "文档数据格式错误。",
+	}
+}
+
+func knowledgeBaseNotFound() error {
+	return &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EKB02",
+		MessageText: "不存在该知识库或该知识库已被删除。",
+	}
+}
+
+// normalize 将向量归一化为单位长度
+func normalize(vector []float32) {
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// cosineSimilarity 两个向量的余弦相似度，维数不同或有零向量时为0
+func cosineSimilarity(a []float64, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	errMediaFormat   = errors.New("invalid media data")
+	errMediaTooLarge = errors.New("media too large")
+	// errMediaFetch 获取URL失败，不区分连接失败、非公网地址、非2xx响应和超过大小，避免被用于探测内部网络
+	errMediaFetch = errors.New("media fetch failed")
+)
+
+const (
+	// maxMediaRedirects 获取URL时最多跟随的重定向次数
+	maxMediaRedirects = 5
+)
+
+// nonPublicPrefixes 标准库的IsPrivate等方法未覆盖的非公网地址段
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"),  // 运营商级NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF协议分配
+	netip.MustParsePrefix("198.18.0.0/15"),  // 网络性能测试
+	netip.MustParsePrefix("240.0.0.0/4"),    // 保留地址和广播地址
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64，可以映射到内部的IPv4地址
+	netip.MustParsePrefix("64:ff9b:1::/48"), // 本地NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4，可以映射到内部的IPv4地址
+	netip.MustParsePrefix("fec0::/10"),      // 已废弃的站点本地地址
+}
+
+// newMediaClient 返回获取用户提供的URL的HTTP客户端
+// 只连接公网地址，防止通过服务端访问本机、内网和云服务的元数据接口（SSRF）
+// 在建立每个连接（包括重定向后的连接）时检查DNS解析后的地址，不使用代理
+func newMediaClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(ip) {
+				return fmt.Errorf("non-public address: %s", ip)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxMediaRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicAddr 是否为公网单播地址
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeMediaData 解码base64编码的数据，兼容data URL
+func decodeMediaData(data string, maxBytes int64) ([]byte, error) {
+	if strings.HasPrefix(data, "data:") {
+		_, encoded, found := strings.Cut(data, ";base64,")
+		if !found {
+			return nil, errMediaFormat
+		}
+		data = encoded
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(data))) > maxBytes+2 {
+		return nil, errMediaTooLarge
+	}
+	media, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(media) == 0 {
+		return nil, errMediaFormat
+	}
+	if int64(len(media)) > maxBytes {
+		return nil, errMediaTooLarge
+	}
+	return media, nil
+}
+
+// readMedia 读取最多maxBytes字节
+func readMedia(reader io.Reader, maxBytes int64) ([]byte, error) {
+	media, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil || len(media) == 0 {
+		return nil, errMediaFormat
+	}
+	if int64(len(media)) > maxBytes {
+		return nil, errMediaTooLarge
+	}
+	return media, nil
+}
+
+// fetchMedia 获取data URL或http(s) URL的数据，client应为newMediaClient返回的客户端
+// 获取URL失败时只返回errMediaFetch，详细原因只输出到日志
+func fetchMedia(ctx context.Context, client *http.Client, url string, maxBytes int64) ([]byte, error) {
+	if strings.HasPrefix(url, "data:") {
+		return decodeMediaData(url, maxBytes)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, errMediaFormat
+	}
+
+	media, err := getMedia(ctx, client, url, maxBytes)
+	if err != nil {
+		fmt.Println("获取URL失败：", url, err)
+		return nil, errMediaFetch
+	}
+	return media, nil
+}
+
+func getMedia(ctx context.Context, client *http.Client, url string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, errMediaTooLarge
+	}
+	return readMedia(resp.Body, maxBytes)
+}
+
+// formatBytes 按MB或KB显示字节数
+func formatBytes(size int64) string {
+	if size >= 1<<20 {
+		return fmt.Sprintf("%.4gMB", float64(size)/(1<<20))
+	}
+	return fmt.Sprintf("%.4gKB", float64(size)/(1<<10))
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"slices"
+	"sort"
+)
+
+// minContextBudgetRatio 发送给模型的消息至少可以使用上下文长度的1/minContextBudgetRatio
+const minContextBudgetRatio = 4
+
+// modelCatalog 客户端可选的模型和各权限可以使用的模型
+type modelCatalog struct {
+	defaultModel         string
+	deployments          map[string]string
+	tiers                map[string][]string
+	contextTokens        map[string]int
+	defaultContextTokens int
+	reservedTokens       int
+}
+
+func newModelCatalog(modelsConfig config.ModelsConfig, providerModel string) *modelCatalog {
+	catalog := &modelCatalog{
+		defaultModel:         modelsConfig.Default,
+		deployments:          modelsConfig.Deployments,
+		tiers:                modelsConfig.Tiers,
+		contextTokens:        modelsConfig.ContextTokens,
+		defaultContextTokens: modelsConfig.DefaultContextTokens,
+		reservedTokens:       modelsConfig.ReservedTokens,
+	}
+	// 未配置映射时只能使用provider.model
+	if len(catalog.deployments) == 0 {
+		catalog.defaultModel = providerModel
+		catalog.deployments = map[string]string{providerModel: providerModel}
+	}
+	return catalog
+}
+
+// resolve 返回模型名和部署名
+// 未指定模型时使用默认模型，默认模型不在权限允许的范围内时使用权限允许的第一个模型
+func (catalog *modelCatalog) resolve(model string, permission string) (string, string, error) {
+	allowed, limited := catalog.tiers[permission]
+	if model == "" {
+		model = catalog.defaultModel
+		if limited && !slices.Contains(allowed, model) && len(allowed) > 0 {
+			model = allowed[0]
+		}
+	}
+
+	deployment, ok := catalog.deployments[model]
+	if !ok {
+		err := &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH05",
+			MessageText: "不存在该模型。",
+		}
+		return "", "", err
+	}
+	if limited && !slices.Contains(allowed, model) {
+		err := &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH06",
+			MessageText: "当前权限不能使用该模型。",
+		}
+		return "", "", err
+	}
+	return model, deployment, nil
+}
+
+// contextBudget 返回发送给模型的消息可以使用的token数，即上下文长度减去为回答预留的token数
+// 预留的token数最多为上下文长度的3/4，避免maxTokens接近或超过上下文长度时无法发送任何消息
+func (catalog *modelCatalog) contextBudget(model string, parameters models.ChatParameters) int {
+	contextTokens, ok := catalog.contextTokens[model]
+	if !ok {
+		contextTokens = catalog.defaultContextTokens
+	}
+	reservedTokens := catalog.reservedTokens
+	if parameters.MaxTokens != nil {
+		reservedTokens = int(*parameters.MaxTokens)
+	}
+	reservedTokens = min(reservedTokens, contextTokens-contextTokens/minContextBudgetRatio)
+	return contextTokens - reservedTokens
+}
+
+// exists 模型是否仍在配置中
+func (catalog *modelCatalog) exists(model string) bool {
+	_, ok := catalog.deployments[model]
+	return ok
+}
+
+// allowed 返回权限可以使用的模型名
+func (catalog *modelCatalog) allowed(permission string) []string {
+	if allowed, limited := catalog.tiers[permission]; limited {
+		return allowed
+	}
+	models := make([]string, 0, len(catalog.deployments))
+	for model := range catalog.deployments {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// OCREngine 文字识别接口，屏蔽不同文字识别引擎的差异
+type OCREngine interface {
+	Recognize(ctx context.Context, request OCRRequest) (OCRResult, error)
+}
+
+type OCRRequest struct {
+	Image    []byte
+	MimeType string
+	// Languages 图片中文字的语言（ISO-639-1）
+	Languages []string
+}
+
+type OCRResult struct {
+	Text string
+	// Model 调用模型服务识别时为使用的模型，用于记录使用量，失败时也设置，不调用模型服务的引擎为空
+	Model string
+	Usage ChatCompletionsUsage
+}
+
+// NewOCREngine 根据配置创建文字识别引擎，ocr.engine为none时返回nil
+func NewOCREngine(ocrConfig config.OCRConfig, provider ChatProvider, modelsConfig config.ModelsConfig, providerModel string) (OCREngine, error) {
+	switch ocrConfig.Engine {
+	case "vision":
+		// 识别文字的模型由管理员指定，所有权限都可以使用，有意不检查models.tiers
+		_, deployment, err := newModelCatalog(modelsConfig, providerModel).resolve(ocrConfig.Model, "")
+		if err != nil {
+			return nil, fmt.Errorf("ocr.model不存在：%s", ocrConfig.Model)
+		}
+		return &visionOCREngine{provider: provider, deployment: deployment}, nil
+	case "tesseract":
+		return &tesseractOCREngine{path: ocrConfig.TesseractPath}, nil
+	case "fake":
+		return &fakeOCREngine{}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("不支持的文字识别引擎：%s", ocrConfig.Engine)
+	}
+}
+
+// ocrLanguageNames 语言代码对应的tesseract语言包和提示词中的语言名
+var ocrLanguageNames = map[string]struct {
+	tesseract string
+	name      string
+}{
+	"zh":    {"chi_sim", "简体中文"},
+	"zh-TW": {"chi_tra", "繁体中文"},
+	"en":    {"eng", "英文"},
+	"ja":    {"jpn", "日文"},
+	"ko":    {"kor", "韩文"},
+}
+
+// visionOCREngine 将图片和提取文字的提示词发送给视觉模型
+type visionOCREngine struct {
+	provider   ChatProvider
+	deployment string
+}
+
+func (engine *visionOCREngine) Recognize(ctx context.Context, request OCRRequest) (OCRResult, error) {
+	var languages []string
+	for _, language := range request.Languages {
+		if names, ok := ocrLanguageNames[language]; ok {
+			languages = append(languages, names.name)
+		} else {
+			languages = append(languages, language)
+		}
+	}
+	prompt := "提取图片中的所有文字，按原有的顺序和换行输出，只输出文字本身，不要翻译、解释或补充。图片中没有文字时不输出任何内容。"
+	if len(languages) > 0 {
+		prompt += "图片中的文字可能是" + strings.Join(languages, "或") + "。"
+	}
+
+	dataURL := "data:" + request.MimeType + ";base64," + base64.StdEncoding.EncodeToString(request.Image)
+	chatRequest := ChatCompletionsRequest{
+		Model: engine.deployment,
+		Messages: []models.ChatMessage{
+			models.NewChatMessageText(models.ChatRoleSystem, prompt),
+			{
+				Role:    models.ChatRoleUser,
+				Content: []models.ChatMessageContentPart{models.NewChatMessageContentPartImage(dataURL)},
+			},
+		},
+	}
+	result := OCRResult{Model: engine.deployment}
+	resp, err := engine.provider.GetChatCompletions(ctx, chatRequest)
+	if err != nil {
+		return result, err
+	}
+	if resp.Model != "" {
+		result.Model = resp.Model
+	}
+	result.Usage = resp.Usage
+	if result.Usage.TotalTokens == 0 {
+		result.Usage = estimateUsage(chatRequest, resp)
+	}
+	if len(resp.Choices) == 0 {
+		return result, errors.New("no choices")
+	}
+	result.Text = resp.Choices[0].Message.Text()
+	return result, nil
+}
+
+// tesseractOCREngine 调用本地的tesseract命令，图片从标准输入读取，文字输出到标准输出
+type tesseractOCREngine struct {
+	path string
+}
+
+func (engine *tesseractOCREngine) Recognize(ctx context.Context, request OCRRequest) (OCRResult, error) {
+	var languages []string
+	for _, language := range request.Languages {
+		if names, ok := ocrLanguageNames[language]; ok {
+			languages = append(languages, names.tesseract)
+		} else {
+			languages = append(languages, language)
+		}
+	}
+	args := []string{"stdin", "stdout"}
+	if len(languages) > 0 {
+		args = append(args, "-l", strings.Join(languages, "+"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, engine.path, args...)
+	cmd.Stdin = bytes.NewReader(request.Image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return OCRResult{}, fmt.Errorf("%s: %w: %s", engine.path, err, strings.TrimSpace(stderr.String()))
+	}
+	return OCRResult{Text: stdout.String()}, nil
+}
+
+// fakeOCREngine 进程内的模拟文字识别引擎，返回图片的格式和大小
+type fakeOCREngine struct{}
+
+func (engine *fakeOCREngine) Recognize(_ context.Context, request OCRRequest) (OCRResult, error) {
+	return OCRResult{Text: fmt.Sprintf("[图片文字 %s %d字节]", request.MimeType, len(request.Image))}, nil
+}
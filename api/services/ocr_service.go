@@ -0,0 +1,167 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type OCRService interface {
+	// RecognizeContents 识别问题中ImageOCR图片的文字并设置识别结果，出错时设置错误并返回false
+	// 调用模型服务识别时按会话记录使用量
+	RecognizeContents(ctx *gin.Context, sessionId uuid.UUID, contents []models.ChatQuestionContentPartsDto) bool
+}
+
+type ocrService struct {
+	// engine 为nil时不支持ImageOCR
+	engine       OCREngine
+	imageService ImageService
+	usageService UsageService
+	client       *http.Client
+	languages    []string
+	maxBytes     int64
+	timeout      time.Duration
+}
+
+// ocrMimeTypes 支持识别文字的图片格式
+var ocrMimeTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"image/tiff",
+}
+
+func NewOCRService(engine OCREngine, imageService ImageService, usageService UsageService, ocrConfig config.OCRConfig) OCRService {
+	service := &ocrService{
+		engine:       engine,
+		imageService: imageService,
+		usageService: usageService,
+		client:       newMediaClient(ocrConfig.Timeout),
+		languages:    ocrConfig.Languages,
+		maxBytes:     ocrConfig.MaxBytes,
+		timeout:      ocrConfig.Timeout,
+	}
+	return service
+}
+
+func (service *ocrService) RecognizeContents(ctx *gin.Context, sessionId uuid.UUID, contents []models.ChatQuestionContentPartsDto) bool {
+	for _, content := range contents {
+		imageContent, ok := content.(*models.ChatQuestionContentPartsDtoImageOCR)
+		if !ok {
+			continue
+		}
+		text, err := service.recognize(ctx.Request.Context(), ctx.GetString("UserName"), sessionId, imageContent.ImageRef())
+		if err != nil {
+			_ = ctx.Error(err)
+			return false
+		}
+		imageContent.Text = text
+	}
+	return true
+}
+
+// recognize 获取或解码图片，按内容检测图片格式并识别文字
+func (service *ocrService) recognize(ctx context.Context, userName string, sessionId uuid.UUID, imageUrl string) (string, error) {
+	if service.engine == nil {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC01",
+			MessageText: "未启用图片文字识别。",
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+
+	var (
+		image []byte
+		err   error
+	)
+	if imageId, ok := models.ParseImageRef(imageUrl); ok {
+		image, err = service.imageService.Load(ctx, imageId)
+	} else {
+		image, err = fetchMedia(ctx, service.client, imageUrl, service.maxBytes)
+	}
+	if errors.Is(err, errMediaTooLarge) {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC04",
+			MessageText: fmt.Sprintf("图片不能超过%s。", formatBytes(service.maxBytes)),
+		}
+	}
+	if err != nil {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC02",
+			MessageText: "图片获取失败。",
+		}
+	}
+
+	mime := mimetype.Detect(image)
+	supported := false
+	for _, mimeType := range ocrMimeTypes {
+		if mime.Is(mimeType) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC03",
+			MessageText: fmt.Sprintf("不支持的图片格式：%s。", mime.String()),
+		}
+	}
+
+	startTime := time.Now()
+	result, err := service.engine.Recognize(ctx, OCRRequest{
+		Image:     image,
+		MimeType:  mime.String(),
+		Languages: service.languages,
+	})
+
+	// 调用模型服务识别时与回答一样记录使用量，失败的调用也记录，记录失败不影响识别
+	if result.Model != "" {
+		record := UsageRecord{
+			UserName:  userName,
+			SessionId: sessionId,
+			Kind:      UsageKindOCR,
+			Model:     result.Model,
+			Usage:     result.Usage,
+			Latency:   time.Since(startTime),
+		}
+		if err != nil {
+			record.ErrorCode = "EOC05"
+		}
+		_ = service.usageService.RecordUsage(record)
+	}
+
+	if err != nil {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC05",
+			MessageText: "图片文字识别失败，请联系管理员。",
+		}
+	}
+	text := strings.TrimSpace(result.Text)
+	if text == "" {
+		return "", &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EOC06",
+			MessageText: "没有识别到图片中的文字。",
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type PersonaService interface {
+	ListPersonas(ctx *gin.Context) *models.PersonaListDto
+	CreatePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto
+	UpdatePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto
+	DeletePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto
+	Close() error
+}
+
+type personaService struct {
+	catalog *modelCatalog
+
+	listPersonas  *sql.Stmt
+	insertPersona *sql.Stmt
+	updatePersona *sql.Stmt
+	deletePersona *sql.Stmt
+}
+
+func NewPersonaService(db *sql.DB, modelsConfig config.ModelsConfig, providerModel string) PersonaService {
+	var (
+		err           error
+		listPersonas  *sql.Stmt
+		insertPersona *sql.Stmt
+		updatePersona *sql.Stmt
+		deletePersona *sql.Stmt
+	)
+	listPersonas, err = db.Prepare(`
+		SELECT persona_id, name, description, system_prompt, model, parameters, create_timestamp, update_timestamp
+		FROM persona
+		ORDER BY name`)
+	if err != nil {
+		return nil
+	}
+	insertPersona, err = db.Prepare(`
+		INSERT INTO persona
+		(persona_id, name, description, system_prompt, model, parameters, create_timestamp, update_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (name) DO NOTHING`)
+	if err != nil {
+		return nil
+	}
+	updatePersona, err = db.Prepare(`
+		UPDATE persona
+		SET name = $2, description = $3, system_prompt = $4, model = $5, parameters = $6, update_timestamp = $7
+		WHERE persona_id = $1
+		RETURNING create_timestamp`)
+	if err != nil {
+		return nil
+	}
+	deletePersona, err = db.Prepare(
+		"DELETE FROM persona WHERE persona_id = $1")
+	if err != nil {
+		return nil
+	}
+
+	service := &personaService{
+		catalog:       newModelCatalog(modelsConfig, providerModel),
+		listPersonas:  listPersonas,
+		insertPersona: insertPersona,
+		updatePersona: updatePersona,
+		deletePersona: deletePersona,
+	}
+	return service
+}
+
+func (service *personaService) ListPersonas(ctx *gin.Context) *models.PersonaListDto {
+	var (
+		err    error
+		rows   *sql.Rows
+		outDto = &models.PersonaListDto{Personas: make([]models.PersonaDto, 0)}
+	)
+	rows, err = service.listPersonas.Query()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			persona    models.PersonaDto
+			parameters []byte
+		)
+		err = rows.Scan(&persona.PersonaId, &persona.Name, &persona.Description, &persona.SystemPrompt,
+			&persona.Model, &parameters, &persona.CreateTimestamp, &persona.UpdateTimestamp)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		if err = json.Unmarshal(parameters, &persona.Parameters); err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		outDto.Personas = append(outDto.Personas, persona)
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+func (service *personaService) CreatePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto {
+	var (
+		err          error
+		result       sql.Result
+		rowsAffected int64
+		parameters   []byte
+		currentTime  = time.Now()
+	)
+	if !service.checkPersona(ctx, &inDto) {
+		return nil
+	}
+	parameters, err = json.Marshal(inDto.Parameters)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	inDto.PersonaId = uuid.New()
+	result, err = service.insertPersona.Exec(inDto.PersonaId, inDto.Name, inDto.Description,
+		inDto.SystemPrompt, inDto.Model, parameters, currentTime)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE03",
+			MessageText: "角色名已被使用。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	inDto.CreateTimestamp = currentTime
+	inDto.UpdateTimestamp = currentTime
+	return &inDto
+}
+
+func (service *personaService) UpdatePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto {
+	var (
+		err         error
+		parameters  []byte
+		currentTime = time.Now()
+	)
+	if !service.checkPersona(ctx, &inDto) {
+		return nil
+	}
+	parameters, err = json.Marshal(inDto.Parameters)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	err = service.updatePersona.QueryRow(inDto.PersonaId, inDto.Name, inDto.Description,
+		inDto.SystemPrompt, inDto.Model, parameters, currentTime).Scan(&inDto.CreateTimestamp)
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE02",
+			MessageText: "不存在该角色或该角色已被删除。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		// 违反角色名的唯一约束
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE03",
+			MessageText: "角色名已被使用。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	case err != nil:
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	inDto.UpdateTimestamp = currentTime
+	return &inDto
+}
+
+func (service *personaService) DeletePersona(ctx *gin.Context, inDto models.PersonaDto) *models.PersonaDto {
+	var (
+		err          error
+		result       sql.Result
+		rowsAffected int64
+	)
+	if !checkPersonaAdmin(ctx) {
+		return nil
+	}
+
+	result, err = service.deletePersona.Exec(inDto.PersonaId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	if rowsAffected == 0 {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE02",
+			MessageText: "不存在该角色或该角色已被删除。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	return nil
+}
+
+// checkPersona 检查管理员权限和角色的内容，不符合时设置错误
+func (service *personaService) checkPersona(ctx *gin.Context, persona *models.PersonaDto) bool {
+	var err error
+	if !checkPersonaAdmin(ctx) {
+		return false
+	}
+
+	persona.Name = strings.TrimSpace(persona.Name)
+	if persona.Name == "" || strings.TrimSpace(persona.SystemPrompt) == "" {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE04",
+			MessageText: "角色名和系统提示词不能为空。",
+		}
+		_ = ctx.Error(err)
+		return false
+	}
+	if persona.Model != "" && !service.catalog.exists(persona.Model) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "ECH05",
+			MessageText: "不存在该模型。",
+		}
+		_ = ctx.Error(err)
+		return false
+	}
+	if !validParameters(persona.Parameters) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EPE05",
+			MessageText: "生成参数超出范围：temperature为0到2，topP为0到1，maxTokens必须大于0。",
+		}
+		_ = ctx.Error(err)
+		return false
+	}
+	return true
+}
+
+// checkPersonaAdmin 只有管理员可以维护角色，不是管理员时设置EPE01
+func checkPersonaAdmin(ctx *gin.Context) bool {
+	if ctx.GetString("Permission") == "super" {
+		return true
+	}
+	err := &myerrors.CustomError{
+		StatusCode:  200,
+		MessageCode: "EPE01",
+		MessageText: "只有管理员可以维护角色。",
+	}
+	_ = ctx.Error(err)
+	return false
+}
+
+// validParameters 生成参数是否在模型服务允许的范围内
+func validParameters(parameters models.ChatParameters) bool {
+	if parameters.Temperature != nil && (*parameters.Temperature < 0 || *parameters.Temperature > 2) {
+		return false
+	}
+	if parameters.TopP != nil && (*parameters.TopP < 0 || *parameters.TopP > 1) {
+		return false
+	}
+	if parameters.MaxTokens != nil && *parameters.MaxTokens <= 0 {
+		return false
+	}
+	return true
+}
+
+func (service *personaService) Close() error {
+	return errors.Join(
+		service.listPersonas.Close(),
+		service.insertPersona.Close(),
+		service.updatePersona.Close(),
+		service.deletePersona.Close(),
+	)
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/tools"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type ToolService interface {
+	// Definitions 发送给模型服务的工具定义，没有启用工具时返回空
+	Definitions() []ChatTool
+	// Execute 执行模型要求的工具调用，返回工具消息，执行失败时错误作为结果返回给模型
+	Execute(ctx context.Context, toolCall models.ChatMessageToolCall) models.ChatMessage
+	// MaxSteps 每次回答最多执行几轮工具调用
+	MaxSteps() int
+}
+
+type toolService struct {
+	registry *tools.Registry
+	maxSteps int
+	timeout  time.Duration
+}
+
+func NewToolService(toolsConfig config.ToolsConfig) (ToolService, error) {
+	location := time.Local
+	if toolsConfig.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(toolsConfig.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	registry := tools.NewRegistry()
+	for _, name := range toolsConfig.Enabled {
+		tool, err := tools.NewBuiltin(name, tools.BuiltinOptions{Location: location})
+		if err != nil {
+			return nil, err
+		}
+		if err = registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+
+	service := &toolService{
+		registry: registry,
+		maxSteps: toolsConfig.MaxSteps,
+		timeout:  toolsConfig.Timeout,
+	}
+	return service, nil
+}
+
+func (service *toolService) Definitions() []ChatTool {
+	var definitions []ChatTool
+	for _, tool := range service.registry.Tools() {
+		definitions = append(definitions, ChatTool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		})
+	}
+	return definitions
+}
+
+func (service *toolService) Execute(ctx context.Context, toolCall models.ChatMessageToolCall) models.ChatMessage {
+	result, err := service.call(ctx, toolCall)
+	if err != nil {
+		fmt.Println("工具调用失败：", toolCall.Function.Name, err)
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		result = string(data)
+	}
+
+	message := models.NewChatMessageToolResult(toolCall.Id, result)
+	currentTime := time.Now()
+	message.Timestamp = &currentTime
+	return message
+}
+
+func (service *toolService) call(ctx context.Context, toolCall models.ChatMessageToolCall) (string, error) {
+	tool, ok := service.registry.Get(toolCall.Function.Name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, service.timeout)
+	defer cancel()
+	return tools.Call(ctx, tool, json.RawMessage(toolCall.Function.Arguments))
+}
+
+func (service *toolService) MaxSteps() int {
+	return service.maxSteps
+}
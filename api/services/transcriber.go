@@ -0,0 +1,54 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"fmt"
+)
+
+// Transcriber 语音识别接口，屏蔽不同语音识别服务的差异
+type Transcriber interface {
+	// Model 语音识别使用的模型，用于记录使用量
+	Model() string
+	Transcribe(ctx context.Context, request TranscriptionRequest) (string, error)
+}
+
+type TranscriptionRequest struct {
+	Audio []byte
+	// FileName 带扩展名的文件名，语音识别服务按扩展名判断格式
+	FileName string
+	MimeType string
+	// Language 为空时由语音识别服务自动识别
+	Language string
+}
+
+// NewTranscriber 根据配置创建语音识别服务，audio.transcriber为none时返回nil
+func NewTranscriber(audioConfig config.AudioConfig, providerConfig config.ProviderConfig) (Transcriber, error) {
+	transcriber := audioConfig.Transcriber
+	if transcriber == "provider" {
+		transcriber = providerConfig.Type
+	}
+	switch transcriber {
+	case "azure":
+		return newAzureTranscriber(audioConfig, providerConfig)
+	case "openai":
+		return newOpenAITranscriber(audioConfig, providerConfig)
+	case "fake":
+		return &fakeTranscriber{}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("不支持的语音识别服务：%s", audioConfig.Transcriber)
+	}
+}
+
+// fakeTranscriber 进程内的模拟语音识别服务，返回语音的格式和大小
+type fakeTranscriber struct{}
+
+func (transcriber *fakeTranscriber) Model() string {
+	return "fake"
+}
+
+func (transcriber *fakeTranscriber) Transcribe(_ context.Context, request TranscriptionRequest) (string, error) {
+	return fmt.Sprintf("[语音 %s %d字节]", request.MimeType, len(request.Audio)), nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// azureTranscriber Azure OpenAI的Whisper部署
+type azureTranscriber struct {
+	client         *azopenai.Client
+	deploymentName string
+	timeout        time.Duration
+}
+
+func newAzureTranscriber(audioConfig config.AudioConfig, providerConfig config.ProviderConfig) (Transcriber, error) {
+	keyCredential := azcore.NewKeyCredential(providerConfig.APIKey)
+	client, err := azopenai.NewClientWithKeyCredential(providerConfig.Endpoint, keyCredential, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureTranscriber{
+		client:         client,
+		deploymentName: audioConfig.Model,
+		timeout:        providerConfig.Timeout,
+	}, nil
+}
+
+func (transcriber *azureTranscriber) Model() string {
+	return transcriber.deploymentName
+}
+
+func (transcriber *azureTranscriber) Transcribe(ctx context.Context, request TranscriptionRequest) (string, error) {
+	if transcriber.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, transcriber.timeout)
+		defer cancel()
+	}
+
+	options := azopenai.AudioTranscriptionOptions{
+		File:           request.Audio,
+		Filename:       to.Ptr(request.FileName),
+		DeploymentName: to.Ptr(transcriber.deploymentName),
+		ResponseFormat: to.Ptr(azopenai.AudioTranscriptionFormatJSON),
+	}
+	if request.Language != "" {
+		options.Language = to.Ptr(request.Language)
+	}
+	resp, err := transcriber.client.GetAudioTranscription(ctx, options, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.Text == nil {
+		return "", errors.New("empty transcription")
+	}
+	return *resp.Text, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"LaoQGChat/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// openAITranscriber OpenAI兼容的语音识别接口（OpenAI、whisper.cpp server等）
+type openAITranscriber struct {
+	client   *http.Client
+	endpoint string
+	apiKey   string
+	model    string
+}
+
+type openAITranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+func newOpenAITranscriber(audioConfig config.AudioConfig, providerConfig config.ProviderConfig) (Transcriber, error) {
+	return &openAITranscriber{
+		client:   &http.Client{Timeout: providerConfig.Timeout},
+		endpoint: strings.TrimRight(providerConfig.Endpoint, "/"),
+		apiKey:   providerConfig.APIKey,
+		model:    audioConfig.Model,
+	}, nil
+}
+
+func (transcriber *openAITranscriber) Model() string {
+	return transcriber.model
+}
+
+func (transcriber *openAITranscriber) Transcribe(ctx context.Context, request TranscriptionRequest) (string, error) {
+	// 语音以multipart/form-data上传
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"model":           transcriber.model,
+		"response_format": "json",
+	}
+	if request.Language != "" {
+		fields["language"] = request.Language
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return "", err
+		}
+	}
+	part, err := writer.CreateFormFile("file", request.FileName)
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(request.Audio); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := openAIPost(ctx, transcriber.client, transcriber.endpoint, transcriber.apiKey,
+		"/audio/transcriptions", writer.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var transcription openAITranscriptionResponse
+	if err = json.NewDecoder(resp.Body).Decode(&transcription); err != nil {
+		return "", err
+	}
+	return transcription.Text, nil
+}
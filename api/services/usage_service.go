@@ -0,0 +1,326 @@
+package services
+
+import (
+	"LaoQGChat/api/models"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/myerrors"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+type UsageService interface {
+	CheckQuota(userName string, permission string) error
+	GetQuota(ctx *gin.Context) *models.QuotaDto
+	GetSummary(ctx *gin.Context, inDto models.UsageSummaryInDto) *models.UsageSummaryOutDto
+	RecordUsage(record UsageRecord) error
+	Close() error
+}
+
+// UsageRecord 一次模型服务调用的记录，ErrorCode为空时表示调用成功
+type UsageRecord struct {
+	UserName  string
+	SessionId uuid.UUID
+	// Kind 调用的种类，为空时为UsageKindChat
+	Kind         string
+	Model        string
+	Usage        ChatCompletionsUsage
+	Latency      time.Duration
+	FinishReason string
+	ErrorCode    string
+}
+
+// 调用的种类，只有成功的UsageKindChat调用计入提问次数，所有种类都计入token用量
+const (
+	// UsageKindChat 回答问题
+	UsageKindChat = "chat"
+	// UsageKindTranscription 语音识别，服务不返回token数，按识别结果估算
+	UsageKindTranscription = "transcription"
+	// UsageKindOCR 视觉模型识别图片中的文字
+	UsageKindOCR = "ocr"
+	// UsageKindEmbedding 知识库生成文档和问题的向量
+	UsageKindEmbedding = "embedding"
+	// UsageKindToolStep 回答问题过程中要求调用工具的调用
+	UsageKindToolStep = "tool_step"
+)
+
+const (
+	// 使用量统计的默认天数和最大天数
+	defaultSummaryDays = 30
+	maxSummaryDays     = 366
+)
+
+type usageService struct {
+	tiers map[string]config.QuotaLimitConfig
+
+	getUsage    *sql.Stmt
+	insertUsage *sql.Stmt
+	getSummary  *sql.Stmt
+}
+
+// quotaUsage 本日和本月的使用量
+type quotaUsage struct {
+	dailyMessages   int64
+	dailyTokens     int64
+	monthlyMessages int64
+	monthlyTokens   int64
+	dayStart        time.Time
+	monthStart      time.Time
+}
+
+func NewUsageService(db *sql.DB, quotaConfig config.QuotaConfig) UsageService {
+	var (
+		err         error
+		getUsage    *sql.Stmt
+		insertUsage *sql.Stmt
+		getSummary  *sql.Stmt
+	)
+	// $2：本日开始时间，$3：本月开始时间，失败的调用和回答问题以外的调用不计入提问次数
+	getUsage, err = db.Prepare(`
+		SELECT count(*) FILTER (WHERE create_time >= $2 AND error_code = '' AND kind = 'chat'),
+		       COALESCE(sum(total_tokens) FILTER (WHERE create_time >= $2), 0),
+		       count(*) FILTER (WHERE error_code = '' AND kind = 'chat'),
+		       COALESCE(sum(total_tokens), 0)
+		FROM usage_record
+		WHERE user_name = $1 AND create_time >= $3`)
+	if err != nil {
+		return nil
+	}
+	insertUsage, err = db.Prepare(`
+		INSERT INTO usage_record
+		(user_name, session_id, model, prompt_tokens, completion_tokens, total_tokens, latency_ms,
+		 finish_reason, error_code, create_time, kind)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`)
+	if err != nil {
+		return nil
+	}
+	// 按日、按模型和合计汇总，$1：用户名（NULL为所有用户），$2：开始时间，$3：结束时间（不含）
+	// 分组方式：1为按日，2为按模型，3为合计
+	getSummary, err = db.Prepare(`
+		SELECT GROUPING(day, model), COALESCE(day, ''), COALESCE(model, ''),
+		       count(*), count(*) FILTER (WHERE error_code <> ''),
+		       COALESCE(sum(prompt_tokens), 0), COALESCE(sum(completion_tokens), 0),
+		       COALESCE(sum(total_tokens), 0), COALESCE(round(avg(latency_ms)), 0)::bigint
+		FROM (
+		    SELECT to_char(create_time, 'YYYY-MM-DD') AS day, model, error_code,
+		           prompt_tokens, completion_tokens, total_tokens, latency_ms
+		    FROM usage_record
+		    WHERE ($1::text IS NULL OR user_name = $1) AND create_time >= $2 AND create_time < $3
+		) AS usage
+		GROUP BY GROUPING SETS ((day), (model), ())
+		ORDER BY day, model`)
+	if err != nil {
+		return nil
+	}
+
+	service := &usageService{
+		tiers:       quotaConfig.Tiers,
+		getUsage:    getUsage,
+		insertUsage: insertUsage,
+		getSummary:  getSummary,
+	}
+	return service
+}
+
+// CheckQuota 检查用户本日和本月的使用量是否已达到权限的上限
+func (service *usageService) CheckQuota(userName string, permission string) error {
+	limit, ok := service.tiers[permission]
+	if !ok {
+		return nil
+	}
+	usage, err := service.usage(userName, time.Now())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case limit.DailyMessages > 0 && usage.dailyMessages >= limit.DailyMessages:
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EQU01",
+			MessageText: "今日提问次数已达上限，请明天再试。",
+		}
+	case limit.DailyTokens > 0 && usage.dailyTokens >= limit.DailyTokens:
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EQU02",
+			MessageText: "今日token用量已达上限，请明天再试。",
+		}
+	case limit.MonthlyMessages > 0 && usage.monthlyMessages >= limit.MonthlyMessages:
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EQU03",
+			MessageText: "本月提问次数已达上限。",
+		}
+	case limit.MonthlyTokens > 0 && usage.monthlyTokens >= limit.MonthlyTokens:
+		return &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EQU04",
+			MessageText: "本月token用量已达上限。",
+		}
+	}
+	return nil
+}
+
+func (service *usageService) GetQuota(ctx *gin.Context) *models.QuotaDto {
+	var (
+		userName   = ctx.GetString("UserName")
+		permission = ctx.GetString("Permission")
+		limit      = service.tiers[permission]
+	)
+	usage, err := service.usage(userName, time.Now())
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+
+	outDto := &models.QuotaDto{
+		Permission: permission,
+		Daily: newQuotaUsageDto(limit.DailyMessages, usage.dailyMessages,
+			limit.DailyTokens, usage.dailyTokens, usage.dayStart.AddDate(0, 0, 1)),
+		Monthly: newQuotaUsageDto(limit.MonthlyMessages, usage.monthlyMessages,
+			limit.MonthlyTokens, usage.monthlyTokens, usage.monthStart.AddDate(0, 1, 0)),
+	}
+	return outDto
+}
+
+func (service *usageService) GetSummary(ctx *gin.Context, inDto models.UsageSummaryInDto) *models.UsageSummaryOutDto {
+	var (
+		userName   any = ctx.GetString("UserName")
+		permission     = ctx.GetString("Permission")
+		err        error
+		rows       *sql.Rows
+		from       time.Time
+		to         time.Time
+		outDto     = &models.UsageSummaryOutDto{
+			Days:   make([]models.UsageSummaryItemDto, 0),
+			Models: make([]models.UsageSummaryItemDto, 0),
+		}
+	)
+
+	// 管理员可以查看所有用户或指定用户的使用量
+	if permission == "super" {
+		userName = nil
+		if inDto.UserName != "" {
+			userName = inDto.UserName
+		}
+		outDto.UserName = inDto.UserName
+	} else {
+		outDto.UserName = ctx.GetString("UserName")
+	}
+
+	// 解析统计期间
+	year, month, day := time.Now().Date()
+	to = time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	if inDto.To != "" {
+		to, err = time.ParseInLocation(time.DateOnly, inDto.To, time.Local)
+	}
+	from = to.AddDate(0, 0, 1-defaultSummaryDays)
+	if err == nil && inDto.From != "" {
+		from, err = time.ParseInLocation(time.DateOnly, inDto.From, time.Local)
+	}
+	if err != nil || from.After(to) || !from.AddDate(0, 0, maxSummaryDays).After(to) {
+		err = &myerrors.CustomError{
+			StatusCode:  200,
+			MessageCode: "EUS01",
+			MessageText: "统计期间格式错误或超过366天。",
+		}
+		_ = ctx.Error(err)
+		return nil
+	}
+	outDto.From = from.Format(time.DateOnly)
+	outDto.To = to.Format(time.DateOnly)
+
+	rows, err = service.getSummary.Query(userName, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			grouping int
+			item     models.UsageSummaryItemDto
+		)
+		err = rows.Scan(&grouping, &item.Date, &item.Model, &item.Requests, &item.Errors,
+			&item.PromptTokens, &item.CompletionTokens, &item.TotalTokens, &item.AverageLatencyMs)
+		if err != nil {
+			_ = ctx.Error(err)
+			return nil
+		}
+		switch grouping {
+		case 1:
+			outDto.Days = append(outDto.Days, item)
+		case 2:
+			outDto.Models = append(outDto.Models, item)
+		default:
+			outDto.Total = item
+		}
+	}
+	if err = rows.Err(); err != nil {
+		_ = ctx.Error(err)
+		return nil
+	}
+	return outDto
+}
+
+// RecordUsage 记录一次模型服务调用
+func (service *usageService) RecordUsage(record UsageRecord) error {
+	if record.Kind == "" {
+		record.Kind = UsageKindChat
+	}
+	_, err := service.insertUsage.Exec(record.UserName, record.SessionId, record.Model,
+		record.Usage.PromptTokens, record.Usage.CompletionTokens, record.Usage.TotalTokens,
+		record.Latency.Milliseconds(), record.FinishReason, record.ErrorCode, time.Now(), record.Kind)
+	return err
+}
+
+// usage 查询本日和本月的使用量，以服务器本地时间划分
+func (service *usageService) usage(userName string, currentTime time.Time) (*quotaUsage, error) {
+	year, month, day := currentTime.Date()
+	usage := &quotaUsage{
+		dayStart:   time.Date(year, month, day, 0, 0, 0, 0, currentTime.Location()),
+		monthStart: time.Date(year, month, 1, 0, 0, 0, 0, currentTime.Location()),
+	}
+	err := service.getUsage.QueryRow(userName, usage.dayStart, usage.monthStart).Scan(
+		&usage.dailyMessages, &usage.dailyTokens, &usage.monthlyMessages, &usage.monthlyTokens)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// newQuotaUsageDto 上限为0时不限制，上限和剩余量返回null
+func newQuotaUsageDto(messageLimit int64, messageUsed int64, tokenLimit int64, tokenUsed int64, resetTime time.Time) models.QuotaUsageDto {
+	dto := models.QuotaUsageDto{
+		MessageUsed: messageUsed,
+		TokenUsed:   tokenUsed,
+		ResetTime:   resetTime,
+	}
+	if messageLimit > 0 {
+		messageRemaining := max(messageLimit-messageUsed, 0)
+		dto.MessageLimit = &messageLimit
+		dto.MessageRemaining = &messageRemaining
+	}
+	if tokenLimit > 0 {
+		tokenRemaining := max(tokenLimit-tokenUsed, 0)
+		dto.TokenLimit = &tokenLimit
+		dto.TokenRemaining = &tokenRemaining
+	}
+	return dto
+}
+
+func (service *usageService) Close() error {
+	return errors.Join(
+		service.getUsage.Close(),
+		service.insertUsage.Close(),
+		service.getSummary.Close(),
+	)
+}
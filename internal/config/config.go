@@ -0,0 +1,541 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Client    ClientConfig    `yaml:"client"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Provider  ProviderConfig  `yaml:"provider"`
+	Models    ModelsConfig    `yaml:"models"`
+	Quota     QuotaConfig     `yaml:"quota"`
+	Audio     AudioConfig     `yaml:"audio"`
+	OCR       OCRConfig       `yaml:"ocr"`
+	Images    ImagesConfig    `yaml:"images"`
+	Documents DocumentsConfig `yaml:"documents"`
+	Knowledge KnowledgeConfig `yaml:"knowledge"`
+	Tools     ToolsConfig     `yaml:"tools"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"`
+	DSNFile         string        `yaml:"dsn_file"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
+}
+
+type CORSConfig struct {
+	AllowOrigins     []string      `yaml:"allow_origins"`
+	AllowMethods     []string      `yaml:"allow_methods"`
+	AllowHeaders     []string      `yaml:"allow_headers"`
+	ExposeHeaders    []string      `yaml:"expose_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type ClientConfig struct {
+	Version string `yaml:"version"`
+}
+
+type AuthConfig struct {
+	BcryptCost            int  `yaml:"bcrypt_cost"`
+	PasswordMinLength     int  `yaml:"password_min_length"`
+	PasswordRequireLetter bool `yaml:"password_require_letter"`
+	PasswordRequireDigit  bool `yaml:"password_require_digit"`
+	// AccessTokenTTL 访问令牌的有效期，过期后使用刷新令牌换取新的访问令牌
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl"`
+	// IdleTimeout 设备超过该时间没有任何请求时需要重新登录
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// AbsoluteTimeout 从登录开始计算的最长有效期
+	AbsoluteTimeout time.Duration `yaml:"absolute_timeout"`
+	// TokenMode 访问令牌的形式，opaque：保存在数据库中的随机令牌，jwt：不查询数据库即可验证的签名令牌
+	TokenMode string `yaml:"token_mode"`
+	// SigningKeys jwt模式的签名密钥，轮换密钥时保留旧密钥直到旧密钥签发的令牌全部过期
+	SigningKeys []SigningKeyConfig `yaml:"signing_keys"`
+	// SigningKeyID 签发新令牌使用的密钥
+	SigningKeyID string `yaml:"signing_key_id"`
+	// RevocationSyncInterval jwt模式从数据库同步吊销列表的间隔
+	RevocationSyncInterval time.Duration `yaml:"revocation_sync_interval"`
+}
+
+type SigningKeyConfig struct {
+	ID         string `yaml:"id"`
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secret_file"`
+}
+
+type ProviderConfig struct {
+	Type       string        `yaml:"type"`
+	Endpoint   string        `yaml:"endpoint"`
+	APIKey     string        `yaml:"api_key"`
+	APIKeyFile string        `yaml:"api_key_file"`
+	Model      string        `yaml:"model"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+type ModelsConfig struct {
+	// Default 未指定模型时使用的模型名，未配置deployments时为provider.model
+	Default string `yaml:"default"`
+	// Deployments 客户端可选的模型名到部署名（azure）或模型服务的模型名（openai）的映射，为空时只能使用provider.model
+	Deployments map[string]string `yaml:"deployments"`
+	// Tiers 各权限可以使用的模型名，未配置的权限可以使用所有模型
+	Tiers map[string][]string `yaml:"tiers"`
+	// ContextTokens 各模型的上下文长度（token数），未配置的模型使用DefaultContextTokens
+	ContextTokens        map[string]int `yaml:"context_tokens"`
+	DefaultContextTokens int            `yaml:"default_context_tokens"`
+	// ReservedTokens 为回答预留的token数，生成参数指定maxTokens时预留maxTokens
+	ReservedTokens int `yaml:"reserved_tokens"`
+}
+
+type QuotaConfig struct {
+	// Tiers 各权限的使用上限，未配置的权限不限制
+	Tiers map[string]QuotaLimitConfig `yaml:"tiers"`
+}
+
+// QuotaLimitConfig 消息数和token数的上限，0为不限制
+// 每日从本地时间0点、每月从1日0点开始计算
+type QuotaLimitConfig struct {
+	DailyMessages   int64 `yaml:"daily_messages"`
+	DailyTokens     int64 `yaml:"daily_tokens"`
+	MonthlyMessages int64 `yaml:"monthly_messages"`
+	MonthlyTokens   int64 `yaml:"monthly_tokens"`
+}
+
+type AudioConfig struct {
+	// Transcriber 语音识别服务，provider：使用provider的语音识别接口（Whisper），fake：进程内的模拟服务，none：不支持语音
+	Transcriber string `yaml:"transcriber"`
+	// Model 语音识别的部署名（azure）或模型名（openai）
+	Model string `yaml:"model"`
+	// Language 语音的语言（ISO-639-1，例如zh、en），为空时自动识别
+	Language string `yaml:"language"`
+	// MaxBytes 单个语音的最大字节数
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+type OCRConfig struct {
+	// Engine 文字识别引擎，vision：由视觉模型按提示词提取文字，tesseract：本地的tesseract命令，fake：进程内的模拟引擎，none：不支持ImageOCR
+	Engine string `yaml:"engine"`
+	// Model vision引擎使用的模型名（models中的模型名），为空时使用默认模型，不受models.tiers限制
+	Model string `yaml:"model"`
+	// TesseractPath tesseract命令的路径
+	TesseractPath string `yaml:"tesseract_path"`
+	// Languages 图片中文字的语言（ISO-639-1，例如zh、en）
+	Languages []string `yaml:"languages"`
+	// MaxBytes 单张图片的最大字节数
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Timeout 获取图片和识别文字的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type ImagesConfig struct {
+	// Store 图片的保存位置，local：本地文件系统
+	Store string `yaml:"store"`
+	// Dir local的保存目录
+	Dir string `yaml:"dir"`
+	// MaxBytes 单张图片的最大字节数
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Delivery 上传的图片发送给模型服务的方式，inline：data URL，signed：带签名的短期URL
+	Delivery string `yaml:"delivery"`
+	// PublicURL 服务的外部访问地址，signed时模型服务通过该地址获取图片，为空时返回给客户端的URL为相对路径
+	PublicURL string `yaml:"public_url"`
+	// SigningSecret 签名URL的密钥，为空时每次启动随机生成，多实例部署时需要配置相同的密钥
+	SigningSecret     string `yaml:"signing_secret"`
+	SigningSecretFile string `yaml:"signing_secret_file"`
+	// URLTTL 签名URL的有效期
+	URLTTL time.Duration `yaml:"url_ttl"`
+}
+
+type DocumentsConfig struct {
+	// MaxBytes 单个文档的最大字节数
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxChars 单个文档提取的最大字符数，超过时拒绝
+	MaxChars int `yaml:"max_chars"`
+	// ChunkChars 文档按该字符数分割为带页码的片段发送给模型
+	ChunkChars int `yaml:"chunk_chars"`
+}
+
+type KnowledgeConfig struct {
+	// Embedder 向量模型服务，provider：使用provider的embeddings接口，local：进程内按字词哈希生成向量（只用于开发和测试），none：不支持知识库
+	Embedder string `yaml:"embedder"`
+	// Model 向量模型的部署名（azure）或模型名（openai）
+	Model string `yaml:"model"`
+	// Dimensions 向量的维数，provider为0时使用模型的默认维数，local为0时使用512
+	Dimensions int `yaml:"dimensions"`
+	// VectorSearch 相似度检索方式，auto：pgvector可用时使用pgvector，pgvector：必须使用pgvector，brute_force：在服务端计算
+	VectorSearch string `yaml:"vector_search"`
+	// ChunkChars 文档按该字符数分割为片段
+	ChunkChars int `yaml:"chunk_chars"`
+	// BatchSize 每次请求生成向量的片段数
+	BatchSize int `yaml:"batch_size"`
+	// TopK 每轮对话引用的片段数
+	TopK int `yaml:"top_k"`
+	// MinScore 相似度（余弦）低于该值的片段不引用
+	MinScore float64 `yaml:"min_score"`
+	// MaxBytes 单个文档的最大字节数
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxChunks 单个文档的最大片段数
+	MaxChunks int `yaml:"max_chunks"`
+}
+
+type ToolsConfig struct {
+	// Enabled 模型可以调用的内置工具（calculator、current_time、unit_conversion），为空时不发送工具定义
+	Enabled []string `yaml:"enabled"`
+	// MaxSteps 每次回答最多执行几轮工具调用，达到后要求模型不再调用工具直接回答
+	MaxSteps int `yaml:"max_steps"`
+	// Timeout 每次工具调用的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+	// TimeZone current_time未指定时区时使用的时区（IANA名称），为空时使用服务器的时区
+	TimeZone string `yaml:"time_zone"`
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":12195",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   90 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 0,
+		},
+		CORS: CORSConfig{
+			AllowOrigins:     []string{"*"},
+			AllowMethods:     []string{"POST"},
+			AllowHeaders:     []string{"Origin", "Content-Type"},
+			ExposeHeaders:    []string{"Content-Length"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		},
+		Client: ClientConfig{
+			Version: "1.2.0",
+		},
+		Auth: AuthConfig{
+			BcryptCost:             12,
+			PasswordMinLength:      8,
+			PasswordRequireLetter:  true,
+			PasswordRequireDigit:   true,
+			AccessTokenTTL:         time.Hour,
+			IdleTimeout:            7 * 24 * time.Hour,
+			AbsoluteTimeout:        30 * 24 * time.Hour,
+			TokenMode:              "opaque",
+			RevocationSyncInterval: 30 * time.Second,
+		},
+		Provider: ProviderConfig{
+			Type:    "azure",
+			Timeout: 5 * time.Minute,
+		},
+		Models: ModelsConfig{
+			DefaultContextTokens: 16384,
+			ReservedTokens:       1024,
+		},
+		Audio: AudioConfig{
+			Transcriber: "provider",
+			Model:       "whisper-1",
+			MaxBytes:    25 << 20,
+		},
+		OCR: OCRConfig{
+			Engine:        "vision",
+			TesseractPath: "tesseract",
+			Languages:     []string{"zh", "en"},
+			MaxBytes:      20 << 20,
+			Timeout:       time.Minute,
+		},
+		Images: ImagesConfig{
+			Store:    "local",
+			Dir:      "data/images",
+			MaxBytes: 20 << 20,
+			Delivery: "inline",
+			URLTTL:   10 * time.Minute,
+		},
+		Documents: DocumentsConfig{
+			MaxBytes:   20 << 20,
+			MaxChars:   100000,
+			ChunkChars: 2000,
+		},
+		Knowledge: KnowledgeConfig{
+			Embedder:     "provider",
+			Model:        "text-embedding-3-small",
+			VectorSearch: "auto",
+			ChunkChars:   800,
+			BatchSize:    16,
+			TopK:         4,
+			MaxBytes:     50 << 20,
+			MaxChunks:    2000,
+		},
+		Tools: ToolsConfig{
+			Enabled:  []string{"calculator", "current_time", "unit_conversion"},
+			MaxSteps: 5,
+			Timeout:  10 * time.Second,
+		},
+	}
+}
+
+// Load 读取配置文件，应用环境变量覆盖并校验
+// path为空或文件不存在且optional为true时只使用默认值和环境变量
+func Load(path string, optional bool) (*Config, error) {
+	config, err := read(path, optional)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationError{}
+	config.applyEnv(report)
+	config.loadSecrets(report)
+	config.validate(report)
+	if len(report.Problems) > 0 {
+		return nil, report
+	}
+	return config, nil
+}
+
+// LoadDatabase 与Load相同，但只读取和校验数据库配置需要的密钥和配置项
+// 用于migrate子命令，不要求配置模型服务、认证等其他部分
+func LoadDatabase(path string, optional bool) (*Config, error) {
+	config, err := read(path, optional)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationError{}
+	config.applyEnv(report)
+	secretFile(report, "database.dsn_file", config.Database.DSNFile, &config.Database.DSN)
+	config.validateDatabase(report)
+	if len(report.Problems) > 0 {
+		return nil, report
+	}
+	return config, nil
+}
+
+// read 读取配置文件，未设置的项使用默认值
+func read(path string, optional bool) (*Config, error) {
+	config := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			// 空文件视为全部使用默认值
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("配置文件%s解析失败：%w", path, err)
+			}
+		case errors.Is(err, fs.ErrNotExist) && optional:
+		default:
+			return nil, fmt.Errorf("配置文件%s读取失败：%w", path, err)
+		}
+	}
+	return config, nil
+}
+
+// applyEnv 环境变量覆盖配置文件，变量名为LAOQG_<节>_<项>（大写），map和结构体列表只能在配置文件中设置
+func (config *Config) applyEnv(report *ValidationError) {
+	envString("LAOQG_SERVER_ADDR", &config.Server.Addr)
+	envDuration(report, "LAOQG_SERVER_READ_HEADER_TIMEOUT", &config.Server.ReadHeaderTimeout)
+	envDuration(report, "LAOQG_SERVER_SHUTDOWN_TIMEOUT", &config.Server.ShutdownTimeout)
+
+	envString("LAOQG_DATABASE_DSN", &config.Database.DSN)
+	envString("LAOQG_DATABASE_DSN_FILE", &config.Database.DSNFile)
+	envInt(report, "LAOQG_DATABASE_MAX_OPEN_CONNS", &config.Database.MaxOpenConns)
+	envInt(report, "LAOQG_DATABASE_MAX_IDLE_CONNS", &config.Database.MaxIdleConns)
+	envDuration(report, "LAOQG_DATABASE_CONN_MAX_LIFETIME", &config.Database.ConnMaxLifetime)
+	envBool(report, "LAOQG_DATABASE_AUTO_MIGRATE", &config.Database.AutoMigrate)
+
+	envList("LAOQG_CORS_ALLOW_ORIGINS", &config.CORS.AllowOrigins)
+	envList("LAOQG_CORS_ALLOW_METHODS", &config.CORS.AllowMethods)
+	envList("LAOQG_CORS_ALLOW_HEADERS", &config.CORS.AllowHeaders)
+	envList("LAOQG_CORS_EXPOSE_HEADERS", &config.CORS.ExposeHeaders)
+	envBool(report, "LAOQG_CORS_ALLOW_CREDENTIALS", &config.CORS.AllowCredentials)
+	envDuration(report, "LAOQG_CORS_MAX_AGE", &config.CORS.MaxAge)
+
+	envString("LAOQG_CLIENT_VERSION", &config.Client.Version)
+
+	envInt(report, "LAOQG_AUTH_BCRYPT_COST", &config.Auth.BcryptCost)
+	envInt(report, "LAOQG_AUTH_PASSWORD_MIN_LENGTH", &config.Auth.PasswordMinLength)
+	envBool(report, "LAOQG_AUTH_PASSWORD_REQUIRE_LETTER", &config.Auth.PasswordRequireLetter)
+	envBool(report, "LAOQG_AUTH_PASSWORD_REQUIRE_DIGIT", &config.Auth.PasswordRequireDigit)
+	envDuration(report, "LAOQG_AUTH_ACCESS_TOKEN_TTL", &config.Auth.AccessTokenTTL)
+	envDuration(report, "LAOQG_AUTH_IDLE_TIMEOUT", &config.Auth.IdleTimeout)
+	envDuration(report, "LAOQG_AUTH_ABSOLUTE_TIMEOUT", &config.Auth.AbsoluteTimeout)
+	envString("LAOQG_AUTH_TOKEN_MODE", &config.Auth.TokenMode)
+	envString("LAOQG_AUTH_SIGNING_KEY_ID", &config.Auth.SigningKeyID)
+	envDuration(report, "LAOQG_AUTH_REVOCATION_SYNC_INTERVAL", &config.Auth.RevocationSyncInterval)
+
+	// 兼容旧版本的AOAI_*环境变量
+	envString("AOAI_ENDPOINT", &config.Provider.Endpoint)
+	envString("AOAI_API_KEY", &config.Provider.APIKey)
+	envString("AOAI_CHAT_COMPLETIONS_MODEL", &config.Provider.Model)
+	envString("LAOQG_PROVIDER_TYPE", &config.Provider.Type)
+	envString("LAOQG_PROVIDER_ENDPOINT", &config.Provider.Endpoint)
+	envString("LAOQG_PROVIDER_API_KEY", &config.Provider.APIKey)
+	envString("LAOQG_PROVIDER_API_KEY_FILE", &config.Provider.APIKeyFile)
+	envString("LAOQG_PROVIDER_MODEL", &config.Provider.Model)
+	envDuration(report, "LAOQG_PROVIDER_TIMEOUT", &config.Provider.Timeout)
+
+	envString("LAOQG_MODELS_DEFAULT", &config.Models.Default)
+	envInt(report, "LAOQG_MODELS_DEFAULT_CONTEXT_TOKENS", &config.Models.DefaultContextTokens)
+	envInt(report, "LAOQG_MODELS_RESERVED_TOKENS", &config.Models.ReservedTokens)
+
+	envString("LAOQG_AUDIO_TRANSCRIBER", &config.Audio.Transcriber)
+	envString("LAOQG_AUDIO_MODEL", &config.Audio.Model)
+	envString("LAOQG_AUDIO_LANGUAGE", &config.Audio.Language)
+	envInt64(report, "LAOQG_AUDIO_MAX_BYTES", &config.Audio.MaxBytes)
+
+	envString("LAOQG_OCR_ENGINE", &config.OCR.Engine)
+	envString("LAOQG_OCR_MODEL", &config.OCR.Model)
+	envString("LAOQG_OCR_TESSERACT_PATH", &config.OCR.TesseractPath)
+	envList("LAOQG_OCR_LANGUAGES", &config.OCR.Languages)
+	envInt64(report, "LAOQG_OCR_MAX_BYTES", &config.OCR.MaxBytes)
+	envDuration(report, "LAOQG_OCR_TIMEOUT", &config.OCR.Timeout)
+
+	envString("LAOQG_IMAGES_STORE", &config.Images.Store)
+	envString("LAOQG_IMAGES_DIR", &config.Images.Dir)
+	envInt64(report, "LAOQG_IMAGES_MAX_BYTES", &config.Images.MaxBytes)
+	envString("LAOQG_IMAGES_DELIVERY", &config.Images.Delivery)
+	envString("LAOQG_IMAGES_PUBLIC_URL", &config.Images.PublicURL)
+	envString("LAOQG_IMAGES_SIGNING_SECRET", &config.Images.SigningSecret)
+	envString("LAOQG_IMAGES_SIGNING_SECRET_FILE", &config.Images.SigningSecretFile)
+	envDuration(report, "LAOQG_IMAGES_URL_TTL", &config.Images.URLTTL)
+
+	envInt64(report, "LAOQG_DOCUMENTS_MAX_BYTES", &config.Documents.MaxBytes)
+	envInt(report, "LAOQG_DOCUMENTS_MAX_CHARS", &config.Documents.MaxChars)
+	envInt(report, "LAOQG_DOCUMENTS_CHUNK_CHARS", &config.Documents.ChunkChars)
+
+	envString("LAOQG_KNOWLEDGE_EMBEDDER", &config.Knowledge.Embedder)
+	envString("LAOQG_KNOWLEDGE_MODEL", &config.Knowledge.Model)
+	envInt(report, "LAOQG_KNOWLEDGE_DIMENSIONS", &config.Knowledge.Dimensions)
+	envString("LAOQG_KNOWLEDGE_VECTOR_SEARCH", &config.Knowledge.VectorSearch)
+	envInt(report, "LAOQG_KNOWLEDGE_CHUNK_CHARS", &config.Knowledge.ChunkChars)
+	envInt(report, "LAOQG_KNOWLEDGE_BATCH_SIZE", &config.Knowledge.BatchSize)
+	envInt(report, "LAOQG_KNOWLEDGE_TOP_K", &config.Knowledge.TopK)
+	envFloat(report, "LAOQG_KNOWLEDGE_MIN_SCORE", &config.Knowledge.MinScore)
+	envInt64(report, "LAOQG_KNOWLEDGE_MAX_BYTES", &config.Knowledge.MaxBytes)
+	envInt(report, "LAOQG_KNOWLEDGE_MAX_CHUNKS", &config.Knowledge.MaxChunks)
+
+	envList("LAOQG_TOOLS_ENABLED", &config.Tools.Enabled)
+	envInt(report, "LAOQG_TOOLS_MAX_STEPS", &config.Tools.MaxSteps)
+	envDuration(report, "LAOQG_TOOLS_TIMEOUT", &config.Tools.Timeout)
+	envString("LAOQG_TOOLS_TIME_ZONE", &config.Tools.TimeZone)
+}
+
+// loadSecrets 从文件读取密钥，文件优先于明文配置
+func (config *Config) loadSecrets(report *ValidationError) {
+	secretFile(report, "database.dsn_file", config.Database.DSNFile, &config.Database.DSN)
+	secretFile(report, "provider.api_key_file", config.Provider.APIKeyFile, &config.Provider.APIKey)
+	secretFile(report, "images.signing_secret_file", config.Images.SigningSecretFile, &config.Images.SigningSecret)
+	for i := range config.Auth.SigningKeys {
+		key := &config.Auth.SigningKeys[i]
+		secretFile(report, fmt.Sprintf("auth.signing_keys[%d].secret_file", i), key.SecretFile, &key.Secret)
+	}
+}
+
+func envString(key string, target *string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*target = value
+	}
+}
+
+func envList(key string, target *[]string) {
+	if value, ok := os.LookupEnv(key); ok {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*target = list
+	}
+}
+
+func envInt(report *ValidationError, key string, target *int) {
+	if value, ok := os.LookupEnv(key); ok {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			report.add("环境变量%s不是整数：%q", key, value)
+			return
+		}
+		*target = number
+	}
+}
+
+func envInt64(report *ValidationError, key string, target *int64) {
+	if value, ok := os.LookupEnv(key); ok {
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			report.add("环境变量%s不是整数：%q", key, value)
+			return
+		}
+		*target = number
+	}
+}
+
+func envFloat(report *ValidationError, key string, target *float64) {
+	if value, ok := os.LookupEnv(key); ok {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			report.add("环境变量%s不是数值：%q", key, value)
+			return
+		}
+		*target = number
+	}
+}
+
+func envBool(report *ValidationError, key string, target *bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			report.add("环境变量%s不是布尔值：%q", key, value)
+			return
+		}
+		*target = flag
+	}
+}
+
+func envDuration(report *ValidationError, key string, target *time.Duration) {
+	if value, ok := os.LookupEnv(key); ok {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			report.add("环境变量%s不是有效的时长：%q", key, value)
+			return
+		}
+		*target = duration
+	}
+}
+
+func secretFile(report *ValidationError, name string, path string, target *string) {
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		report.add("%s读取失败：%v", name, err)
+		return
+	}
+	*target = strings.TrimRight(string(data), "\r\n")
+}
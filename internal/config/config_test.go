@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv 清除会覆盖配置的环境变量，测试结束后恢复
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(key, "LAOQG_") || strings.HasPrefix(key, "AOAI_") {
+			t.Setenv(key, "")
+			_ = os.Unsetenv(key)
+		}
+	}
+}
+
+// setValidEnv 设置通过校验需要的环境变量
+func setValidEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("LAOQG_DATABASE_DSN", "dsn")
+	t.Setenv("LAOQG_PROVIDER_ENDPOINT", "https://example.openai.azure.com")
+	t.Setenv("LAOQG_PROVIDER_API_KEY", "key")
+	t.Setenv("LAOQG_PROVIDER_MODEL", "gpt-4o")
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// validConfig 通过校验的配置
+func validConfig() *Config {
+	config := Default()
+	config.Database.DSN = "host=localhost"
+	config.Provider.Endpoint = "https://example.openai.azure.com"
+	config.Provider.APIKey = "key"
+	config.Provider.Model = "gpt-4o"
+	return config
+}
+
+func TestLoadEnvOverride(t *testing.T) {
+	clearEnv(t)
+	setValidEnv(t)
+	path := writeFile(t, "config.yaml", `
+database:
+  dsn: "from-file"
+  max_open_conns: 20
+cors:
+  allow_origins: ["https://a.example"]
+`)
+	t.Setenv("LAOQG_DATABASE_DSN", "from-env")
+	t.Setenv("LAOQG_CORS_ALLOW_ORIGINS", " https://b.example , ,https://c.example ")
+	t.Setenv("LAOQG_CORS_ALLOW_CREDENTIALS", "false")
+	t.Setenv("LAOQG_CORS_MAX_AGE", "30m")
+	t.Setenv("LAOQG_SERVER_SHUTDOWN_TIMEOUT", "2m")
+	t.Setenv("LAOQG_AUDIO_MAX_BYTES", "1048576")
+	t.Setenv("LAOQG_KNOWLEDGE_MIN_SCORE", "0.25")
+	t.Setenv("LAOQG_TOOLS_MAX_STEPS", "3")
+
+	config, err := Load(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"环境变量优先于配置文件", config.Database.DSN, "from-env"},
+		{"未覆盖的项使用配置文件", config.Database.MaxOpenConns, 20},
+		{"未设置的项使用默认值", config.Database.MaxIdleConns, 10},
+		{"列表去掉空白和空项", config.CORS.AllowOrigins, []string{"https://b.example", "https://c.example"}},
+		{"布尔值", config.CORS.AllowCredentials, false},
+		{"时长", config.CORS.MaxAge, 30 * time.Minute},
+		{"服务的时长", config.Server.ShutdownTimeout, 2 * time.Minute},
+		{"int64", config.Audio.MaxBytes, int64(1 << 20)},
+		{"浮点数", config.Knowledge.MinScore, 0.25},
+		{"整数", config.Tools.MaxSteps, 3},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadLegacyEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("LAOQG_DATABASE_DSN", "dsn")
+	t.Setenv("AOAI_ENDPOINT", "https://legacy.example")
+	t.Setenv("AOAI_API_KEY", "legacy-key")
+	t.Setenv("AOAI_CHAT_COMPLETIONS_MODEL", "gpt-4o")
+	// 新的变量名优先
+	t.Setenv("LAOQG_PROVIDER_MODEL", "gpt-4o-mini")
+
+	config, err := Load("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Provider.Endpoint != "https://legacy.example" || config.Provider.APIKey != "legacy-key" ||
+		config.Provider.Model != "gpt-4o-mini" {
+		t.Errorf("Provider = %+v", config.Provider)
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	clearEnv(t)
+	setValidEnv(t)
+	t.Setenv("LAOQG_DATABASE_MAX_OPEN_CONNS", "ten")
+	t.Setenv("LAOQG_CORS_ALLOW_CREDENTIALS", "yes")
+	t.Setenv("LAOQG_CORS_MAX_AGE", "10")
+	t.Setenv("LAOQG_DATABASE_AUTO_MIGRATE", "on")
+	t.Setenv("LAOQG_IMAGES_MAX_BYTES", "1.5")
+	t.Setenv("LAOQG_KNOWLEDGE_MIN_SCORE", "high")
+	t.Setenv("LAOQG_TOOLS_TIMEOUT", "10")
+
+	_, err := Load("", true)
+	var report *ValidationError
+	if !errors.As(err, &report) {
+		t.Fatalf("Load() error = %v, want *ValidationError", err)
+	}
+	// 所有错误一起报告
+	for _, key := range []string{
+		"LAOQG_DATABASE_MAX_OPEN_CONNS",
+		"LAOQG_CORS_ALLOW_CREDENTIALS",
+		"LAOQG_CORS_MAX_AGE",
+		"LAOQG_DATABASE_AUTO_MIGRATE",
+		"LAOQG_IMAGES_MAX_BYTES",
+		"LAOQG_KNOWLEDGE_MIN_SCORE",
+		"LAOQG_TOOLS_TIMEOUT",
+	} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Load() error does not mention %s:\n%v", key, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	setValidEnv(t)
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	tests := []struct {
+		name     string
+		path     string
+		optional bool
+		wantErr  bool
+	}{
+		{"不指定文件", "", false, false},
+		{"文件不存在且可选", missing, true, false},
+		{"文件不存在", missing, false, true},
+		{"空文件", writeFile(t, "empty.yaml", ""), false, false},
+		{"未知的配置项", writeFile(t, "unknown.yaml", "server:\n  port: 80\n"), false, true},
+		{"格式错误", writeFile(t, "invalid.yaml", "server: [\n"), false, true},
+	}
+	for _, test := range tests {
+		_, err := Load(test.path, test.optional)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Load() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	clearEnv(t)
+	setValidEnv(t)
+	t.Setenv("LAOQG_DATABASE_DSN", "plain")
+	t.Setenv("LAOQG_DATABASE_DSN_FILE", writeFile(t, "dsn", "from-secret\r\n"))
+
+	config, err := Load("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Database.DSN != "from-secret" {
+		t.Errorf("DSN = %q, want from-secret", config.Database.DSN)
+	}
+
+	t.Setenv("LAOQG_DATABASE_DSN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Load("", true); err == nil || !strings.Contains(err.Error(), "database.dsn_file") {
+		t.Errorf("Load() error = %v, want database.dsn_file problem", err)
+	}
+}
+
+func TestLoadDatabase(t *testing.T) {
+	clearEnv(t)
+	// 模型服务等其他部分不完整时也可以执行迁移
+	t.Setenv("LAOQG_PROVIDER_TYPE", "azure")
+	t.Setenv("LAOQG_AUTH_TOKEN_MODE", "jwt")
+	t.Setenv("LAOQG_DATABASE_DSN", "dsn")
+	if _, err := Load("", true); err == nil {
+		t.Fatal("Load() succeeded without provider settings")
+	}
+	config, err := LoadDatabase("", true)
+	if err != nil {
+		t.Fatalf("LoadDatabase() error = %v", err)
+	}
+	if config.Database.DSN != "dsn" {
+		t.Errorf("DSN = %q, want dsn", config.Database.DSN)
+	}
+
+	t.Setenv("LAOQG_DATABASE_DSN", "")
+	if _, err := LoadDatabase("", true); err == nil || !strings.Contains(err.Error(), "database.dsn") {
+		t.Errorf("LoadDatabase() error = %v, want database.dsn problem", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *Config)
+		want   string
+	}{
+		{"有效配置", func(config *Config) {}, ""},
+		{"服务地址", func(config *Config) { config.Server.Addr = "12195" }, "server.addr"},
+		{"关闭超时", func(config *Config) { config.Server.ShutdownTimeout = 0 }, "server.shutdown_timeout"},
+		{"没有数据库", func(config *Config) { config.Database.DSN = "" }, "database.dsn"},
+		{"空闲连接数超过最大连接数", func(config *Config) { config.Database.MaxIdleConns = 20 }, "database.max_idle_conns"},
+		{"CORS通配符", func(config *Config) { config.CORS.AllowOrigins = []string{"*", "https://a.example"} }, "cors.allow_origins"},
+		{"客户端版本", func(config *Config) { config.Client.Version = "1.x" }, "client.version"},
+		{"bcrypt强度", func(config *Config) { config.Auth.BcryptCost = 3 }, "auth.bcrypt_cost"},
+		{"密码最小长度", func(config *Config) { config.Auth.PasswordMinLength = 0 }, "auth.password_min_length"},
+		{"空闲超时小于令牌有效期", func(config *Config) { config.Auth.IdleTimeout = time.Minute }, "auth.idle_timeout"},
+		{"jwt密钥太短", func(config *Config) {
+			config.Auth.TokenMode = "jwt"
+			config.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1", Secret: "short"}}
+			config.Auth.SigningKeyID = "k1"
+		}, "auth.signing_keys[0].secret"},
+		{"jwt密钥不存在", func(config *Config) {
+			config.Auth.TokenMode = "jwt"
+			config.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1", Secret: strings.Repeat("s", 32)}}
+			config.Auth.SigningKeyID = "k2"
+		}, "auth.signing_key_id"},
+		{"jwt密钥id重复", func(config *Config) {
+			config.Auth.TokenMode = "jwt"
+			config.Auth.SigningKeys = []SigningKeyConfig{
+				{ID: "k1", Secret: strings.Repeat("s", 32)},
+				{ID: "k1", Secret: strings.Repeat("t", 32)},
+			}
+			config.Auth.SigningKeyID = "k1"
+		}, "auth.signing_keys[1].id"},
+		{"额度权限不存在", func(config *Config) { config.Quota.Tiers = map[string]QuotaLimitConfig{"vip9": {}} }, "quota.tiers"},
+		{"azure缺少密钥", func(config *Config) { config.Provider.APIKey = "" }, "provider.api_key"},
+		{"不支持的模型服务", func(config *Config) { config.Provider.Type = "other" }, "provider.type"},
+		{"openai缺少地址", func(config *Config) { config.Provider = ProviderConfig{Type: "openai", Model: "gpt-4o"} }, "provider.endpoint"},
+		{"fake不需要地址和密钥", func(config *Config) { config.Provider = ProviderConfig{Type: "fake"} }, ""},
+		{"默认模型不在部署中", func(config *Config) {
+			config.Models.Deployments = map[string]string{"gpt-4o": "gpt-4o"}
+			config.Models.Default = "gpt-4o-mini"
+		}, "models.default"},
+		{"上下文长度不大于预留", func(config *Config) { config.Models.DefaultContextTokens = 1024 }, "models.default_context_tokens"},
+		{"OCR模型不存在", func(config *Config) { config.OCR.Model = "vision-model" }, "ocr.model"},
+		{"OCR模型不受权限限制", func(config *Config) {
+			config.Models.Deployments = map[string]string{"gpt-4o": "gpt-4o", "vision-model": "vision"}
+			config.Models.Default = "gpt-4o"
+			config.Models.Tiers = map[string][]string{"normal": {"gpt-4o"}}
+			config.OCR.Model = "vision-model"
+		}, ""},
+		{"OCR模型不在部署中", func(config *Config) {
+			config.Models.Deployments = map[string]string{"vision-model": "vision"}
+			config.Models.Default = "vision-model"
+			config.OCR.Model = "gpt-4o"
+		}, "ocr.model"},
+		{"签名图片需要公开地址", func(config *Config) { config.Images.Delivery = "signed" }, "images.public_url"},
+		{"文档片段超过上限", func(config *Config) { config.Documents.MaxChars = 100 }, "documents.max_chars"},
+		{"相似度下限", func(config *Config) { config.Knowledge.MinScore = 1.5 }, "knowledge.min_score"},
+		{"不支持的工具", func(config *Config) { config.Tools.Enabled = []string{"shell"} }, "tools.enabled[0]"},
+		{"工具重复", func(config *Config) { config.Tools.Enabled = []string{"calculator", "calculator"} }, "tools.enabled[1]"},
+		{"时区", func(config *Config) { config.Tools.TimeZone = "Mars/Olympus" }, "tools.time_zone"},
+	}
+	for _, test := range tests {
+		config := validConfig()
+		test.modify(config)
+		report := &ValidationError{}
+		config.validate(report)
+		if test.want == "" {
+			if len(report.Problems) > 0 {
+				t.Errorf("%s: validate() = %v, want no problems", test.name, report.Problems)
+			}
+			continue
+		}
+		if !strings.Contains(report.Error(), test.want) {
+			t.Errorf("%s: validate() = %v, want problem about %s", test.name, report.Problems, test.want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidationError 配置校验报告，包含全部校验失败项
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "配置校验失败：\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (e *ValidationError) add(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// permissions account.permission允许的值
+var permissions = []string{"normal", "vip1", "vip2", "vip3", "vip4", "vip5", "super"}
+
+func (config *Config) validate(report *ValidationError) {
+	// 服务
+	if _, _, err := net.SplitHostPort(config.Server.Addr); err != nil {
+		report.add("server.addr格式错误：%q", config.Server.Addr)
+	}
+	if config.Server.ReadHeaderTimeout < 0 {
+		report.add("server.read_header_timeout不能为负数")
+	}
+	if config.Server.ShutdownTimeout <= 0 {
+		report.add("server.shutdown_timeout必须大于0")
+	}
+
+	// 数据库
+	config.validateDatabase(report)
+
+	// CORS
+	if len(config.CORS.AllowOrigins) == 0 {
+		report.add("cors.allow_origins不能为空")
+	}
+	for _, origin := range config.CORS.AllowOrigins {
+		if origin == "*" && len(config.CORS.AllowOrigins) > 1 {
+			report.add("cors.allow_origins包含*时不能再指定其他域名")
+			break
+		}
+	}
+	if len(config.CORS.AllowMethods) == 0 {
+		report.add("cors.allow_methods不能为空")
+	}
+
+	// 客户端版本
+	versionList := strings.Split(config.Client.Version, ".")
+	if len(versionList) < 2 {
+		report.add("client.version格式错误：%q", config.Client.Version)
+	} else {
+		for _, part := range versionList {
+			if _, err := strconv.Atoi(part); err != nil {
+				report.add("client.version格式错误：%q", config.Client.Version)
+				break
+			}
+		}
+	}
+
+	// 认证
+	if config.Auth.BcryptCost < bcrypt.MinCost || config.Auth.BcryptCost > bcrypt.MaxCost {
+		report.add("auth.bcrypt_cost必须在%d到%d之间", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if config.Auth.PasswordMinLength < 1 || config.Auth.PasswordMinLength > 72 {
+		report.add("auth.password_min_length必须在1到72之间")
+	}
+	switch {
+	case config.Auth.AccessTokenTTL <= 0:
+		report.add("auth.access_token_ttl必须大于0")
+	case config.Auth.IdleTimeout < config.Auth.AccessTokenTTL:
+		report.add("auth.idle_timeout不能小于auth.access_token_ttl")
+	case config.Auth.AbsoluteTimeout < config.Auth.IdleTimeout:
+		report.add("auth.absolute_timeout不能小于auth.idle_timeout")
+	}
+	switch config.Auth.TokenMode {
+	case "opaque":
+	case "jwt":
+		// HS256的密钥至少需要32字节
+		keyIDs := make(map[string]bool, len(config.Auth.SigningKeys))
+		for i, key := range config.Auth.SigningKeys {
+			if key.ID == "" {
+				report.add("auth.signing_keys[%d].id不能为空", i)
+			} else if keyIDs[key.ID] {
+				report.add("auth.signing_keys[%d].id重复：%q", i, key.ID)
+			}
+			keyIDs[key.ID] = true
+			if len(key.Secret) < 32 {
+				report.add("auth.signing_keys[%d].secret至少需要32字节", i)
+			}
+		}
+		if config.Auth.SigningKeyID == "" || !keyIDs[config.Auth.SigningKeyID] {
+			report.add("auth.signing_key_id必须是auth.signing_keys中的一个id")
+		}
+		if config.Auth.RevocationSyncInterval <= 0 {
+			report.add("auth.revocation_sync_interval必须大于0")
+		}
+	default:
+		report.add("auth.token_mode必须是opaque或jwt：%q", config.Auth.TokenMode)
+	}
+
+	// 额度
+	for tier, limit := range config.Quota.Tiers {
+		if !slices.Contains(permissions, tier) {
+			report.add("quota.tiers中的权限不存在：%q", tier)
+		}
+		if limit.DailyMessages < 0 || limit.DailyTokens < 0 || limit.MonthlyMessages < 0 || limit.MonthlyTokens < 0 {
+			report.add("quota.tiers.%s的上限不能小于0", tier)
+		}
+	}
+
+	// 模型服务
+	switch config.Provider.Type {
+	case "azure":
+		if config.Provider.Endpoint == "" {
+			report.add("未设置provider.endpoint（或AOAI_ENDPOINT）")
+		}
+		if config.Provider.APIKey == "" {
+			report.add("未设置provider.api_key（或provider.api_key_file、AOAI_API_KEY）")
+		}
+		if config.Provider.Model == "" {
+			report.add("未设置provider.model（或AOAI_CHAT_COMPLETIONS_MODEL）")
+		}
+	case "openai":
+		if config.Provider.Endpoint == "" {
+			report.add("未设置provider.endpoint（或LAOQG_PROVIDER_ENDPOINT）")
+		}
+		if config.Provider.Model == "" {
+			report.add("未设置provider.model（或LAOQG_PROVIDER_MODEL）")
+		}
+	case "fake":
+	default:
+		report.add("不支持的provider.type：%q（可选azure、openai、fake）", config.Provider.Type)
+	}
+	if config.Provider.Timeout < 0 {
+		report.add("provider.timeout不能为负数")
+	}
+
+	// 模型
+	if len(config.Models.Deployments) > 0 {
+		if _, ok := config.Models.Deployments[config.Models.Default]; !ok {
+			report.add("配置models.deployments时models.default必须是其中的模型名：%q", config.Models.Default)
+		}
+	} else if config.Models.Default != "" && config.Models.Default != config.Provider.Model {
+		report.add("未配置models.deployments时models.default只能是provider.model：%q", config.Models.Default)
+	}
+	for tier, names := range config.Models.Tiers {
+		if !slices.Contains(permissions, tier) {
+			report.add("models.tiers中的权限不存在：%q", tier)
+		}
+		for _, name := range names {
+			if _, ok := config.Models.Deployments[name]; !ok && name != config.Provider.Model {
+				report.add("models.tiers.%s中的模型不存在：%q", tier, name)
+			}
+		}
+	}
+	for name, tokens := range config.Models.ContextTokens {
+		if tokens <= config.Models.ReservedTokens {
+			report.add("models.context_tokens.%s必须大于models.reserved_tokens", name)
+		}
+	}
+	if config.Models.DefaultContextTokens <= config.Models.ReservedTokens {
+		report.add("models.default_context_tokens必须大于models.reserved_tokens")
+	}
+	if config.Models.ReservedTokens < 0 {
+		report.add("models.reserved_tokens不能为负数")
+	}
+
+	// 语音
+	switch config.Audio.Transcriber {
+	case "provider":
+		if config.Provider.Type != "fake" && config.Audio.Model == "" {
+			report.add("未设置audio.model")
+		}
+	case "fake", "none":
+	default:
+		report.add("不支持的audio.transcriber：%q（可选provider、fake、none）", config.Audio.Transcriber)
+	}
+	if config.Audio.MaxBytes <= 0 {
+		report.add("audio.max_bytes必须大于0")
+	}
+
+	// 文字识别
+	switch config.OCR.Engine {
+	case "vision":
+		// ocr.model由管理员指定，识别文字时有意不检查models.tiers，所有权限都可以使用，只检查模型存在
+		// 未配置models.deployments时只能使用provider.model
+		if config.OCR.Model != "" {
+			_, ok := config.Models.Deployments[config.OCR.Model]
+			if len(config.Models.Deployments) == 0 {
+				ok = config.OCR.Model == config.Provider.Model
+			}
+			if !ok {
+				report.add("ocr.model不存在：%q", config.OCR.Model)
+			}
+		}
+	case "tesseract":
+		if config.OCR.TesseractPath == "" {
+			report.add("未设置ocr.tesseract_path")
+		}
+	case "fake", "none":
+	default:
+		report.add("不支持的ocr.engine：%q（可选vision、tesseract、fake、none）", config.OCR.Engine)
+	}
+	if config.OCR.MaxBytes <= 0 {
+		report.add("ocr.max_bytes必须大于0")
+	}
+	if config.OCR.Timeout <= 0 {
+		report.add("ocr.timeout必须大于0")
+	}
+
+	// 图片
+	switch config.Images.Store {
+	case "local":
+		if config.Images.Dir == "" {
+			report.add("未设置images.dir")
+		}
+	default:
+		report.add("不支持的images.store：%q（可选local）", config.Images.Store)
+	}
+	if config.Images.MaxBytes <= 0 {
+		report.add("images.max_bytes必须大于0")
+	}
+	switch config.Images.Delivery {
+	case "inline":
+	case "signed":
+		if config.Images.PublicURL == "" {
+			report.add("images.delivery为signed时需要设置images.public_url")
+		}
+	default:
+		report.add("images.delivery必须是inline或signed：%q", config.Images.Delivery)
+	}
+	if config.Images.PublicURL != "" && !strings.HasPrefix(config.Images.PublicURL, "http://") &&
+		!strings.HasPrefix(config.Images.PublicURL, "https://") {
+		report.add("images.public_url必须以http://或https://开头：%q", config.Images.PublicURL)
+	}
+	if config.Images.SigningSecret != "" && len(config.Images.SigningSecret) < 32 {
+		report.add("images.signing_secret至少需要32字节")
+	}
+	if config.Images.URLTTL <= 0 {
+		report.add("images.url_ttl必须大于0")
+	}
+
+	// 文档
+	if config.Documents.MaxBytes <= 0 {
+		report.add("documents.max_bytes必须大于0")
+	}
+	if config.Documents.ChunkChars <= 0 {
+		report.add("documents.chunk_chars必须大于0")
+	}
+	if config.Documents.MaxChars < config.Documents.ChunkChars {
+		report.add("documents.max_chars不能小于documents.chunk_chars")
+	}
+
+	// 知识库
+	switch config.Knowledge.Embedder {
+	case "provider":
+		if config.Provider.Type != "fake" && config.Knowledge.Model == "" {
+			report.add("未设置knowledge.model")
+		}
+	case "local", "none":
+	default:
+		report.add("不支持的knowledge.embedder：%q（可选provider、local、none）", config.Knowledge.Embedder)
+	}
+	if config.Knowledge.Dimensions < 0 {
+		report.add("knowledge.dimensions不能小于0")
+	}
+	switch config.Knowledge.VectorSearch {
+	case "auto", "pgvector", "brute_force":
+	default:
+		report.add("不支持的knowledge.vector_search：%q（可选auto、pgvector、brute_force）", config.Knowledge.VectorSearch)
+	}
+	if config.Knowledge.ChunkChars <= 0 {
+		report.add("knowledge.chunk_chars必须大于0")
+	}
+	if config.Knowledge.BatchSize <= 0 {
+		report.add("knowledge.batch_size必须大于0")
+	}
+	if config.Knowledge.TopK <= 0 {
+		report.add("knowledge.top_k必须大于0")
+	}
+	if config.Knowledge.MinScore < -1 || config.Knowledge.MinScore > 1 {
+		report.add("knowledge.min_score必须在-1到1之间")
+	}
+	if config.Knowledge.MaxBytes <= 0 {
+		report.add("knowledge.max_bytes必须大于0")
+	}
+	if config.Knowledge.MaxChunks <= 0 {
+		report.add("knowledge.max_chunks必须大于0")
+	}
+
+	// 工具
+	toolNames := []string{"calculator", "current_time", "unit_conversion"}
+	for i, name := range config.Tools.Enabled {
+		if !slices.Contains(toolNames, name) {
+			report.add("不支持的tools.enabled[%d]：%q（可选%s）", i, name, strings.Join(toolNames, "、"))
+		} else if slices.Contains(config.Tools.Enabled[:i], name) {
+			report.add("tools.enabled[%d]重复：%q", i, name)
+		}
+	}
+	if config.Tools.MaxSteps <= 0 {
+		report.add("tools.max_steps必须大于0")
+	}
+	if config.Tools.Timeout <= 0 {
+		report.add("tools.timeout必须大于0")
+	}
+	if config.Tools.TimeZone != "" {
+		if _, err := time.LoadLocation(config.Tools.TimeZone); err != nil {
+			report.add("不支持的tools.time_zone：%q", config.Tools.TimeZone)
+		}
+	}
+}
+
+// validateDatabase 校验数据库配置，migrate子命令只校验这一部分
+func (config *Config) validateDatabase(report *ValidationError) {
+	if config.Database.DSN == "" {
+		report.add("未设置database.dsn（或database.dsn_file、LAOQG_DATABASE_DSN）")
+	}
+	if config.Database.MaxOpenConns < 0 {
+		report.add("database.max_open_conns不能为负数")
+	}
+	if config.Database.MaxIdleConns < 0 {
+		report.add("database.max_idle_conns不能为负数")
+	}
+	if config.Database.MaxOpenConns > 0 && config.Database.MaxIdleConns > config.Database.MaxOpenConns {
+		report.add("database.max_idle_conns不能大于database.max_open_conns")
+	}
+	if config.Database.ConnMaxLifetime < 0 {
+		report.add("database.conn_max_lifetime不能为负数")
+	}
+}
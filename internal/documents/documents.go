@@ -0,0 +1,137 @@
+// Package documents 提取PDF、DOCX、Markdown和纯文本文档的文字，并按长度分割为带页码的片段
+package documents
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	MimeTypePDF      = "application/pdf"
+	MimeTypeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimeTypeMarkdown = "text/markdown"
+	MimeTypeText     = "text/plain"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document format")
+	ErrInvalid     = errors.New("invalid document")
+)
+
+// Page 文档的一页，Number从1开始，没有分页信息（Markdown、纯文本、没有分页符的DOCX）时为0
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Chunk 分割后的片段，PageStart和PageEnd为片段所在的页，没有分页信息时为0
+type Chunk struct {
+	PageStart int
+	PageEnd   int
+	Text      string
+}
+
+// Detect 按内容检测文档格式，纯文本按文件扩展名区分Markdown
+func Detect(data []byte, fileName string) (string, error) {
+	mime := mimetype.Detect(data)
+	switch {
+	case mime.Is(MimeTypePDF):
+		return MimeTypePDF, nil
+	case mime.Is(MimeTypeDOCX):
+		return MimeTypeDOCX, nil
+	case mime.Is(MimeTypeText):
+		if !utf8.Valid(data) {
+			return "", ErrUnsupported
+		}
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".md", ".markdown":
+			return MimeTypeMarkdown, nil
+		}
+		return MimeTypeText, nil
+	default:
+		return "", ErrUnsupported
+	}
+}
+
+// Extract 按格式提取文档的文字
+func Extract(data []byte, mimeType string) ([]Page, error) {
+	switch mimeType {
+	case MimeTypePDF:
+		return extractPDF(data)
+	case MimeTypeDOCX:
+		return extractDOCX(data)
+	case MimeTypeMarkdown, MimeTypeText:
+		text := strings.ReplaceAll(string(data), "\r\n", "\n")
+		return []Page{{Number: 0, Text: strings.TrimPrefix(text, "\uFEFF")}}, nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// Split 将文档分割为不超过maxChars个字符的片段，优先在段落之间分割，段落超长时按字符数截断
+func Split(pages []Page, maxChars int) []Chunk {
+	var (
+		chunks  []Chunk
+		current Chunk
+		builder strings.Builder
+		length  int
+	)
+	flush := func() {
+		text := strings.TrimSpace(builder.String())
+		if text != "" {
+			current.Text = text
+			chunks = append(chunks, current)
+		}
+		current = Chunk{}
+		builder.Reset()
+		length = 0
+	}
+	add := func(page int, paragraph string, paragraphLength int) {
+		if builder.Len() == 0 {
+			current.PageStart = page
+		}
+		current.PageEnd = page
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+			length++
+		}
+		builder.WriteString(paragraph)
+		length += paragraphLength
+	}
+
+	for _, page := range pages {
+		for _, paragraph := range strings.Split(page.Text, "\n") {
+			paragraph = strings.TrimRight(paragraph, " \t\r")
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			paragraphLength := utf8.RuneCountInString(paragraph)
+			if length > 0 && length+1+paragraphLength > maxChars {
+				flush()
+			}
+			for paragraphLength > maxChars {
+				runes := []rune(paragraph)
+				add(page.Number, string(runes[:maxChars]), maxChars)
+				flush()
+				paragraph = string(runes[maxChars:])
+				paragraphLength -= maxChars
+			}
+			add(page.Number, paragraph, paragraphLength)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// CountChars 返回文档的字符数
+func CountChars(pages []Page) int {
+	count := 0
+	for _, page := range pages {
+		count += utf8.RuneCountInString(page.Text)
+	}
+	return count
+}
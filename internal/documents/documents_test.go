@@ -0,0 +1,194 @@
+package documents
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDOCX 生成只包含word/document.xml的DOCX
+func testDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"></Types>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `</w:body></w:document>`},
+	} {
+		entry, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		fileName string
+		want     string
+		wantErr  error
+	}{
+		{"PDF", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n"), "a.bin", MimeTypePDF, nil},
+		{"DOCX", testDOCX(t, `<w:p><w:r><w:t>hello</w:t></w:r></w:p>`), "a.docx", MimeTypeDOCX, nil},
+		{"纯文本", []byte("hello world\n"), "notes.txt", MimeTypeText, nil},
+		{"Markdown", []byte("# 标题\n\n正文\n"), "README.MD", MimeTypeMarkdown, nil},
+		{"Markdown长扩展名", []byte("# title\n"), "a.markdown", MimeTypeMarkdown, nil},
+		{"文本按内容检测", []byte("plain text"), "a.pdf", MimeTypeText, nil},
+		{"二进制", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d}, "a.txt", "", ErrUnsupported},
+		{"非UTF-8文本", []byte("caf\xe9 au lait"), "a.txt", "", ErrUnsupported},
+	}
+	for _, test := range tests {
+		got, err := Detect(test.data, test.fileName)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: Detect() error = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: Detect() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		want     []Page
+	}{
+		{
+			"纯文本去掉BOM并统一换行",
+			[]byte("\uFEFFline1\r\nline2"),
+			MimeTypeText,
+			[]Page{{Number: 0, Text: "line1\nline2"}},
+		},
+		{
+			"DOCX没有分页",
+			testDOCX(t, `<w:p><w:r><w:t>第一段</w:t></w:r></w:p><w:p><w:r><w:t>a</w:t><w:tab/><w:t>b</w:t></w:r></w:p>`),
+			MimeTypeDOCX,
+			[]Page{{Number: 0, Text: "第一段\na\tb\n"}},
+		},
+		{
+			"DOCX分页符和分页位置只计一次",
+			testDOCX(t, `<w:p><w:r><w:t>page1</w:t></w:r></w:p>`+
+				`<w:p><w:r><w:br w:type="page"/></w:r><w:r><w:lastRenderedPageBreak/><w:t>page2</w:t></w:r></w:p>`),
+			MimeTypeDOCX,
+			[]Page{{Number: 1, Text: "page1\n"}, {Number: 2, Text: "page2\n"}},
+		},
+	}
+	for _, test := range tests {
+		got, err := Extract(test.data, test.mimeType)
+		if err != nil {
+			t.Errorf("%s: Extract() returned error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Extract() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		wantErr  error
+	}{
+		{"不支持的格式", []byte("x"), "image/png", ErrUnsupported},
+		{"DOCX不是zip", []byte("not a zip"), MimeTypeDOCX, ErrInvalid},
+		{"PDF格式错误", []byte("%PDF-1.4\ngarbage"), MimeTypePDF, ErrInvalid},
+	}
+	for _, test := range tests {
+		if _, err := Extract(test.data, test.mimeType); !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: Extract() error = %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    []Page
+		maxChars int
+		want     []Chunk
+	}{
+		{
+			"空文档",
+			[]Page{{Number: 0, Text: " \n\n\t\n"}},
+			10,
+			nil,
+		},
+		{
+			"段落合并到不超过上限",
+			[]Page{{Number: 0, Text: "aaa\n\nbbb\nccc\ndddd"}},
+			11,
+			[]Chunk{{Text: "aaa\nbbb\nccc"}, {Text: "dddd"}},
+		},
+		{
+			"超长段落按字符截断",
+			[]Page{{Number: 0, Text: "一二三四五六七八九十\nab"}},
+			4,
+			[]Chunk{{Text: "一二三四"}, {Text: "五六七八"}, {Text: "九十"}, {Text: "ab"}},
+		},
+		{
+			"截断后剩余部分与下一段合并",
+			[]Page{{Number: 0, Text: "一二三四五\na"}},
+			4,
+			[]Chunk{{Text: "一二三四"}, {Text: "五\na"}},
+		},
+		{
+			"片段跨页时记录起止页",
+			[]Page{{Number: 1, Text: "aaaa"}, {Number: 2, Text: "bbbb"}, {Number: 3, Text: "cccccc"}},
+			9,
+			[]Chunk{{PageStart: 1, PageEnd: 2, Text: "aaaa\nbbbb"}, {PageStart: 3, PageEnd: 3, Text: "cccccc"}},
+		},
+		{
+			"空白页不影响页码",
+			[]Page{{Number: 1, Text: "aa"}, {Number: 2, Text: ""}, {Number: 3, Text: "bb"}},
+			100,
+			[]Chunk{{PageStart: 1, PageEnd: 3, Text: "aa\nbb"}},
+		},
+		{
+			"去掉行尾空白",
+			[]Page{{Number: 0, Text: "  indented  \r\nnext\t"}},
+			100,
+			[]Chunk{{Text: "indented\nnext"}},
+		},
+	}
+	for _, test := range tests {
+		got := Split(test.pages, test.maxChars)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Split() = %+v, want %+v", test.name, got, test.want)
+		}
+		for _, chunk := range got {
+			if length := len([]rune(chunk.Text)); length > test.maxChars {
+				t.Errorf("%s: chunk %q has %d characters, more than %d", test.name, chunk.Text, length, test.maxChars)
+			}
+		}
+	}
+}
+
+func TestCountChars(t *testing.T) {
+	pages := []Page{{Text: "abc"}, {Text: "中文"}, {Text: strings.Repeat("x", 5)}}
+	if got := CountChars(pages); got != 10 {
+		t.Errorf("CountChars() = %d, want 10", got)
+	}
+}
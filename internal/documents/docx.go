@@ -0,0 +1,111 @@
+package documents
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDOCXXMLBytes word/document.xml解压后的上限，避免压缩炸弹
+const maxDOCXXMLBytes = 64 << 20
+
+// extractDOCX 提取DOCX正文的文字，按分页符和Word保存时记录的分页位置分页
+func extractDOCX(data []byte) ([]Page, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	var document *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			document = file
+			break
+		}
+	}
+	if document == nil {
+		return nil, fmt.Errorf("%w: word/document.xml not found", ErrInvalid)
+	}
+	reader, err := document.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var (
+		pages   []string
+		builder strings.Builder
+		decoder = xml.NewDecoder(io.LimitReader(reader, maxDOCXXMLBytes))
+		inText  bool
+	)
+	// 分页符后Word通常还会记录一次分页位置，没有文字的页不计入页数
+	newPage := func() {
+		if len(pages) > 0 && strings.TrimSpace(builder.String()) == "" {
+			return
+		}
+		pages = append(pages, builder.String())
+		builder.Reset()
+	}
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				builder.WriteString("\t")
+			case "br":
+				if xmlAttr(element, "type") == "page" {
+					newPage()
+				} else {
+					builder.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				newPage()
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				builder.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				builder.Write(element)
+			}
+		}
+	}
+	newPage()
+
+	// 没有分页信息时不显示页码
+	if len(pages) == 1 {
+		return []Page{{Number: 0, Text: pages[0]}}, nil
+	}
+	result := make([]Page, 0, len(pages))
+	for i, text := range pages {
+		result = append(result, Page{Number: i + 1, Text: text})
+	}
+	return result, nil
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
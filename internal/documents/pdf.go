@@ -0,0 +1,36 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF 按页提取PDF的文字，扫描件等没有文字层的页为空
+func extractPDF(data []byte) (pages []Page, err error) {
+	// 解析器遇到格式错误的文件时可能panic
+	defer func() {
+		if r := recover(); r != nil {
+			pages = nil
+			err = fmt.Errorf("%w: %v", ErrInvalid, r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	for number := 1; number <= reader.NumPage(); number++ {
+		page := reader.Page(number)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		pages = append(pages, Page{Number: number, Text: text})
+	}
+	return pages, nil
+}
@@ -0,0 +1,240 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+// 迁移文件名格式：<版本号>_<名称>.<up|down>.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// 防止多个实例同时执行迁移的advisory lock键
+const migrationLockKey = 1219500001
+
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations 读取内嵌的迁移文件并按版本号排序
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrationMap := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("迁移文件名格式错误：%s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		content, err := fs.ReadFile(migrationFiles, "sql/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, exists := migrationMap[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: matches[2]}
+			migrationMap[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("迁移版本号重复：%d", version)
+		}
+		if matches[3] == "up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(migrationMap))
+	for _, migration := range migrationMap {
+		if migration.UpSQL == "" || migration.DownSQL == "" {
+			return nil, fmt.Errorf("迁移%d_%s缺少up或down文件", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up 按顺序执行所有未执行的迁移，返回本次执行的迁移
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var executed []Migration
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrator.migrations {
+			if _, exists := applied[migration.Version]; exists {
+				continue
+			}
+			err = execInTx(ctx, conn, migration.UpSQL,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("执行迁移%d_%s失败：%w", migration.Version, migration.Name, err)
+			}
+			executed = append(executed, migration)
+		}
+		return nil
+	})
+	return executed, err
+}
+
+// Down 回滚最近执行的steps个迁移，返回本次回滚的迁移
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrator.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := migrator.migrations[i]
+			if _, exists := applied[migration.Version]; !exists {
+				continue
+			}
+			err = execInTx(ctx, conn, migration.DownSQL,
+				"DELETE FROM schema_migrations WHERE version = $1",
+				migration.Version)
+			if err != nil {
+				return fmt.Errorf("回滚迁移%d_%s失败：%w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status 返回所有迁移的执行状态
+func (migrator *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statusList []MigrationStatus
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrator.migrations {
+			appliedAt, exists := applied[migration.Version]
+			statusList = append(statusList, MigrationStatus{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   exists,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	return statusList, err
+}
+
+// withLock 在持有advisory lock的连接上执行处理
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+		    version bigint NOT NULL,
+		    name text NOT NULL,
+		    applied_at timestamp without time zone NOT NULL,
+		    CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+		)`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// execInTx 在同一事务中执行迁移SQL和schema_migrations的更新
+func execInTx(ctx context.Context, conn *sql.Conn, migrationSQL string, recordSQL string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, migrationSQL); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, recordSQL, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
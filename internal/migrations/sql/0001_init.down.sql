@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS public.chat_record;
+
+DROP TABLE IF EXISTS public.login_record;
+
+DROP TABLE IF EXISTS public.account;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS public.account
+(
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    password text COLLATE pg_catalog."default" NOT NULL,
+    permission text COLLATE pg_catalog."default" NOT NULL DEFAULT 'normal'::text,
+    CONSTRAINT account_pk PRIMARY KEY (user_name),
+    CONSTRAINT permission_check CHECK (permission = ANY (ARRAY['normal'::text, 'vip1'::text, 'vip2'::text, 'vip3'::text, 'vip4'::text, 'vip5'::text, 'super'::text]))
+);
+
+CREATE TABLE IF NOT EXISTS public.login_record
+(
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    last_login_time timestamp without time zone NOT NULL,
+    login_token uuid NOT NULL,
+    CONSTRAINT login_record_pkey PRIMARY KEY (user_name)
+);
+
+CREATE TABLE IF NOT EXISTS public.chat_record
+(
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    session_id uuid NOT NULL,
+    context text COLLATE pg_catalog."default",
+    create_timestamp timestamp without time zone,
+    update_timestamp timestamp without time zone,
+    CONSTRAINT chat_record_pkey PRIMARY KEY (session_id)
+);
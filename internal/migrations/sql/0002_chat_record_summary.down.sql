@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS public.chat_record_update_idx;
+
+DROP INDEX IF EXISTS public.chat_record_user_update_idx;
+
+ALTER TABLE public.chat_record
+    DROP COLUMN message_count,
+    DROP COLUMN preview,
+    DROP COLUMN title;
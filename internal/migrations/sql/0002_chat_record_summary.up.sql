@@ -0,0 +1,32 @@
+ALTER TABLE public.chat_record
+    ADD COLUMN title text COLLATE pg_catalog."default",
+    ADD COLUMN preview text COLLATE pg_catalog."default",
+    ADD COLUMN message_count integer NOT NULL DEFAULT 0;
+
+-- 从已有的对话上下文回填消息数和第一个问题
+UPDATE public.chat_record AS record
+SET message_count = COALESCE(json_array_length(record.context::json -> 'chatMessages'), 0),
+    title = left(question.text, 20),
+    preview = left(question.text, 100)
+FROM (
+    SELECT chat.session_id,
+           (SELECT regexp_replace(part.value ->> 'text', '\s+', ' ', 'g')
+            FROM json_array_elements(chat.context::json -> 'chatMessages') WITH ORDINALITY AS message(value, idx),
+                 json_array_elements(
+                     CASE json_typeof(message.value -> 'content')
+                         WHEN 'array' THEN message.value -> 'content'
+                         ELSE '[]'::json
+                     END) WITH ORDINALITY AS part(value, idx)
+            WHERE message.value ->> 'role' = 'user'
+              AND part.value ->> 'type' = 'text'
+            ORDER BY message.idx, part.idx
+            LIMIT 1) AS text
+    FROM public.chat_record AS chat
+) AS question
+WHERE question.session_id = record.session_id;
+
+CREATE INDEX chat_record_user_update_idx
+    ON public.chat_record (user_name, update_timestamp DESC, session_id DESC);
+
+CREATE INDEX chat_record_update_idx
+    ON public.chat_record (update_timestamp DESC, session_id DESC);
@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS public.login_record_user_name_idx;
+
+-- 每个用户只保留最近一次登录
+DELETE FROM public.login_record AS record
+WHERE EXISTS (
+    SELECT 1
+    FROM public.login_record AS newer
+    WHERE newer.user_name = record.user_name
+      AND (newer.last_login_time, newer.login_token) > (record.last_login_time, record.login_token)
+);
+
+ALTER TABLE public.login_record
+    DROP CONSTRAINT login_record_device_id_key,
+    DROP CONSTRAINT login_record_pkey,
+    DROP COLUMN last_seen_time,
+    DROP COLUMN ip_address,
+    DROP COLUMN client_version,
+    DROP COLUMN device_name,
+    DROP COLUMN device_id,
+    ADD CONSTRAINT login_record_pkey PRIMARY KEY (user_name);
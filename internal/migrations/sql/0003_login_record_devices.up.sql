@@ -0,0 +1,23 @@
+-- 每次登录（设备）一条记录，以登录令牌为主键
+ALTER TABLE public.login_record
+    DROP CONSTRAINT login_record_pkey;
+
+ALTER TABLE public.login_record
+    ADD COLUMN device_id uuid,
+    ADD COLUMN device_name text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ADD COLUMN client_version text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ADD COLUMN ip_address text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ADD COLUMN last_seen_time timestamp without time zone;
+
+UPDATE public.login_record
+SET device_id = md5(random()::text || clock_timestamp()::text || user_name)::uuid,
+    last_seen_time = last_login_time;
+
+ALTER TABLE public.login_record
+    ALTER COLUMN device_id SET NOT NULL,
+    ALTER COLUMN last_seen_time SET NOT NULL,
+    ADD CONSTRAINT login_record_pkey PRIMARY KEY (login_token),
+    ADD CONSTRAINT login_record_device_id_key UNIQUE (device_id);
+
+CREATE INDEX login_record_user_name_idx
+    ON public.login_record (user_name);
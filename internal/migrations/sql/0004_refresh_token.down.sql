@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.refresh_token;
+
+ALTER TABLE public.login_record
+    DROP COLUMN token_expire_time;
@@ -0,0 +1,24 @@
+-- 访问令牌的过期时间
+ALTER TABLE public.login_record
+    ADD COLUMN token_expire_time timestamp without time zone;
+
+UPDATE public.login_record
+SET token_expire_time = last_login_time + interval '1 hour';
+
+ALTER TABLE public.login_record
+    ALTER COLUMN token_expire_time SET NOT NULL;
+
+-- 刷新令牌，使用后保留记录用于检测重复使用，设备退出登录时一并删除
+CREATE TABLE IF NOT EXISTS public.refresh_token
+(
+    refresh_token uuid NOT NULL,
+    device_id uuid NOT NULL,
+    expire_time timestamp without time zone NOT NULL,
+    used_time timestamp without time zone,
+    CONSTRAINT refresh_token_pkey PRIMARY KEY (refresh_token),
+    CONSTRAINT refresh_token_device_id_fkey FOREIGN KEY (device_id)
+        REFERENCES public.login_record (device_id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_token_device_id_idx
+    ON public.refresh_token (device_id);
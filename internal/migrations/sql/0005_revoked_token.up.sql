@@ -0,0 +1,7 @@
+-- jwt模式下已退出登录的设备，保留到吊销前签发的访问令牌全部过期
+CREATE TABLE IF NOT EXISTS public.revoked_token
+(
+    device_id uuid NOT NULL,
+    expire_time timestamp without time zone NOT NULL,
+    CONSTRAINT revoked_token_pkey PRIMARY KEY (device_id)
+);
@@ -0,0 +1,13 @@
+-- 每次调用模型服务的使用量，用于额度限制
+CREATE TABLE IF NOT EXISTS public.usage_record
+(
+    id bigserial NOT NULL,
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    session_id uuid NOT NULL,
+    total_tokens integer NOT NULL DEFAULT 0,
+    create_time timestamp without time zone NOT NULL,
+    CONSTRAINT usage_record_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX usage_record_user_name_create_time_idx
+    ON public.usage_record (user_name, create_time);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS public.usage_record_create_time_idx;
+
+ALTER TABLE public.usage_record
+    DROP COLUMN error_code,
+    DROP COLUMN finish_reason,
+    DROP COLUMN latency_ms,
+    DROP COLUMN completion_tokens,
+    DROP COLUMN prompt_tokens,
+    DROP COLUMN model;
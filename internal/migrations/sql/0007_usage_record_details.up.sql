@@ -0,0 +1,11 @@
+-- 记录每次调用模型服务的详细信息，失败的调用也记录错误码
+ALTER TABLE public.usage_record
+    ADD COLUMN model text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ADD COLUMN prompt_tokens integer NOT NULL DEFAULT 0,
+    ADD COLUMN completion_tokens integer NOT NULL DEFAULT 0,
+    ADD COLUMN latency_ms integer NOT NULL DEFAULT 0,
+    ADD COLUMN finish_reason text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ADD COLUMN error_code text COLLATE pg_catalog."default" NOT NULL DEFAULT '';
+
+CREATE INDEX usage_record_create_time_idx
+    ON public.usage_record (create_time);
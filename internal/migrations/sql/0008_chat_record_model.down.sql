@@ -0,0 +1,2 @@
+ALTER TABLE public.chat_record
+    DROP COLUMN model;
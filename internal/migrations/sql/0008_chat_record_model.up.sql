@@ -0,0 +1,3 @@
+-- 会话使用的模型名，空字符串为默认模型
+ALTER TABLE public.chat_record
+    ADD COLUMN model text COLLATE pg_catalog."default" NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE public.chat_record
+    DROP COLUMN parameters;
+
+DROP TABLE IF EXISTS public.persona;
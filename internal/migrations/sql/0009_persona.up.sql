@@ -0,0 +1,18 @@
+-- 预设角色，由管理员维护
+CREATE TABLE IF NOT EXISTS public.persona
+(
+    persona_id uuid NOT NULL,
+    name text COLLATE pg_catalog."default" NOT NULL,
+    description text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    system_prompt text COLLATE pg_catalog."default" NOT NULL,
+    model text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    parameters jsonb NOT NULL DEFAULT '{}'::jsonb,
+    create_timestamp timestamp without time zone NOT NULL,
+    update_timestamp timestamp without time zone NOT NULL,
+    CONSTRAINT persona_pkey PRIMARY KEY (persona_id),
+    CONSTRAINT persona_name_key UNIQUE (name)
+);
+
+-- 会话的生成参数，开始会话时从角色复制
+ALTER TABLE public.chat_record
+    ADD COLUMN parameters jsonb NOT NULL DEFAULT '{}'::jsonb;
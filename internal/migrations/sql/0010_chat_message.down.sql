@@ -0,0 +1,18 @@
+ALTER TABLE public.chat_record
+    ADD COLUMN context text COLLATE pg_catalog."default";
+
+-- 由消息重新生成对话上下文，时间按数据库会话的时区输出带时区的格式
+UPDATE public.chat_record AS record
+SET context = (
+    SELECT json_build_object('chatMessages', COALESCE(json_agg(
+            CASE
+                WHEN message.create_timestamp IS NULL
+                    THEN json_build_object('role', message.role, 'content', message.content)
+                ELSE json_build_object('role', message.role, 'content', message.content,
+                                       'timestamp', message.create_timestamp::timestamptz)
+                END ORDER BY message.sequence), '[]'::json))::text
+    FROM public.chat_message AS message
+    WHERE message.session_id = record.session_id
+);
+
+DROP TABLE IF EXISTS public.chat_message;
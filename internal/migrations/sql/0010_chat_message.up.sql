@@ -0,0 +1,35 @@
+-- 每条消息一行，替代chat_record.context中保存的整个对话上下文
+CREATE TABLE IF NOT EXISTS public.chat_message
+(
+    session_id uuid NOT NULL,
+    sequence integer NOT NULL,
+    role text COLLATE pg_catalog."default" NOT NULL,
+    content jsonb NOT NULL DEFAULT '[]'::jsonb,
+    model text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    prompt_tokens integer NOT NULL DEFAULT 0,
+    completion_tokens integer NOT NULL DEFAULT 0,
+    create_timestamp timestamp without time zone,
+    CONSTRAINT chat_message_pkey PRIMARY KEY (session_id, sequence),
+    CONSTRAINT chat_message_session_id_fkey FOREIGN KEY (session_id)
+        REFERENCES public.chat_record (session_id) ON DELETE CASCADE
+);
+
+-- 迁移已有的对话上下文，字符串格式的内容转为文本部分的数组
+INSERT INTO public.chat_message (session_id, sequence, role, content, create_timestamp)
+SELECT record.session_id,
+       message.ordinality - 1,
+       message.value ->> 'role',
+       CASE jsonb_typeof(message.value -> 'content')
+           WHEN 'array' THEN message.value -> 'content'
+           WHEN 'string' THEN jsonb_build_array(
+                   jsonb_build_object('type', 'text', 'text', message.value ->> 'content'))
+           ELSE '[]'::jsonb
+           END,
+       (message.value ->> 'timestamp')::timestamp
+FROM public.chat_record AS record,
+     jsonb_array_elements(COALESCE(record.context::jsonb -> 'chatMessages', '[]'::jsonb))
+         WITH ORDINALITY AS message(value, ordinality)
+WHERE record.context IS NOT NULL;
+
+ALTER TABLE public.chat_record
+    DROP COLUMN context;
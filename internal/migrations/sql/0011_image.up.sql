@@ -0,0 +1,10 @@
+-- 上传的图片，image_id为内容的SHA-256，相同内容只保存一份
+CREATE TABLE IF NOT EXISTS public.image
+(
+    image_id text COLLATE pg_catalog."default" NOT NULL,
+    mime_type text COLLATE pg_catalog."default" NOT NULL,
+    size_bytes bigint NOT NULL,
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    create_timestamp timestamp without time zone NOT NULL,
+    CONSTRAINT image_pkey PRIMARY KEY (image_id)
+);
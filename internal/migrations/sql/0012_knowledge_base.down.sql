@@ -0,0 +1,6 @@
+ALTER TABLE public.chat_record
+    DROP COLUMN IF EXISTS knowledge_base_id;
+
+DROP TABLE IF EXISTS public.knowledge_chunk;
+DROP TABLE IF EXISTS public.knowledge_document;
+DROP TABLE IF EXISTS public.knowledge_base;
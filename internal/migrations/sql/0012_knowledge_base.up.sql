@@ -0,0 +1,67 @@
+-- pgvector已安装时启用，没有安装或没有权限时检索在服务端计算相似度
+DO
+$$
+    BEGIN
+        CREATE EXTENSION IF NOT EXISTS vector;
+    EXCEPTION
+        WHEN OTHERS THEN
+            RAISE NOTICE 'pgvector不可用：%', SQLERRM;
+    END
+$$;
+
+-- 知识库，embedding_model和dimensions为创建时的向量模型，模型不同的向量不能比较
+CREATE TABLE IF NOT EXISTS public.knowledge_base
+(
+    knowledge_base_id uuid NOT NULL,
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    name text COLLATE pg_catalog."default" NOT NULL,
+    description text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    shared boolean NOT NULL DEFAULT false,
+    embedding_model text COLLATE pg_catalog."default" NOT NULL,
+    dimensions integer NOT NULL,
+    create_timestamp timestamp without time zone NOT NULL,
+    update_timestamp timestamp without time zone NOT NULL,
+    CONSTRAINT knowledge_base_pkey PRIMARY KEY (knowledge_base_id)
+);
+
+-- 知识库中的文档，文档本身不保存
+CREATE TABLE IF NOT EXISTS public.knowledge_document
+(
+    document_id uuid NOT NULL,
+    knowledge_base_id uuid NOT NULL,
+    file_name text COLLATE pg_catalog."default" NOT NULL,
+    mime_type text COLLATE pg_catalog."default" NOT NULL,
+    size_bytes bigint NOT NULL,
+    pages integer NOT NULL DEFAULT 0,
+    chunk_count integer NOT NULL,
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    create_timestamp timestamp without time zone NOT NULL,
+    CONSTRAINT knowledge_document_pkey PRIMARY KEY (document_id),
+    CONSTRAINT knowledge_document_knowledge_base_id_fkey FOREIGN KEY (knowledge_base_id)
+        REFERENCES public.knowledge_base (knowledge_base_id) ON DELETE CASCADE
+);
+
+-- 文档的片段和向量，向量以real[]保存，pgvector可用时检索时转为vector
+CREATE TABLE IF NOT EXISTS public.knowledge_chunk
+(
+    document_id uuid NOT NULL,
+    chunk_index integer NOT NULL,
+    knowledge_base_id uuid NOT NULL,
+    page_start integer NOT NULL DEFAULT 0,
+    page_end integer NOT NULL DEFAULT 0,
+    content text COLLATE pg_catalog."default" NOT NULL,
+    embedding real[] NOT NULL,
+    CONSTRAINT knowledge_chunk_pkey PRIMARY KEY (document_id, chunk_index),
+    CONSTRAINT knowledge_chunk_document_id_fkey FOREIGN KEY (document_id)
+        REFERENCES public.knowledge_document (document_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS knowledge_chunk_knowledge_base_id_idx
+    ON public.knowledge_chunk (knowledge_base_id);
+
+-- 会话使用的知识库，知识库删除后会话不再检索
+ALTER TABLE public.chat_record
+    ADD COLUMN knowledge_base_id uuid;
+ALTER TABLE public.chat_record
+    ADD CONSTRAINT chat_record_knowledge_base_id_fkey FOREIGN KEY (knowledge_base_id)
+        REFERENCES public.knowledge_base (knowledge_base_id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE public.chat_message
+    DROP COLUMN IF EXISTS tool_call_id,
+    DROP COLUMN IF EXISTS tool_calls;
@@ -0,0 +1,4 @@
+-- 回答中要求调用的工具和工具消息对应的调用，工具的执行结果保存为role为tool的消息
+ALTER TABLE public.chat_message
+    ADD COLUMN tool_calls jsonb NOT NULL DEFAULT '[]'::jsonb,
+    ADD COLUMN tool_call_id text COLLATE pg_catalog."default" NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE public.chat_message
+    DROP COLUMN IF EXISTS choice_index,
+    DROP COLUMN IF EXISTS choices;
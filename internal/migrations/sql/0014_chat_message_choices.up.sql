@@ -0,0 +1,4 @@
+-- 请求多个候选回答时保存所有候选的内容，content为选择的候选，choice_index为其序号
+ALTER TABLE public.chat_message
+    ADD COLUMN choices jsonb NOT NULL DEFAULT '[]'::jsonb,
+    ADD COLUMN choice_index integer NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE public.usage_record
+    DROP COLUMN IF EXISTS kind;
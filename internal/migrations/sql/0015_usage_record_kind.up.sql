@@ -0,0 +1,4 @@
+-- 调用的种类，chat：回答问题，transcription：语音识别，ocr：视觉模型识别图片文字，embedding：知识库生成向量，
+-- tool_step：回答问题过程中要求调用工具的调用，只有chat计入提问次数，所有种类都计入token用量
+ALTER TABLE public.usage_record
+    ADD COLUMN kind text COLLATE pg_catalog."default" NOT NULL DEFAULT 'chat';
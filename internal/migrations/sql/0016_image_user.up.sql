@@ -0,0 +1,20 @@
+-- 上传过图片的用户，图片按内容去重，同一图片可能由多个用户上传，提问时只能引用自己上传过的图片
+CREATE TABLE IF NOT EXISTS public.image_user
+(
+    image_id text COLLATE pg_catalog."default" NOT NULL,
+    user_name text COLLATE pg_catalog."default" NOT NULL,
+    create_timestamp timestamp without time zone NOT NULL,
+    CONSTRAINT image_user_pkey PRIMARY KEY (image_id, user_name),
+    CONSTRAINT image_user_image_id_fkey FOREIGN KEY (image_id)
+        REFERENCES public.image (image_id) ON DELETE CASCADE
+);
+
+CREATE INDEX image_user_user_name_idx
+    ON public.image_user (user_name);
+
+-- 以前上传的图片只记录了第一次上传的用户
+INSERT INTO public.image_user (image_id, user_name, create_timestamp)
+SELECT image_id, user_name, create_timestamp
+FROM public.image
+WHERE user_name <> ''
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,90 @@
+package passwords
+
+import (
+	"crypto/subtle"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const maxPasswordBytes = 72
+
+// Hasher 使用bcrypt保存密码，兼容旧的明文密码
+type Hasher struct {
+	cost int
+	// dummyHash 用户不存在时用于比较，使响应时间与用户存在时一致
+	dummyHash []byte
+}
+
+func NewHasher(cost int) (*Hasher, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("LaoQGChat"), cost)
+	if err != nil {
+		return nil, err
+	}
+	return &Hasher{
+		cost:      cost,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// Hash 生成密码的哈希值
+func (hasher *Hasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify 验证密码，返回密码是否正确以及是否需要用当前设置重新生成哈希值
+// 旧的明文密码验证通过时总是需要重新生成
+func (hasher *Hasher) Verify(stored string, password string) (bool, bool) {
+	if !isBcryptHash(stored) {
+		ok := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost != hasher.cost
+}
+
+// VerifyDummy 用户不存在时调用，消耗与验证密码相同的时间
+func (hasher *Hasher) VerifyDummy(password string) {
+	_ = bcrypt.CompareHashAndPassword(hasher.dummyHash, []byte(password))
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// Policy 密码规则
+type Policy struct {
+	MinLength     int
+	RequireLetter bool
+	RequireDigit  bool
+}
+
+// Validate 检查密码是否符合规则，bcrypt最多只使用前72字节
+func (policy Policy) Validate(password string) bool {
+	if utf8.RuneCountInString(password) < policy.MinLength || len(password) > maxPasswordBytes {
+		return false
+	}
+	hasLetter, hasDigit := false, false
+	for _, char := range password {
+		switch {
+		case unicode.IsLetter(char):
+			hasLetter = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case unicode.IsControl(char):
+			return false
+		}
+	}
+	return (hasLetter || !policy.RequireLetter) && (hasDigit || !policy.RequireDigit)
+}
@@ -0,0 +1,93 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasherVerify(t *testing.T) {
+	hasher, err := NewHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hasher.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCostHash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		stored     string
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"bcrypt正确", hash, "secret123", true, false},
+		{"bcrypt错误", hash, "secret124", false, false},
+		{"cost不同时需要重新生成", string(otherCostHash), "secret123", true, true},
+		{"明文正确时需要重新生成", "secret123", "secret123", true, true},
+		{"明文错误", "secret123", "secret", false, false},
+		{"明文为空", "", "", true, true},
+	}
+	for _, test := range tests {
+		ok, rehash := hasher.Verify(test.stored, test.password)
+		if ok != test.wantOK || rehash != test.wantRehash {
+			t.Errorf("%s: Verify() = (%v, %v), want (%v, %v)", test.name, ok, rehash, test.wantOK, test.wantRehash)
+		}
+	}
+}
+
+func TestHashIsSalted(t *testing.T) {
+	hasher, err := NewHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := hasher.Hash("secret123")
+	second, _ := hasher.Hash("secret123")
+	if first == second {
+		t.Error("Hash() returned the same hash twice")
+	}
+	if !isBcryptHash(first) {
+		t.Errorf("Hash() = %q, not a bcrypt hash", first)
+	}
+}
+
+func TestNewHasherInvalidCost(t *testing.T) {
+	if _, err := NewHasher(bcrypt.MaxCost + 1); err == nil {
+		t.Error("NewHasher() with invalid cost succeeded")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := Policy{MinLength: 8, RequireLetter: true, RequireDigit: true}
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"abcd1234", true},
+		{"密码密码密码12", true},
+		{"abc123", false},
+		{"abcdefgh", false},
+		{"12345678", false},
+		{"abcd\n1234", false},
+		{strings.Repeat("a1", 36), true},
+		{strings.Repeat("a1", 36) + "a", false},
+		// 字符数足够但超过72字节
+		{strings.Repeat("密", 24) + "a1", false},
+	}
+	for _, test := range tests {
+		if got := policy.Validate(test.password); got != test.want {
+			t.Errorf("Validate(%q) = %v, want %v", test.password, got, test.want)
+		}
+	}
+
+	if !(Policy{MinLength: 1}).Validate("!") {
+		t.Error("Validate() without letter and digit requirements rejected \"!\"")
+	}
+}
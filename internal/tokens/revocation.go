@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationList 已吊销的设备，在吊销前签发的访问令牌全部过期之前拒绝该设备的令牌
+type RevocationList struct {
+	mu      sync.RWMutex
+	entries map[uuid.UUID]time.Time
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{entries: make(map[uuid.UUID]time.Time)}
+}
+
+// Add 吊销设备，until之后自动失效
+func (list *RevocationList) Add(deviceId uuid.UUID, until time.Time) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if until.After(list.entries[deviceId]) {
+		list.entries[deviceId] = until
+	}
+}
+
+// Merge 合并从数据库同步的吊销记录，同时清理已失效的记录
+func (list *RevocationList) Merge(entries map[uuid.UUID]time.Time, now time.Time) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for deviceId, until := range entries {
+		if until.After(list.entries[deviceId]) {
+			list.entries[deviceId] = until
+		}
+	}
+	for deviceId, until := range list.entries {
+		if !until.After(now) {
+			delete(list.entries, deviceId)
+		}
+	}
+}
+
+// Contains 设备是否已被吊销
+func (list *RevocationList) Contains(deviceId uuid.UUID, now time.Time) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	until, ok := list.entries[deviceId]
+	return ok && until.After(now)
+}
@@ -0,0 +1,71 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ErrExpired 令牌已过期，客户端需要使用刷新令牌换取新的令牌
+var ErrExpired = errors.New("令牌已过期")
+
+// Claims 访问令牌携带的用户信息
+// Subject为用户名，ID为登录记录中的login_token
+type Claims struct {
+	Permission string    `json:"perm"`
+	DeviceId   uuid.UUID `json:"did"`
+	jwt.RegisteredClaims
+}
+
+// Signer 使用HS256签发和验证访问令牌，通过kid支持多个密钥同时有效
+type Signer struct {
+	keys        map[string][]byte
+	activeKeyID string
+	parser      *jwt.Parser
+}
+
+func NewSigner(keys map[string][]byte, activeKeyID string) (*Signer, error) {
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("签名密钥%q不存在", activeKeyID)
+	}
+	return &Signer{
+		keys:        keys,
+		activeKeyID: activeKeyID,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithExpirationRequired(),
+		),
+	}, nil
+}
+
+// Sign 使用当前密钥签发令牌
+func (signer *Signer) Sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	token.Header["kid"] = signer.activeKeyID
+	return token.SignedString(signer.keys[signer.activeKeyID])
+}
+
+// Parse 验证令牌的签名和有效期，过期时返回ErrExpired
+func (signer *Signer) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := signer.parser.ParseWithClaims(tokenString, claims, signer.key)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// key 根据令牌头的kid选择验证密钥
+func (signer *Signer) key(token *jwt.Token) (any, error) {
+	keyID, _ := token.Header["kid"].(string)
+	key, ok := signer.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("未知的签名密钥：%q", keyID)
+	}
+	return key, nil
+}
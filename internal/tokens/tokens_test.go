@@ -0,0 +1,164 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func testClaims(expiresAt time.Time) Claims {
+	return Claims{
+		Permission: "user",
+		DeviceId:   uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+func TestSignerKeyRotation(t *testing.T) {
+	oldKey := []byte("old-secret-key-0123456789abcdef")
+	newKey := []byte("new-secret-key-0123456789abcdef")
+
+	oldSigner, err := NewSigner(map[string][]byte{"k1": oldKey}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 轮换：新密钥生效，旧密钥在旧令牌过期前继续用于验证
+	rotatedSigner, err := NewSigner(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧密钥移除后旧令牌失效
+	newOnlySigner, err := NewSigner(map[string][]byte{"k2": newKey}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kid相同但密钥不同
+	forgedSigner, err := NewSigner(map[string][]byte{"k2": []byte("forged-secret")}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	oldToken, err := oldSigner.Sign(testClaims(expiresAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := rotatedSigner.Sign(testClaims(expiresAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedToken, err := forgedSigner.Sign(testClaims(expiresAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+		wantOK bool
+	}{
+		{"旧密钥验证旧令牌", oldSigner, oldToken, true},
+		{"轮换后验证旧令牌", rotatedSigner, oldToken, true},
+		{"轮换后验证新令牌", rotatedSigner, newToken, true},
+		{"旧密钥不认识新kid", oldSigner, newToken, false},
+		{"移除旧密钥后验证旧令牌", newOnlySigner, oldToken, false},
+		{"移除旧密钥后验证新令牌", newOnlySigner, newToken, true},
+		{"伪造的签名", rotatedSigner, forgedToken, false},
+		{"格式错误", rotatedSigner, "not-a-token", false},
+	}
+	for _, test := range tests {
+		claims, err := test.signer.Parse(test.token)
+		if test.wantOK {
+			if err != nil {
+				t.Errorf("%s: Parse() returned error: %v", test.name, err)
+			} else if claims.Subject != "alice" || claims.Permission != "user" {
+				t.Errorf("%s: Parse() = %+v", test.name, claims)
+			}
+		} else if err == nil {
+			t.Errorf("%s: Parse() succeeded, want error", test.name)
+		}
+	}
+}
+
+func TestSignerKid(t *testing.T) {
+	signer, err := NewSigner(map[string][]byte{"k1": []byte("a"), "k2": []byte("b")}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenString, err := signer.Sign(testClaims(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "k2" {
+		t.Errorf("kid = %v, want k2", kid)
+	}
+}
+
+func TestSignerParseErrors(t *testing.T) {
+	key := []byte("secret-key-0123456789abcdef")
+	signer, err := NewSigner(map[string][]byte{"k1": key}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := signer.Sign(testClaims(time.Now().Add(-time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Parse(expired); !errors.Is(err, ErrExpired) {
+		t.Errorf("Parse(expired) error = %v, want ErrExpired", err)
+	}
+
+	// 没有过期时间的令牌不接受
+	claims := testClaims(time.Now())
+	claims.ExpiresAt = nil
+	noExpiry := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	noExpiry.Header["kid"] = "k1"
+	noExpiryString, err := noExpiry.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Parse(noExpiryString); err == nil {
+		t.Error("Parse(no exp) succeeded, want error")
+	}
+
+	// 只接受HS256
+	claims = testClaims(time.Now().Add(time.Hour))
+	hs512 := jwt.NewWithClaims(jwt.SigningMethodHS512, &claims)
+	hs512.Header["kid"] = "k1"
+	hs512String, err := hs512.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Parse(hs512String); err == nil {
+		t.Error("Parse(HS512) succeeded, want error")
+	}
+
+	// 没有kid
+	noKid := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	noKidString, err := noKid.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Parse(noKidString); err == nil {
+		t.Error("Parse(no kid) succeeded, want error")
+	}
+}
+
+func TestNewSignerUnknownActiveKey(t *testing.T) {
+	if _, err := NewSigner(map[string][]byte{"k1": []byte("a")}, "k2"); err == nil {
+		t.Error("NewSigner() with unknown active key succeeded")
+	}
+}
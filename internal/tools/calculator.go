@@ -0,0 +1,404 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxExpressionLength 表达式的最大字符数
+	maxExpressionLength = 1000
+	// maxExpressionDepth 括号和函数的最大嵌套层数
+	maxExpressionDepth = 64
+)
+
+// calculator 计算数学表达式，避免模型心算出错
+type calculator struct{}
+
+func (calculator) Name() string {
+	return NameCalculator
+}
+
+func (calculator) Description() string {
+	return "Evaluate a math expression exactly. Supports + - * / % ^ (or **), parentheses, " +
+		"constants pi and e, and functions sqrt, cbrt, abs, round, floor, ceil, sin, cos, tan, asin, acos, atan " +
+		"(radians), log (base 10), log2, ln, exp, min, max, pow."
+}
+
+func (calculator) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "expression": {
+      "type": "string",
+      "description": "Math expression, e.g. \"(1.5 + 2) * sqrt(16) / 3\""
+    }
+  },
+  "required": ["expression"]
+}`)
+}
+
+func (calculator) Call(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	value, err := evaluate(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return encodeResult(map[string]any{
+		"expression": args.Expression,
+		"result":     roundNumber(value),
+	})
+}
+
+// evaluate 计算表达式的值
+func evaluate(expression string) (float64, error) {
+	if strings.TrimSpace(expression) == "" {
+		return 0, fmt.Errorf("%w: empty expression", errInvalidArguments)
+	}
+	if utf8.RuneCountInString(expression) > maxExpressionLength {
+		return 0, fmt.Errorf("%w: expression longer than %d characters", errInvalidArguments, maxExpressionLength)
+	}
+	parser := &expressionParser{input: []rune(expression)}
+	value, err := parser.parseExpression()
+	if err != nil {
+		return 0, err
+	}
+	parser.skipSpaces()
+	if parser.pos < len(parser.input) {
+		return 0, parser.errorf("unexpected %q", parser.input[parser.pos])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+// expressionParser 递归下降解析，优先级从低到高为加减、乘除取余、正负号、乘方（右结合）
+type expressionParser struct {
+	input []rune
+	pos   int
+	depth int
+}
+
+func (parser *expressionParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at position %d: %s", parser.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (parser *expressionParser) skipSpaces() {
+	for parser.pos < len(parser.input) && unicode.IsSpace(parser.input[parser.pos]) {
+		parser.pos++
+	}
+}
+
+// peek 跳过空白后返回下一个字符，没有时返回0
+func (parser *expressionParser) peek() rune {
+	parser.skipSpaces()
+	if parser.pos >= len(parser.input) {
+		return 0
+	}
+	return parser.input[parser.pos]
+}
+
+// parseExpression expression = term {("+" | "-") term}
+func (parser *expressionParser) parseExpression() (float64, error) {
+	parser.depth++
+	defer func() {
+		parser.depth--
+	}()
+	if parser.depth > maxExpressionDepth {
+		return 0, parser.errorf("expression nested too deeply")
+	}
+
+	value, err := parser.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch parser.peek() {
+		case '+':
+			parser.pos++
+			right, err := parser.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			value += right
+		case '-', '−':
+			parser.pos++
+			right, err := parser.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			value -= right
+		default:
+			return value, nil
+		}
+	}
+}
+
+// parseTerm term = unary {("*" | "/" | "%") unary}
+func (parser *expressionParser) parseTerm() (float64, error) {
+	value, err := parser.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		operator := parser.peek()
+		switch operator {
+		case '*', '×':
+			// **为乘方，由parsePower处理
+			if operator == '*' && parser.pos+1 < len(parser.input) && parser.input[parser.pos+1] == '*' {
+				return value, nil
+			}
+		case '/', '÷', '%':
+		default:
+			return value, nil
+		}
+		parser.pos++
+		right, err := parser.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case '*', '×':
+			value *= right
+		case '/', '÷':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value = math.Mod(value, right)
+		}
+	}
+}
+
+// parseUnary unary = ("+" | "-") unary | power
+func (parser *expressionParser) parseUnary() (float64, error) {
+	switch parser.peek() {
+	case '+':
+		parser.pos++
+		return parser.parseUnary()
+	case '-', '−':
+		parser.pos++
+		value, err := parser.parseUnary()
+		return -value, err
+	default:
+		return parser.parsePower()
+	}
+}
+
+// parsePower power = primary [("^" | "**") unary]
+func (parser *expressionParser) parsePower() (float64, error) {
+	base, err := parser.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	switch parser.peek() {
+	case '^':
+		parser.pos++
+	case '*':
+		if parser.pos+1 < len(parser.input) && parser.input[parser.pos+1] == '*' {
+			parser.pos += 2
+		} else {
+			return base, nil
+		}
+	default:
+		return base, nil
+	}
+	exponent, err := parser.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// parsePrimary primary = number | constant | function "(" arguments ")" | "(" expression ")"
+func (parser *expressionParser) parsePrimary() (float64, error) {
+	r := parser.peek()
+	switch {
+	case r == 0:
+		return 0, parser.errorf("unexpected end of expression")
+	case r == '(' || r == '（':
+		parser.pos++
+		value, err := parser.parseExpression()
+		if err != nil {
+			return 0, err
+		}
+		if closing := parser.peek(); closing != ')' && closing != '）' {
+			return 0, parser.errorf("missing closing parenthesis")
+		}
+		parser.pos++
+		return value, nil
+	case unicode.IsDigit(r) || r == '.':
+		return parser.parseNumber()
+	case unicode.IsLetter(r) || r == 'π':
+		return parser.parseIdentifier()
+	default:
+		return 0, parser.errorf("unexpected %q", r)
+	}
+}
+
+// parseNumber 解析十进制数，支持小数和科学计数法
+func (parser *expressionParser) parseNumber() (float64, error) {
+	start := parser.pos
+	for parser.pos < len(parser.input) {
+		r := parser.input[parser.pos]
+		switch {
+		case unicode.IsDigit(r) || r == '.':
+			parser.pos++
+		case (r == 'e' || r == 'E') && parser.pos+1 < len(parser.input):
+			next := parser.input[parser.pos+1]
+			if unicode.IsDigit(next) {
+				parser.pos++
+			} else if (next == '+' || next == '-') && parser.pos+2 < len(parser.input) && unicode.IsDigit(parser.input[parser.pos+2]) {
+				parser.pos += 2
+			} else {
+				return parser.number(start)
+			}
+		default:
+			return parser.number(start)
+		}
+	}
+	return parser.number(start)
+}
+
+func (parser *expressionParser) number(start int) (float64, error) {
+	text := string(parser.input[start:parser.pos])
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		parser.pos = start
+		return 0, parser.errorf("invalid number %q", text)
+	}
+	return value, nil
+}
+
+// parseIdentifier 解析常量或函数调用
+func (parser *expressionParser) parseIdentifier() (float64, error) {
+	start := parser.pos
+	for parser.pos < len(parser.input) {
+		r := parser.input[parser.pos]
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != 'π' {
+			break
+		}
+		parser.pos++
+	}
+	name := strings.ToLower(string(parser.input[start:parser.pos]))
+
+	if open := parser.peek(); open != '(' && open != '（' {
+		switch name {
+		case "pi", "π":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		parser.pos = start
+		return 0, parser.errorf("unknown constant %q", name)
+	}
+
+	function, ok := calculatorFunctions[name]
+	if !ok {
+		parser.pos = start
+		return 0, parser.errorf("unknown function %q", name)
+	}
+	parser.pos++
+	var args []float64
+	if closing := parser.peek(); closing == ')' || closing == '）' {
+		parser.pos++
+	} else {
+		for {
+			value, err := parser.parseExpression()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, value)
+			next := parser.peek()
+			if next == ',' || next == '，' {
+				parser.pos++
+				continue
+			}
+			if next != ')' && next != '）' {
+				return 0, parser.errorf("missing closing parenthesis")
+			}
+			parser.pos++
+			break
+		}
+	}
+	if len(args) < function.minArgs || (function.maxArgs >= 0 && len(args) > function.maxArgs) {
+		return 0, fmt.Errorf("wrong number of arguments for %s: %d", name, len(args))
+	}
+	return function.call(args)
+}
+
+type calculatorFunction struct {
+	minArgs int
+	// maxArgs 为-1时不限制参数个数
+	maxArgs int
+	call    func(args []float64) (float64, error)
+}
+
+// unary 只有一个参数的函数
+func unary(function func(float64) float64) calculatorFunction {
+	return calculatorFunction{
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(args []float64) (float64, error) {
+			return function(args[0]), nil
+		},
+	}
+}
+
+var calculatorFunctions = map[string]calculatorFunction{
+	"sqrt": {minArgs: 1, maxArgs: 1, call: func(args []float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, fmt.Errorf("sqrt of negative number")
+		}
+		return math.Sqrt(args[0]), nil
+	}},
+	"cbrt":  unary(math.Cbrt),
+	"abs":   unary(math.Abs),
+	"round": unary(math.Round),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"asin":  unary(math.Asin),
+	"acos":  unary(math.Acos),
+	"atan":  unary(math.Atan),
+	"log":   unary(math.Log10),
+	"log10": unary(math.Log10),
+	"log2":  unary(math.Log2),
+	"ln":    unary(math.Log),
+	"exp":   unary(math.Exp),
+	"pow": {minArgs: 2, maxArgs: 2, call: func(args []float64) (float64, error) {
+		return math.Pow(args[0], args[1]), nil
+	}},
+	"min": {minArgs: 1, maxArgs: -1, call: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"max": {minArgs: 1, maxArgs: -1, call: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+}
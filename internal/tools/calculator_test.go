@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 4 / 3", 1},
+		{"7 % 3", 1},
+		{"2 ^ 10", 1024},
+		{"2 ** 10", 1024},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"--3", 3},
+		{"3 * -2", -6},
+		{"1.5e3 + 2E-1", 1500.2},
+		{".5 + .25", 0.75},
+		{"sqrt(16) + abs(-3)", 7},
+		{"pow(2, 8)", 256},
+		{"min(3, 1, 2) + max(4, 6, 5)", 7},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6},
+		{"log(1000) + log2(8) + ln(e)", 7},
+		{"cos(pi)", -1},
+		{"（1 + 2）× 3 ÷ 9", 1},
+		{"max(1，2)", 2},
+		{"SQRT(9)", 3},
+	}
+	for _, test := range tests {
+		got, err := evaluate(test.expression)
+		if err != nil {
+			t.Errorf("evaluate(%q) returned error: %v", test.expression, err)
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("evaluate(%q) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		contains   string
+	}{
+		{"", "empty expression"},
+		{"   ", "empty expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "missing closing parenthesis"},
+		{"1 + 2)", "unexpected ')'"},
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"sqrt(-1)", "sqrt of negative number"},
+		{"foo(1)", "unknown function"},
+		{"x + 1", "unknown constant"},
+		{"pow(2)", "wrong number of arguments"},
+		{"abs(1, 2)", "wrong number of arguments"},
+		{"1.2.3", "invalid number"},
+		{"10 ^ 400", "not a finite number"},
+		{"1 $ 2", "unexpected '$'"},
+		// 不支持省略乘号
+		{"2π", "unexpected 'π'"},
+		{strings.Repeat("(", maxExpressionDepth+1) + "1" + strings.Repeat(")", maxExpressionDepth+1), "nested too deeply"},
+		{strings.Repeat("1", maxExpressionLength+1), "longer than"},
+	}
+	for _, test := range tests {
+		_, err := evaluate(test.expression)
+		if err == nil {
+			t.Errorf("evaluate(%q) succeeded, want error containing %q", test.expression, test.contains)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("evaluate(%q) error = %q, want containing %q", test.expression, err, test.contains)
+		}
+	}
+}
+
+func TestCalculatorCall(t *testing.T) {
+	tests := []struct {
+		arguments string
+		want      string
+		invalid   bool
+	}{
+		{`{"expression": "0.1 + 0.2"}`, `{"expression":"0.1 + 0.2","result":0.3}`, false},
+		{`{"expression": "(1.5 + 2) * sqrt(16) / 3"}`, `{"expression":"(1.5 + 2) * sqrt(16) / 3","result":4.66666666666667}`, false},
+		{`{"expression": 1}`, "", true},
+		{`not json`, "", true},
+	}
+	for _, test := range tests {
+		got, err := calculator{}.Call(context.Background(), json.RawMessage(test.arguments))
+		if test.invalid {
+			if !errors.Is(err, errInvalidArguments) {
+				t.Errorf("Call(%s) error = %v, want errInvalidArguments", test.arguments, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Call(%s) returned error: %v", test.arguments, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Call(%s) = %s, want %s", test.arguments, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// currentTime 返回当前的日期和时间，模型本身不知道当前时间
+type currentTime struct {
+	location *time.Location
+	now      func() time.Time
+}
+
+func (currentTime) Name() string {
+	return NameCurrentTime
+}
+
+func (currentTime) Description() string {
+	return "Get the current date, time and weekday. Use it whenever the answer depends on today's date or the current time."
+}
+
+func (currentTime) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "timezone": {
+      "type": "string",
+      "description": "IANA time zone name, e.g. \"Asia/Shanghai\" or \"America/New_York\". Defaults to the server's time zone."
+    }
+  }
+}`)
+}
+
+func (tool currentTime) Call(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	location := tool.location
+	if timezone := strings.TrimSpace(args.Timezone); timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return "", fmt.Errorf("%w: unknown time zone %q", errInvalidArguments, timezone)
+		}
+	}
+
+	now := tool.now().In(location)
+	return encodeResult(map[string]any{
+		"time":     now.Format(time.RFC3339),
+		"date":     now.Format(time.DateOnly),
+		"weekday":  now.Weekday().String(),
+		"timezone": location.String(),
+		"offset":   now.Format("-07:00"),
+	})
+}
@@ -0,0 +1,140 @@
+// Package tools 模型在回答过程中可以调用的工具，参数以JSON Schema描述
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Tool 可以由模型调用的工具
+type Tool interface {
+	// Name 工具名，只能包含字母、数字、下划线和连字符
+	Name() string
+	// Description 发送给模型的工具说明
+	Description() string
+	// Parameters 参数的JSON Schema
+	Parameters() json.RawMessage
+	// Call 执行工具，arguments为模型生成的JSON参数，返回发送给模型的结果
+	Call(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+const (
+	NameCalculator     = "calculator"
+	NameCurrentTime    = "current_time"
+	NameUnitConversion = "unit_conversion"
+)
+
+// BuiltinNames 内置工具的名称
+var BuiltinNames = []string{NameCalculator, NameCurrentTime, NameUnitConversion}
+
+// BuiltinOptions 内置工具的选项
+type BuiltinOptions struct {
+	// Location current_time未指定时区时使用的时区
+	Location *time.Location
+}
+
+// NewBuiltin 按名称创建内置工具
+func NewBuiltin(name string, options BuiltinOptions) (Tool, error) {
+	switch name {
+	case NameCalculator:
+		return calculator{}, nil
+	case NameCurrentTime:
+		location := options.Location
+		if location == nil {
+			location = time.Local
+		}
+		return currentTime{location: location, now: time.Now}, nil
+	case NameUnitConversion:
+		return unitConversion{}, nil
+	default:
+		return nil, fmt.Errorf("unknown builtin tool: %s", name)
+	}
+}
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Registry 按名称管理工具，保持注册顺序
+type Registry struct {
+	tools map[string]Tool
+	order []Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// Register 注册工具，名称不合法或重复时返回错误
+func (registry *Registry) Register(tool Tool) error {
+	name := tool.Name()
+	if !toolNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid tool name: %q", name)
+	}
+	if _, exists := registry.tools[name]; exists {
+		return fmt.Errorf("duplicate tool: %s", name)
+	}
+	registry.tools[name] = tool
+	registry.order = append(registry.order, tool)
+	return nil
+}
+
+func (registry *Registry) Get(name string) (Tool, bool) {
+	tool, ok := registry.tools[name]
+	return tool, ok
+}
+
+// Tools 按注册顺序返回所有工具
+func (registry *Registry) Tools() []Tool {
+	return registry.order
+}
+
+// Call 执行工具，工具panic时作为错误返回
+func Call(ctx context.Context, tool Tool, arguments json.RawMessage) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = ""
+			err = fmt.Errorf("tool %s panicked: %v", tool.Name(), r)
+		}
+	}()
+	// 部分模型没有参数时返回空字符串
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	return tool.Call(ctx, arguments)
+}
+
+var errInvalidArguments = errors.New("invalid arguments")
+
+// decodeArguments 解析JSON参数
+func decodeArguments(arguments json.RawMessage, target any) error {
+	if err := json.Unmarshal(arguments, target); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArguments, err)
+	}
+	return nil
+}
+
+// encodeResult 将结果序列化为JSON
+func encodeResult(result any) (string, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// roundNumber 保留15位有效数字，去掉浮点运算的误差（如0.1+0.2）
+func roundNumber(value float64) float64 {
+	if value == 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return value
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'g', 15, 64), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
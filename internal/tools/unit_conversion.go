@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unitConversion 换算同一类别的计量单位
+type unitConversion struct{}
+
+// unit 计量单位，换算为基本单位：base = value * factor + offset
+// 长度为米、质量为千克、温度为开尔文、体积为升、面积为平方米、速度为米/秒、时间为秒、数据量为字节
+type unit struct {
+	category string
+	factor   float64
+	offset   float64
+}
+
+var units = map[string]unit{}
+
+func init() {
+	add := func(category string, factor float64, offset float64, names ...string) {
+		for _, name := range names {
+			units[strings.ToLower(name)] = unit{category: category, factor: factor, offset: offset}
+		}
+	}
+
+	add("length", 1e-9, 0, "nm", "nanometer", "纳米")
+	add("length", 1e-6, 0, "um", "μm", "micrometer", "微米")
+	add("length", 1e-3, 0, "mm", "millimeter", "毫米")
+	add("length", 1e-2, 0, "cm", "centimeter", "厘米")
+	add("length", 0.1, 0, "dm", "decimeter", "分米")
+	add("length", 1, 0, "m", "meter", "metre", "米")
+	add("length", 1e3, 0, "km", "kilometer", "kilometre", "公里", "千米")
+	add("length", 0.0254, 0, "in", "inch", "inches", "英寸")
+	add("length", 0.3048, 0, "ft", "foot", "feet", "英尺")
+	add("length", 0.9144, 0, "yd", "yard", "码")
+	add("length", 1609.344, 0, "mi", "mile", "英里")
+	add("length", 1852, 0, "nmi", "nautical mile", "海里")
+	add("length", 1.0/30, 0, "寸")
+	add("length", 1.0/3, 0, "尺")
+	add("length", 10.0/3, 0, "丈")
+	add("length", 500, 0, "里")
+
+	add("mass", 1e-6, 0, "mg", "milligram", "毫克")
+	add("mass", 1e-3, 0, "g", "gram", "克")
+	add("mass", 1, 0, "kg", "kilogram", "千克", "公斤")
+	add("mass", 1e3, 0, "t", "tonne", "ton", "metric ton", "吨")
+	add("mass", 0.45359237, 0, "lb", "lbs", "pound", "磅")
+	add("mass", 0.028349523125, 0, "oz", "ounce", "盎司")
+	add("mass", 0.05, 0, "两")
+	add("mass", 0.5, 0, "斤")
+
+	add("temperature", 1, 273.15, "c", "°c", "℃", "celsius", "摄氏度")
+	add("temperature", 5.0/9, 459.67*5/9, "f", "°f", "℉", "fahrenheit", "华氏度")
+	add("temperature", 1, 0, "k", "kelvin", "开尔文")
+
+	add("volume", 1e-3, 0, "ml", "milliliter", "毫升")
+	add("volume", 1, 0, "l", "liter", "litre", "升")
+	add("volume", 1e3, 0, "m3", "m³", "cubic meter", "立方米")
+	add("volume", 3.785411784, 0, "gal", "gallon", "加仑")
+	add("volume", 0.946352946, 0, "qt", "quart")
+	add("volume", 0.473176473, 0, "pt", "pint")
+	add("volume", 0.0295735295625, 0, "fl oz", "floz", "fluid ounce")
+
+	add("area", 1e-4, 0, "cm2", "cm²", "平方厘米")
+	add("area", 1, 0, "m2", "m²", "square meter", "平方米")
+	add("area", 1e4, 0, "ha", "hectare", "公顷")
+	add("area", 1e6, 0, "km2", "km²", "square kilometer", "平方公里", "平方千米")
+	add("area", 0.09290304, 0, "ft2", "ft²", "square foot", "square feet", "平方英尺")
+	add("area", 4046.8564224, 0, "acre", "英亩")
+	add("area", 2000.0/3, 0, "亩")
+
+	add("speed", 1, 0, "m/s", "mps")
+	add("speed", 1/3.6, 0, "km/h", "kmh", "kph")
+	add("speed", 0.44704, 0, "mph")
+	add("speed", 1852/3600.0, 0, "kn", "knot", "节")
+
+	add("time", 1e-3, 0, "ms", "millisecond", "毫秒")
+	add("time", 1, 0, "s", "sec", "second", "秒")
+	add("time", 60, 0, "min", "minute", "分钟")
+	add("time", 3600, 0, "h", "hr", "hour", "小时")
+	add("time", 86400, 0, "d", "day", "天")
+	add("time", 7*86400, 0, "week", "周")
+	add("time", 365*86400, 0, "year", "年")
+
+	add("data", 0.125, 0, "bit")
+	add("data", 1, 0, "b", "byte", "字节")
+	add("data", 1e3, 0, "kb", "kilobyte")
+	add("data", 1e6, 0, "mb", "megabyte")
+	add("data", 1e9, 0, "gb", "gigabyte")
+	add("data", 1e12, 0, "tb", "terabyte")
+	add("data", 1<<10, 0, "kib", "kibibyte")
+	add("data", 1<<20, 0, "mib", "mebibyte")
+	add("data", 1<<30, 0, "gib", "gibibyte")
+	add("data", 1<<40, 0, "tib", "tebibyte")
+}
+
+// normalizeUnit 单位名不区分大小写，英文单位名兼容复数形式
+func normalizeUnit(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if _, ok := units[name]; ok {
+		return name
+	}
+	if singular, found := strings.CutSuffix(name, "s"); found && len(singular) >= 2 {
+		if _, ok := units[singular]; ok {
+			return singular
+		}
+	}
+	return name
+}
+
+func (unitConversion) Name() string {
+	return NameUnitConversion
+}
+
+func (unitConversion) Description() string {
+	return "Convert a value between units of the same kind: length, mass, temperature, volume, area, speed, time " +
+		"and data size. Accepts symbols (km, lb, °F, m/s, GiB), English names and common Chinese units (公里, 斤, 亩)."
+}
+
+func (unitConversion) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "value": {
+      "type": "number",
+      "description": "Value to convert"
+    },
+    "from": {
+      "type": "string",
+      "description": "Unit of the value, e.g. \"km\""
+    },
+    "to": {
+      "type": "string",
+      "description": "Target unit, e.g. \"mi\""
+    }
+  },
+  "required": ["value", "from", "to"]
+}`)
+}
+
+func (unitConversion) Call(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Value *float64 `json:"value"`
+		From  string   `json:"from"`
+		To    string   `json:"to"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if args.Value == nil {
+		return "", fmt.Errorf("%w: value is required", errInvalidArguments)
+	}
+	from, ok := units[normalizeUnit(args.From)]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown unit %q, supported categories: %s", errInvalidArguments, args.From, unitCategories())
+	}
+	to, ok := units[normalizeUnit(args.To)]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown unit %q, supported categories: %s", errInvalidArguments, args.To, unitCategories())
+	}
+	if from.category != to.category {
+		return "", fmt.Errorf("%w: cannot convert %s (%s) to %s (%s)", errInvalidArguments, args.From, from.category, args.To, to.category)
+	}
+
+	base := *args.Value*from.factor + from.offset
+	result := (base - to.offset) / to.factor
+	return encodeResult(map[string]any{
+		"value":  *args.Value,
+		"from":   args.From,
+		"to":     args.To,
+		"result": roundNumber(result),
+	})
+}
+
+func unitCategories() string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, unit := range units {
+		if !seen[unit.category] {
+			seen[unit.category] = true
+			categories = append(categories, unit.category)
+		}
+	}
+	sort.Strings(categories)
+	return strings.Join(categories, ", ")
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestUnitConversionCall(t *testing.T) {
+	tests := []struct {
+		value float64
+		from  string
+		to    string
+		want  float64
+	}{
+		{1, "km", "m", 1000},
+		{1, "mi", "km", 1.609344},
+		{12, "inches", "ft", 1},
+		{3, "Feet", "yd", 1},
+		{1, "公里", "里", 2},
+		{1, "kg", "斤", 2},
+		{16, "oz", "lb", 1},
+		{100, "°C", "°F", 212},
+		{32, "fahrenheit", "celsius", 0},
+		{0, "k", "℃", -273.15},
+		{-40, "c", "f", -40},
+		{1, "gal", "l", 3.785411784},
+		{1, "ha", "亩", 15},
+		{36, "km/h", "m/s", 10},
+		{90, "minutes", "hours", 1.5},
+		{1, "GiB", "MiB", 1024},
+		{8, "bit", "byte", 1},
+		{1, "fl  oz", "ml", 29.5735295625},
+	}
+	for _, test := range tests {
+		arguments, _ := json.Marshal(map[string]any{"value": test.value, "from": test.from, "to": test.to})
+		got, err := unitConversion{}.Call(context.Background(), arguments)
+		if err != nil {
+			t.Errorf("convert %v %s to %s returned error: %v", test.value, test.from, test.to, err)
+			continue
+		}
+		var result struct {
+			Result float64 `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(got), &result); err != nil {
+			t.Fatalf("invalid result %s: %v", got, err)
+		}
+		if math.Abs(result.Result-test.want) > 1e-9 {
+			t.Errorf("convert %v %s to %s = %v, want %v", test.value, test.from, test.to, result.Result, test.want)
+		}
+	}
+}
+
+func TestUnitConversionErrors(t *testing.T) {
+	tests := []struct {
+		arguments string
+		contains  string
+	}{
+		{`{"from": "km", "to": "m"}`, "value is required"},
+		{`{"value": 1, "from": "parsec", "to": "m"}`, `unknown unit "parsec"`},
+		{`{"value": 1, "from": "m", "to": "furlong"}`, `unknown unit "furlong"`},
+		{`{"value": 1, "from": "kg", "to": "m"}`, "cannot convert"},
+		{`{"value": "1", "from": "kg", "to": "g"}`, "invalid arguments"},
+	}
+	for _, test := range tests {
+		_, err := unitConversion{}.Call(context.Background(), json.RawMessage(test.arguments))
+		if !errors.Is(err, errInvalidArguments) {
+			t.Errorf("Call(%s) error = %v, want errInvalidArguments", test.arguments, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Call(%s) error = %q, want containing %q", test.arguments, err, test.contains)
+		}
+	}
+}
+
+func TestNormalizeUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"KM", "km"},
+		{"  Nautical   Mile ", "nautical mile"},
+		{"meters", "meter"},
+		{"kilograms", "kilogram"},
+		{"ms", "ms"},
+		{"s", "s"},
+		{"unknowns", "unknowns"},
+	}
+	for _, test := range tests {
+		if got := normalizeUnit(test.name); got != test.want {
+			t.Errorf("normalizeUnit(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
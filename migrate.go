@@ -0,0 +1,79 @@
+package main
+
+import (
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/migrations"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// runMigrate 执行migrate子命令：migrate up|down [steps]|status
+func runMigrate(conf *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法：migrate up|down [steps]|status")
+	}
+
+	db, err := initDB(conf.Database)
+	if err != nil {
+		return fmt.Errorf("DB连接失败：%w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		executed, err := migrator.Up(ctx)
+		for _, migration := range executed {
+			fmt.Printf("已执行迁移 %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(executed) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("回滚步数必须是正整数：%q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("已回滚迁移 %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("没有可以回滚的迁移")
+		}
+	case "status":
+		statusList, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statusList {
+			if status.Applied {
+				fmt.Printf("%04d_%-30s 已执行 %s\n",
+					status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%-30s 未执行\n", status.Version, status.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("未知的migrate子命令：%q", args[0])
+	}
+	return nil
+}
@@ -4,9 +4,18 @@ import (
 	"LaoQGChat/api/controllers"
 	"LaoQGChat/api/middlewares"
 	"LaoQGChat/api/services"
+	"LaoQGChat/internal/config"
+	"LaoQGChat/internal/migrations"
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"time"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,76 +23,323 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	flag.Parse()
+
+	// 读取配置，未显式指定配置文件时允许文件不存在
+	configExplicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configExplicit = true
+		}
+	})
+
+	// 子命令
+	if flag.NArg() > 0 {
+		var err error
+		switch flag.Arg(0) {
+		case "migrate":
+			// 迁移只需要数据库配置
+			var conf *config.Config
+			conf, err = config.LoadDatabase(*configPath, !configExplicit)
+			if err == nil {
+				err = runMigrate(conf, flag.Args()[1:])
+			}
+		default:
+			err = fmt.Errorf("未知的子命令：%q", flag.Arg(0))
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	conf, err := config.Load(*configPath, !configExplicit)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err = run(conf); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// run 启动服务，收到SIGINT/SIGTERM后停止接收新请求，等待处理中的请求结束后依次关闭service和连接池
+func run(conf *config.Config) error {
 	// 初始化db
-	db, err := initDB()
+	db, err := initDB(conf.Database)
 	if err != nil {
-		fmt.Println("DB连接失败")
-		return
+		return fmt.Errorf("DB连接失败：%w", err)
+	}
+	defer func() {
+		_ = db.Close()
+		fmt.Println("DB连接池已关闭")
+	}()
+
+	// 执行未执行的DB迁移
+	if conf.Database.AutoMigrate {
+		migrator, err := migrations.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		executed, err := migrator.Up(context.Background())
+		for _, migration := range executed {
+			fmt.Printf("已执行迁移 %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
 	server := gin.Default()
 
 	// 配置CORS中间件
-	config := cors.Config{
-		AllowAllOrigins:  true,                               // 允许所有的域名
-		AllowMethods:     []string{"POST"},                   // 允许的HTTP方法
-		AllowHeaders:     []string{"Origin", "Content-Type"}, // 允许的请求头
-		ExposeHeaders:    []string{"Content-Length"},         // 暴露的头信息
-		AllowCredentials: true,                               // 允许携带凭证
-		MaxAge:           12 * time.Hour,                     // 预检请求缓存时间
+	corsConfig := cors.Config{
+		AllowAllOrigins:  slices.Contains(conf.CORS.AllowOrigins, "*"), // 允许所有的域名
+		AllowMethods:     conf.CORS.AllowMethods,                       // 允许的HTTP方法
+		AllowHeaders:     conf.CORS.AllowHeaders,                       // 允许的请求头
+		ExposeHeaders:    conf.CORS.ExposeHeaders,                      // 暴露的头信息
+		AllowCredentials: conf.CORS.AllowCredentials,                   // 允许携带凭证
+		MaxAge:           conf.CORS.MaxAge,                             // 预检请求缓存时间
+	}
+	if !corsConfig.AllowAllOrigins {
+		corsConfig.AllowOrigins = conf.CORS.AllowOrigins // 允许的域名
 	}
-	server.Use(cors.New(config))
+	server.Use(cors.New(corsConfig))
+
+	// 初始化图片service
+	blobStore, err := services.NewBlobStore(conf.Images)
+	if err != nil {
+		return fmt.Errorf("初始化图片存储失败：%w", err)
+	}
+	var (
+		imageService    = services.NewImageService(db, blobStore, conf.Images)
+		imageController = controllers.NewImageController(imageService)
+	)
+	if imageService == nil || imageController == nil {
+		return errors.New("初始化图片service失败")
+	}
+	defer func() {
+		_ = imageService.Close()
+	}()
+
+	// 签名URL由模型服务和浏览器直接访问，不经过之后配置的异常处理、版本检测、DB事务和认证中间件
+	server.GET("/Image/Get/:imageId", imageController.Get)
 
 	// 配置异常处理中间件
 	server.Use(middlewares.ErrorHandler())
 
+	// 配置流式响应中间件
+	server.Use(middlewares.StreamHandler("/Chat/StartChatStream", "/Chat/ChatStream"))
+
 	// 初始化认证service
 	var (
-		authService    = services.NewAuthService(db)
+		authService    = services.NewAuthService(db, conf.Auth)
 		authController = controllers.NewAuthController(authService)
 	)
 	if authService == nil || authController == nil {
-		fmt.Println("初始化认证service失败")
-		return
+		return errors.New("初始化认证service失败")
 	}
+	defer func() {
+		_ = authService.Close()
+	}()
 
 	// 配置版本检测中间件
-	server.Use(middlewares.VersionHandler("1.2.0"))
+	server.Use(middlewares.VersionHandler(conf.Client.Version))
 
 	// 配置DB事务中间件
 	server.Use(middlewares.TransactionHandler(db))
 
 	// 配置认证中间件
-	server.Use(middlewares.AuthHandler(authService.Check))
+	server.Use(middlewares.AuthHandler(authService.Check, "/Auth/Login", "/Auth/Register", "/Auth/Refresh"))
+
+	// 初始化模型服务
+	chatProvider, err := services.NewChatProvider(conf.Provider)
+	if err != nil {
+		return fmt.Errorf("初始化模型服务失败：%w", err)
+	}
+
+	// 初始化使用量service
+	var (
+		usageService    = services.NewUsageService(db, conf.Quota)
+		usageController = controllers.NewUsageController(usageService)
+	)
+	if usageService == nil || usageController == nil {
+		return errors.New("初始化使用量service失败")
+	}
+	defer func() {
+		_ = usageService.Close()
+	}()
+
+	// 初始化语音识别服务
+	transcriber, err := services.NewTranscriber(conf.Audio, conf.Provider)
+	if err != nil {
+		return fmt.Errorf("初始化语音识别服务失败：%w", err)
+	}
+	var (
+		audioService    = services.NewAudioService(transcriber, usageService, conf.Audio)
+		audioController = controllers.NewAudioController(audioService)
+	)
+
+	// 初始化文字识别引擎
+	ocrEngine, err := services.NewOCREngine(conf.OCR, chatProvider, conf.Models, conf.Provider.Model)
+	if err != nil {
+		return fmt.Errorf("初始化文字识别引擎失败：%w", err)
+	}
+	ocrService := services.NewOCRService(ocrEngine, imageService, usageService, conf.OCR)
+
+	// 初始化文档service
+	documentService := services.NewDocumentService(conf.Documents)
+
+	// 初始化知识库service
+	embedder, err := services.NewEmbedder(conf.Knowledge, conf.Provider)
+	if err != nil {
+		return fmt.Errorf("初始化向量模型服务失败：%w", err)
+	}
+	knowledgeService, err := services.NewKnowledgeService(db, embedder, usageService, conf.Knowledge)
+	if err != nil {
+		return fmt.Errorf("初始化知识库service失败：%w", err)
+	}
+	knowledgeController := controllers.NewKnowledgeController(knowledgeService)
+	defer func() {
+		_ = knowledgeService.Close()
+	}()
+
+	// 初始化工具service
+	toolService, err := services.NewToolService(conf.Tools)
+	if err != nil {
+		return fmt.Errorf("初始化工具失败：%w", err)
+	}
+
+	// 调用模型服务的路由检查使用额度
+	quotaHandler := middlewares.QuotaHandler(usageService.CheckQuota)
 
 	// 初始化业务service
 	var (
-		chatService    = services.NewChatService(db)
+		chatService    = services.NewChatService(db, chatProvider, usageService, audioService, ocrService, imageService, documentService, knowledgeService, toolService, conf.Models, conf.Provider.Model)
 		chatController = controllers.NewChatController(authService, chatService)
 	)
 	if chatService == nil || chatController == nil {
-		fmt.Println("初始化业务service失败")
-		return
+		return errors.New("初始化业务service失败")
 	}
+	defer func() {
+		_ = chatService.Close()
+	}()
+
+	// 初始化角色service
+	var (
+		personaService    = services.NewPersonaService(db, conf.Models, conf.Provider.Model)
+		personaController = controllers.NewPersonaController(personaService)
+	)
+	if personaService == nil || personaController == nil {
+		return errors.New("初始化角色service失败")
+	}
+	defer func() {
+		_ = personaService.Close()
+	}()
 
 	server.POST("/Auth/Login", authController.Login)
 
-	server.POST("/Chat/StartChat", chatController.StartChat)
+	server.POST("/Auth/Register", authController.Register)
+
+	server.POST("/Auth/ChangePassword", authController.ChangePassword)
+
+	server.POST("/Auth/DeleteAccount", authController.DeleteAccount)
+
+	server.POST("/Auth/Logout", authController.Logout)
 
-	server.POST("/Chat/Chat", chatController.Chat)
+	server.POST("/Auth/ListDevices", authController.ListDevices)
+
+	server.POST("/Auth/RevokeDevice", authController.RevokeDevice)
+
+	server.POST("/Auth/Refresh", authController.Refresh)
+
+	server.POST("/Chat/StartChat", quotaHandler, chatController.StartChat)
+
+	server.POST("/Chat/Chat", quotaHandler, chatController.Chat)
+
+	server.POST("/Chat/StartChatStream", quotaHandler, chatController.StartChatStream)
+
+	server.POST("/Chat/ChatStream", quotaHandler, chatController.ChatStream)
 
 	server.POST("/Chat/EndChat", chatController.EndChat)
 
-	err = server.Run(":12195")
-	if err != nil {
-		fmt.Println("启动服务失败")
-		return
+	server.POST("/Chat/ListSessions", chatController.ListSessions)
+
+	server.POST("/Chat/GetSession", chatController.GetSession)
+
+	server.POST("/Chat/SelectChoice", chatController.SelectChoice)
+
+	server.POST("/Chat/ListModels", chatController.ListModels)
+
+	server.POST("/Persona/List", personaController.ListPersonas)
+
+	server.POST("/Persona/Create", personaController.CreatePersona)
+
+	server.POST("/Persona/Update", personaController.UpdatePersona)
+
+	server.POST("/Persona/Delete", personaController.DeletePersona)
+
+	server.POST("/Image/Upload", imageController.Upload)
+
+	server.POST("/Knowledge/List", knowledgeController.ListKnowledgeBases)
+
+	server.POST("/Knowledge/Create", knowledgeController.CreateKnowledgeBase)
+
+	server.POST("/Knowledge/Delete", knowledgeController.DeleteKnowledgeBase)
+
+	server.POST("/Knowledge/ListDocuments", knowledgeController.ListDocuments)
+
+	server.POST("/Knowledge/Upload", quotaHandler, knowledgeController.UploadDocument)
+
+	server.POST("/Knowledge/DeleteDocument", knowledgeController.DeleteDocument)
+
+	server.POST("/Knowledge/Search", quotaHandler, knowledgeController.Search)
+
+	server.POST("/Audio/Transcribe", quotaHandler, audioController.Transcribe)
+
+	server.POST("/Usage/Quota", usageController.GetQuota)
+
+	server.POST("/Usage/Summary", usageController.GetSummary)
+
+	httpServer := &http.Server{
+		Addr:              conf.Server.Addr,
+		Handler:           server,
+		ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
+	}
+
+	// 监听停止信号
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		return fmt.Errorf("启动服务失败：%w", err)
+	case <-signalCtx.Done():
+	}
+	stop()
+
+	// 停止接收新请求，等待处理中的请求（包括模型调用和DB事务）结束
+	fmt.Printf("正在停止服务，最多等待%s\n", conf.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+	defer cancel()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("等待请求结束超时，强制关闭连接：", err)
+		_ = httpServer.Close()
 	}
+	fmt.Println("服务已停止")
+	return nil
 }
 
-func initDB() (*sql.DB, error) {
-	connStr := "host=localhost port=5432 user=laoqionggui password=LaoQi0ng@ui sslmode=disable"
-	db, err := sql.Open("postgres", connStr)
+func initDB(dbConfig config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dbConfig.DSN)
 	if err != nil {
 		return nil, err
 	}
@@ -92,9 +348,9 @@ func initDB() (*sql.DB, error) {
 	}
 
 	// 设置连接池
-	db.SetMaxOpenConns(10)   // 最大打开连接数
-	db.SetMaxIdleConns(10)   // 最大闲置连接数
-	db.SetConnMaxLifetime(0) // 连接的最大存活时间
+	db.SetMaxOpenConns(dbConfig.MaxOpenConns)       // 最大打开连接数
+	db.SetMaxIdleConns(dbConfig.MaxIdleConns)       // 最大闲置连接数
+	db.SetConnMaxLifetime(dbConfig.ConnMaxLifetime) // 连接的最大存活时间
 
 	return db, nil
 }